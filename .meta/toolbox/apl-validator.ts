@@ -20,6 +20,19 @@ const WASM_DIR = join(__dirname, 'wasm');
 export interface SyntaxResult {
   valid: boolean;
   error: string | null;
+  /** APL only: location of the parse error, null when the parser gave none. */
+  line?: number | null;
+  column?: number | null;
+  offset?: number | null;
+  /** APL only: deprecated functions used by an otherwise valid query. */
+  warnings?: { message: string; line: number; column: number; replacement: string }[];
+  /** PromQL only: rune span of the first parse error, plus every reported error. */
+  start?: number | null;
+  end?: number | null;
+  positions?: { start: number; end: number; message: string }[];
+  /** PromQL only: offending token of the first error ("<EOF>" at end of input) and what was expected. */
+  unexpected?: string | null;
+  expected?: string[];
 }
 
 type ValidateFn = (query: string) => SyntaxResult;
@@ -71,3 +84,45 @@ export function validatePromQLSyntax(query: string): SyntaxResult {
   if (!promqlValidateFn) throw new Error('PromQL validator not initialized — call initPromQLValidator() first');
   return promqlValidateFn(query);
 }
+
+/**
+ * What APL accepts. operators and keywords are the literals of the kirby
+ * grammar, so they always agree with validation. functions can't be read
+ * from the parser, which accepts any identifier in call position, so they
+ * are the hand-maintained catalog in wasm/apl_catalog.go and are
+ * incomplete: a name missing from them may still be valid.
+ */
+export interface APLBuiltins {
+  functionsComplete: false;
+  /** maxArgs is null for variadic functions. */
+  functions: { name: string; aggregation: boolean; minArgs: number; maxArgs: number | null }[];
+  /** Punctuation the grammar matches, such as "|" and "==". */
+  operators: string[];
+  /** Words the grammar matches, such as "where" and "by". */
+  keywords: string[];
+}
+
+export function listAPLBuiltins(): APLBuiltins {
+  if (!aplValidateFn) throw new Error('APL validator not initialized — call initAPLValidator() first');
+  return (globalThis as any).ListAPLBuiltins();
+}
+
+export interface LanguageResult {
+  language: 'apl' | 'promql' | 'ambiguous' | 'invalid';
+  aplValid: boolean;
+  promqlValid: boolean;
+}
+
+/**
+ * Parses the query with both parsers. The two live in separate WASM modules,
+ * so this can't be done from either one; both validators must be initialized.
+ */
+export function detectLanguage(query: string): LanguageResult {
+  const aplValid = validateAPLSyntax(query).valid;
+  const promqlValid = validatePromQLSyntax(query).valid;
+  let language: LanguageResult['language'] = 'invalid';
+  if (aplValid && promqlValid) language = 'ambiguous';
+  else if (aplValid) language = 'apl';
+  else if (promqlValid) language = 'promql';
+  return { language, aplValid, promqlValid };
+}
@@ -0,0 +1,115 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// aplAggregation is one aggregation of a summarize. Func is "" when the
+// aggregation isn't a single call, such as count() * 2, and Arg is then
+// the whole expression.
+type aplAggregation struct {
+	Func  string
+	Arg   string // text between the parens, "" for none
+	Alias string
+}
+
+type summarizeStage struct {
+	Aggregations []aplAggregation
+	By           []string
+}
+
+// extractSummarizes reads every top-level summarize stage in src, in
+// order, keeping the grouping keys as written.
+func extractSummarizes(src string) ([]summarizeStage, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var stages []summarizeStage
+	for _, pipeline := range splitPipelines(significant(toks)) {
+		for _, stage := range pipeline[1:] {
+			op, args := stageOperator(stage)
+			if op != "summarize" {
+				continue
+			}
+			aggs, keys := splitSummarize(args)
+			var s summarizeStage
+			for _, item := range splitList(aggs) {
+				s.Aggregations = append(s.Aggregations, aggregationOf(src, item))
+			}
+			for _, key := range splitList(keys) {
+				s.By = append(s.By, tokenText(src, key))
+			}
+			stages = append(stages, s)
+		}
+	}
+	return stages, nil
+}
+
+func aggregationOf(src string, item []lexer.Token) aplAggregation {
+	var agg aplAggregation
+	if alias, expr, ok := aliased(item); ok {
+		agg.Alias, item = alias, expr
+	}
+	if isCall(item, 0) {
+		if _, closeIdx := callArgs(item, 0); closeIdx == len(item)-1 {
+			agg.Func = item[0].Value
+			agg.Arg = tokenText(src, item[2:closeIdx])
+			return agg
+		}
+	}
+	agg.Arg = tokenText(src, item)
+	return agg
+}
+
+// jsExtractAggregationsAPL returns an array, as TokenizeAPL does, of one
+// {aggregations, by} per summarize stage, empty without any. Each
+// aggregation is {func, arg, alias}, arg null for a call without arguments
+// and alias null when there is none.
+func jsExtractAggregationsAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	stages, err := extractSummarizes(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	summarizes := js.Global().Get("Array").New()
+	for i, s := range stages {
+		aggs := js.Global().Get("Array").New()
+		for j, a := range s.Aggregations {
+			obj := js.Global().Get("Object").New()
+			obj.Set("func", js.Null())
+			if a.Func != "" {
+				obj.Set("func", a.Func)
+			}
+			obj.Set("arg", js.Null())
+			if a.Arg != "" {
+				obj.Set("arg", a.Arg)
+			}
+			obj.Set("alias", js.Null())
+			if a.Alias != "" {
+				obj.Set("alias", a.Alias)
+			}
+			aggs.SetIndex(j, obj)
+		}
+		obj := js.Global().Get("Object").New()
+		obj.Set("aggregations", aggs)
+		obj.Set("by", jsStrings(s.By))
+		summarizes.SetIndex(i, obj)
+	}
+	return summarizes
+}
@@ -0,0 +1,61 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"toolbox/validate"
+)
+
+// jsAnalyzeAPL is ValidateAPL with any of TokenizeAPL, ExtractDatasetsAPL
+// and QueryMetricsAPL folded into the one call. options turns each on with
+// a true tokens, datasets or metrics, adding that field to the result as
+// the export would return it; warnings keeps ValidateAPL's warnings, which
+// are otherwise left out. Unlike feature flags, anything not set to true
+// is off. An invalid query gets only the ValidateAPL result, less its
+// warnings unless asked for.
+func jsAnalyzeAPL(this js.Value, args []js.Value) any {
+	if len(args) < 1 || len(args) > 2 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected source and an optional options object")
+	}
+	want := func(name string) bool {
+		if len(args) < 2 || args[1].Type() != js.TypeObject {
+			return false
+		}
+		v := args[1].Get(name)
+		return v.Type() == js.TypeBoolean && v.Bool()
+	}
+
+	var p validate.APLParser
+	src := args[0].String()
+	result := validateAPL(&p, src)
+	if !want("warnings") {
+		result.Delete("warnings")
+	}
+	if !result.Get("valid").Bool() {
+		return result
+	}
+	if want("tokens") {
+		toks, err := tokenizeAPL(src)
+		if err != nil {
+			return invalidQuery(err)
+		}
+		result.Set("tokens", jsTokens(toks))
+	}
+	if want("datasets") {
+		datasets, err := extractDatasets(src)
+		if err != nil {
+			return invalidQuery(err)
+		}
+		result.Set("datasets", jsStrings(datasets))
+	}
+	if want("metrics") {
+		m, err := measureAPL(src)
+		if err != nil {
+			return invalidQuery(err)
+		}
+		result.Set("metrics", jsQueryMetrics(m))
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall/js"
+	"time"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// timeBin is one bin(field, interval) or bin_auto(field) call. Interval is
+// normalized, e.g. 90m becomes 1h30m, and empty for bin_auto.
+type timeBin struct {
+	Field    string
+	Interval string
+}
+
+var timespanRe = regexp.MustCompile(`^(\d+(?:\.\d+)?)(d|h|m|s|ms|microseconds?|ticks?)$`)
+
+var timespanUnits = map[string]time.Duration{
+	"d":            24 * time.Hour,
+	"h":            time.Hour,
+	"m":            time.Minute,
+	"s":            time.Second,
+	"ms":           time.Millisecond,
+	"microsecond":  time.Microsecond,
+	"microseconds": time.Microsecond,
+	"tick":         100 * time.Nanosecond,
+	"ticks":        100 * time.Nanosecond,
+}
+
+// parseTimespan reads an APL timespan literal such as 5m or 1.5h.
+func parseTimespan(text string) (time.Duration, bool) {
+	m := timespanRe.FindStringSubmatch(text)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	d := n * float64(timespanUnits[m[2]])
+	if d <= 0 || d > math.MaxInt64 {
+		return 0, false
+	}
+	return time.Duration(d), true
+}
+
+// formatTimespan writes d as days, hours, minutes, seconds and
+// milliseconds, largest first and zero parts left out, falling back to
+// Go's notation below a millisecond.
+func formatTimespan(d time.Duration) string {
+	if d%time.Millisecond != 0 {
+		return d.String()
+	}
+	var sb strings.Builder
+	for _, u := range []struct {
+		name string
+		size time.Duration
+	}{{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}, {"ms", time.Millisecond}} {
+		if n := d / u.size; n > 0 {
+			sb.WriteString(strconv.FormatInt(int64(n), 10))
+			sb.WriteString(u.name)
+			d -= n * u.size
+		}
+	}
+	return sb.String()
+}
+
+// extractBinning finds the calls that bucket by time: bin with a timespan
+// interval, and bin_auto. bin over a plain number is left out.
+func extractBinning(src string) ([]timeBin, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, err
+	}
+	toks = significant(toks)
+
+	var bins []timeBin
+	for i, tok := range toks {
+		if !isCall(toks, i) {
+			continue
+		}
+		args, _ := callArgs(toks, i)
+		switch {
+		case tok.Value == "bin" && len(args) == 2:
+			if d, ok := parseTimespan(tokenText(src, args[1])); ok {
+				bins = append(bins, timeBin{Field: tokenText(src, args[0]), Interval: formatTimespan(d)})
+			}
+		case tok.Value == "bin_auto" && len(args) == 1:
+			bins = append(bins, timeBin{Field: tokenText(src, args[0])})
+		}
+	}
+	return bins, nil
+}
+
+// jsExtractBinningAPL returns an array of {field, interval}, interval being
+// null for bin_auto, or the usual invalid result.
+func jsExtractBinningAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	bins, err := extractBinning(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	arr := js.Global().Get("Array").New()
+	for i, b := range bins {
+		obj := js.Global().Get("Object").New()
+		obj.Set("field", b.Field)
+		if b.Interval != "" {
+			obj.Set("interval", b.Interval)
+		} else {
+			obj.Set("interval", js.Null())
+		}
+		arr.SetIndex(i, obj)
+	}
+	return arr
+}
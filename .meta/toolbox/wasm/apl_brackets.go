@@ -0,0 +1,57 @@
+//go:build js && wasm
+
+package main
+
+import "syscall/js"
+
+// bracketPos is where an opening bracket sits.
+type bracketPos struct {
+	Char         string
+	Line, Column int
+}
+
+var closingBracket = map[string]string{"(": ")", "[": "]", "{": "}"}
+
+// unmatchedOpen finds the bracket in src that is never closed: the
+// innermost one still open at the end, or the one a closer of the wrong
+// kind ends up closing. It returns nil when the brackets balance, when the
+// only trouble is a closer with nothing open, and when src doesn't lex, as
+// with an unterminated string.
+func unmatchedOpen(src string) *bracketPos {
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil
+	}
+	var open []int
+	toks = significant(toks)
+	for i, tok := range toks {
+		if _, ok := closingBracket[tok.Value]; ok {
+			open = append(open, i)
+			continue
+		}
+		if tok.Value != ")" && tok.Value != "]" && tok.Value != "}" {
+			continue
+		}
+		if len(open) == 0 {
+			return nil
+		}
+		top := toks[open[len(open)-1]]
+		if closingBracket[top.Value] != tok.Value {
+			return &bracketPos{Char: top.Value, Line: top.Pos.Line, Column: top.Pos.Column}
+		}
+		open = open[:len(open)-1]
+	}
+	if len(open) == 0 {
+		return nil
+	}
+	top := toks[open[len(open)-1]]
+	return &bracketPos{Char: top.Value, Line: top.Pos.Line, Column: top.Pos.Column}
+}
+
+func jsBracketPos(pos *bracketPos) js.Value {
+	obj := js.Global().Get("Object").New()
+	obj.Set("char", pos.Char)
+	obj.Set("line", pos.Line)
+	obj.Set("column", pos.Column)
+	return obj
+}
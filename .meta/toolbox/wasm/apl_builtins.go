@@ -0,0 +1,114 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+)
+
+// grammarLiteral finds a quoted literal in a participle grammar tag, such
+// as "where" or "==" in `"where" @@` or `@("==" | "!=")`.
+var grammarLiteral = regexp.MustCompile(`"(?:\\.|[^"\\])*"|'(?:\\.|[^'\\])*'`)
+
+// aplGrammarLiterals returns every literal the kirby grammar matches,
+// split into keywords, the ones shaped like identifiers, and operators,
+// the punctuation. They come from the participle tags of the node types
+// reachable from ast.Doc, which are the grammar the parser is built from,
+// so the lists change with it. A node type reached only through an
+// interface field is known to the parser alone and isn't walked.
+func aplGrammarLiterals() (keywords, operators []string) {
+	seen := make(map[reflect.Type]bool)
+	found := make(map[string]bool)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || seen[t] {
+			return
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			for _, lit := range grammarLiteral.FindAllString(grammarTag(f.Tag), -1) {
+				s, err := strconv.Unquote(lit)
+				if err != nil {
+					s = lit[1 : len(lit)-1]
+				}
+				if s != "" {
+					found[s] = true
+				}
+			}
+			walk(f.Type)
+		}
+	}
+	walk(reflect.TypeOf(ast.Doc{}))
+	for lit := range found {
+		if plainIdentifier.MatchString(lit) {
+			keywords = append(keywords, lit)
+		} else {
+			operators = append(operators, lit)
+		}
+	}
+	sort.Strings(keywords)
+	sort.Strings(operators)
+	return keywords, operators
+}
+
+// grammarTag is the grammar participle reads from a struct tag: its parser
+// key, or the whole tag when it has no key at all.
+func grammarTag(tag reflect.StructTag) string {
+	if g, ok := tag.Lookup("parser"); ok {
+		return g
+	}
+	if strings.Contains(string(tag), `:"`) {
+		return ""
+	}
+	return string(tag)
+}
+
+// jsListAPLBuiltins returns what APL accepts:
+//
+//	{functionsComplete: false, functions: [{name, aggregation, minArgs, maxArgs}], operators: [...], keywords: [...]}
+//
+// operators and keywords are the literals of the kirby grammar, from
+// aplGrammarLiterals, so they can't disagree with validation. functions
+// can't be had the same way: the grammar takes any identifier in call
+// position and kirby has no function registry, so they're apl_catalog.go,
+// the functions the editor features document, and functionsComplete says
+// so. A name missing from them may still be a function APL ships. maxArgs
+// is null for variadic functions.
+func jsListAPLBuiltins(this js.Value, args []js.Value) any {
+	if len(args) != 0 {
+		return invalidArgs("expected no arguments")
+	}
+
+	fns := js.Global().Get("Array").New()
+	for i, fn := range aplFunctions {
+		obj := js.Global().Get("Object").New()
+		obj.Set("name", fn.Name)
+		obj.Set("aggregation", fn.Aggregation)
+		obj.Set("minArgs", fn.MinArgs)
+		if fn.MaxArgs == variadicArgs {
+			obj.Set("maxArgs", js.Null())
+		} else {
+			obj.Set("maxArgs", fn.MaxArgs)
+		}
+		fns.SetIndex(i, obj)
+	}
+
+	keywords, operators := aplGrammarLiterals()
+	result := js.Global().Get("Object").New()
+	result.Set("functionsComplete", false)
+	result.Set("functions", fns)
+	result.Set("operators", jsStrings(operators))
+	result.Set("keywords", jsStrings(keywords))
+	return result
+}
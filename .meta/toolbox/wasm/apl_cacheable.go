@@ -0,0 +1,62 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"slices"
+	"syscall/js"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// nondeterminism lists what in src is in aplNondeterministic, once each in
+// order of appearance: functions as name(), operators by name. Subqueries
+// count too.
+func nondeterminism(src string) ([]string, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, err
+	}
+
+	toks = significant(toks)
+	reasons := []string{}
+	for i, tok := range toks {
+		var reason string
+		switch {
+		case isFunctionCall(toks, i) && aplNondeterministic[tok.Value]:
+			reason = tok.Value + "()"
+		case i > 0 && isPunct(toks[i-1], "|"):
+			if op, _ := stageOperator(toks[i:]); aplNondeterministic[op] {
+				reason = op
+			}
+		}
+		if reason != "" && !slices.Contains(reasons, reason) {
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons, nil
+}
+
+// jsIsCacheableAPL returns {valid, cacheable, reasons}; a query is
+// cacheable when reasons, what nondeterminism finds, is empty.
+func jsIsCacheableAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	reasons, err := nondeterminism(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("cacheable", len(reasons) == 0)
+	result.Set("reasons", jsStrings(reasons))
+	return result
+}
@@ -0,0 +1,69 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"slices"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// isCall reports whether toks[i] is a function name followed by its
+// argument list.
+func isCall(toks []lexer.Token, i int) bool {
+	return symbolOf(toks[i]) == symIdent && i+1 < len(toks) && isPunct(toks[i+1], "(")
+}
+
+// isFunctionCall is isCall without the keywords that take a parenthesized
+// list, such as in and datatable. Names that are both, like count, are
+// calls.
+func isFunctionCall(toks []lexer.Token, i int) bool {
+	if !isCall(toks, i) {
+		return false
+	}
+	name := toks[i].Value
+	return !aplReserved[name] || slices.ContainsFunc(aplFunctions, func(fn aplFunction) bool { return fn.Name == name })
+}
+
+// callArgs splits the arguments of the call at toks[i] on its top-level
+// commas. It returns the arguments and the index of the closing paren, or
+// len(toks) if the call is unterminated.
+func callArgs(toks []lexer.Token, i int) ([][]lexer.Token, int) {
+	var (
+		args  [][]lexer.Token
+		cur   []lexer.Token
+		depth int
+	)
+	for j := i + 2; j < len(toks); j++ {
+		tok := toks[j]
+		switch {
+		case isPunct(tok, "(") || isPunct(tok, "["):
+			depth++
+		case isPunct(tok, ")") && depth == 0:
+			if len(cur) > 0 || len(args) > 0 {
+				args = append(args, cur)
+			}
+			return args, j
+		case isPunct(tok, ")") || isPunct(tok, "]"):
+			depth--
+		case isPunct(tok, ",") && depth == 0:
+			args = append(args, cur)
+			cur = nil
+			continue
+		}
+		cur = append(cur, tok)
+	}
+	if len(cur) > 0 || len(args) > 0 {
+		args = append(args, cur)
+	}
+	return args, len(toks)
+}
+
+// tokenText returns the source text spanned by toks, or "" for none.
+func tokenText(src string, toks []lexer.Token) string {
+	if len(toks) == 0 {
+		return ""
+	}
+	last := toks[len(toks)-1]
+	return src[toks[0].Pos.Offset : last.Pos.Offset+len(last.Value)]
+}
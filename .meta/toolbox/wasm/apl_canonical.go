@@ -0,0 +1,101 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"syscall/js"
+	"time"
+)
+
+// canonicalAPL is formatAPL with numeric and timespan literals normalized,
+// so queries that only differ in how they spell a value come out the same.
+// Timespans are written in the largest unit that divides them, so 60s and
+// 1m are both 1m and 0.5m is 30s. Numbers keep their type, since 1000 is a
+// long and 1e3 a real and APL divides the two differently: longs are
+// written in decimal, reals with a fraction or exponent, so 1e3 and 1000.0
+// are both 1000.0.
+func canonicalAPL(src string) (string, error) {
+	formatted, err := formatAPL(src)
+	if err != nil {
+		return "", err
+	}
+	toks, err := lexAPL(formatted)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	end := 0
+	for _, tok := range significant(toks) {
+		if symbolOf(tok) != symNumber {
+			continue
+		}
+		lit, ok := canonicalNumber(tok.Value)
+		if !ok {
+			continue
+		}
+		sb.WriteString(formatted[end:tok.Pos.Offset])
+		sb.WriteString(lit)
+		end = tok.Pos.Offset + len(tok.Value)
+	}
+	sb.WriteString(formatted[end:])
+	return sb.String(), nil
+}
+
+// canonicalNumber rewrites a number or timespan literal, or reports false
+// for one it doesn't read.
+func canonicalNumber(lit string) (string, bool) {
+	if d, ok := parseTimespan(lit); ok {
+		return compactTimespan(d), true
+	}
+	if hex, ok := strings.CutPrefix(strings.ToLower(lit), "0x"); ok {
+		n, err := strconv.ParseInt(hex, 16, 64)
+		return strconv.FormatInt(n, 10), err == nil
+	}
+	if n, err := strconv.ParseInt(lit, 10, 64); err == nil {
+		return strconv.FormatInt(n, 10), true
+	}
+	f, err := strconv.ParseFloat(lit, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", false
+	}
+	s := strings.Replace(strconv.FormatFloat(f, 'g', -1, 64), "e+", "e", 1)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s, true
+}
+
+// compactTimespan writes d as a single literal in the largest unit that
+// divides it.
+func compactTimespan(d time.Duration) string {
+	for _, u := range []struct {
+		name string
+		size time.Duration
+	}{{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}, {"ms", time.Millisecond}} {
+		if d%u.size == 0 {
+			return strconv.FormatInt(int64(d/u.size), 10) + u.name
+		}
+	}
+	if d%time.Microsecond == 0 {
+		return strconv.FormatInt(int64(d/time.Microsecond), 10) + "microseconds"
+	}
+	return strconv.FormatInt(int64(d/(100*time.Nanosecond)), 10) + "ticks"
+}
+
+func jsCanonicalizeAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	out, err := canonicalAPL(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("canonical", out)
+	return result
+}
@@ -0,0 +1,233 @@
+//go:build js && wasm
+
+package main
+
+// The kirby grammar accepts any identifier in call position and leaves name
+// resolution to the planner, so the editor-facing features keep their own
+// catalog of what APL ships. Keep it sorted within each group.
+
+// aplTabularOperators are the operators valid after a pipe.
+var aplTabularOperators = []string{
+	"count",
+	"distinct",
+	"extend",
+	"extend-valid",
+	"getschema",
+	"join",
+	"limit",
+	"lookup",
+	"make-series",
+	"mv-expand",
+	"order",
+	"parse",
+	"parse-kv",
+	"project",
+	"project-away",
+	"project-keep",
+	"project-rename",
+	"project-reorder",
+	"redact",
+	"sample",
+	"search",
+	"sort",
+	"summarize",
+	"take",
+	"top",
+	"union",
+	"where",
+}
+
+// aplKeywords are reserved words that are not tabular operators.
+var aplKeywords = []string{
+	"and",
+	"asc",
+	"between",
+	"by",
+	"contains",
+	"desc",
+	"endswith",
+	"false",
+	"has",
+	"in",
+	"kind",
+	"let",
+	"matches",
+	"not",
+	"nulls",
+	"on",
+	"or",
+	"regex",
+	"set",
+	"startswith",
+	"true",
+	"with",
+}
+
+// aplTopLevelKeywords start a statement.
+var aplTopLevelKeywords = []string{
+	"datatable",
+	"let",
+	"print",
+	"range",
+	"set",
+	"union",
+}
+
+type aplFunction struct {
+	Name        string
+	Aggregation bool
+	MinArgs     int
+	MaxArgs     int // variadicArgs when there is no upper bound
+}
+
+const variadicArgs = -1
+
+var aplFunctions = []aplFunction{
+	// Aggregations.
+	{Name: "arg_max", Aggregation: true, MinArgs: 2, MaxArgs: variadicArgs},
+	{Name: "arg_min", Aggregation: true, MinArgs: 2, MaxArgs: variadicArgs},
+	{Name: "avg", Aggregation: true, MinArgs: 1, MaxArgs: 1},
+	{Name: "avgif", Aggregation: true, MinArgs: 2, MaxArgs: 2},
+	{Name: "count", Aggregation: true, MinArgs: 0, MaxArgs: 1},
+	{Name: "countif", Aggregation: true, MinArgs: 1, MaxArgs: 1},
+	{Name: "dcount", Aggregation: true, MinArgs: 1, MaxArgs: 2},
+	{Name: "dcountif", Aggregation: true, MinArgs: 2, MaxArgs: 3},
+	{Name: "histogram", Aggregation: true, MinArgs: 2, MaxArgs: 2},
+	{Name: "make_bag", Aggregation: true, MinArgs: 1, MaxArgs: 2},
+	{Name: "make_list", Aggregation: true, MinArgs: 1, MaxArgs: 2},
+	{Name: "make_set", Aggregation: true, MinArgs: 1, MaxArgs: 2},
+	{Name: "max", Aggregation: true, MinArgs: 1, MaxArgs: 1},
+	{Name: "maxif", Aggregation: true, MinArgs: 2, MaxArgs: 2},
+	{Name: "min", Aggregation: true, MinArgs: 1, MaxArgs: 1},
+	{Name: "minif", Aggregation: true, MinArgs: 2, MaxArgs: 2},
+	{Name: "percentile", Aggregation: true, MinArgs: 2, MaxArgs: 2},
+	{Name: "percentiles_array", Aggregation: true, MinArgs: 2, MaxArgs: variadicArgs},
+	{Name: "rate", Aggregation: true, MinArgs: 1, MaxArgs: 2},
+	{Name: "stdev", Aggregation: true, MinArgs: 1, MaxArgs: 1},
+	{Name: "sum", Aggregation: true, MinArgs: 1, MaxArgs: 1},
+	{Name: "sumif", Aggregation: true, MinArgs: 2, MaxArgs: 2},
+	{Name: "topk", Aggregation: true, MinArgs: 2, MaxArgs: 2},
+	{Name: "variance", Aggregation: true, MinArgs: 1, MaxArgs: 1},
+
+	// Scalar functions.
+	{Name: "ago", MinArgs: 1, MaxArgs: 1},
+	{Name: "bin", MinArgs: 2, MaxArgs: 2},
+	{Name: "bin_auto", MinArgs: 1, MaxArgs: 1},
+	{Name: "case", MinArgs: 3, MaxArgs: variadicArgs},
+	{Name: "coalesce", MinArgs: 2, MaxArgs: variadicArgs},
+	{Name: "datetime", MinArgs: 1, MaxArgs: 1},
+	{Name: "extract", MinArgs: 3, MaxArgs: 4},
+	{Name: "format_datetime", MinArgs: 2, MaxArgs: 2},
+	{Name: "iff", MinArgs: 3, MaxArgs: 3},
+	{Name: "indexof", MinArgs: 2, MaxArgs: 5},
+	{Name: "isempty", MinArgs: 1, MaxArgs: 1},
+	{Name: "isnotempty", MinArgs: 1, MaxArgs: 1},
+	{Name: "isnotnull", MinArgs: 1, MaxArgs: 1},
+	{Name: "isnull", MinArgs: 1, MaxArgs: 1},
+	{Name: "now", MinArgs: 0, MaxArgs: 1},
+	{Name: "parse_json", MinArgs: 1, MaxArgs: 1},
+	{Name: "parse_url", MinArgs: 1, MaxArgs: 1},
+	{Name: "replace_regex", MinArgs: 3, MaxArgs: 3},
+	{Name: "round", MinArgs: 1, MaxArgs: 2},
+	{Name: "split", MinArgs: 2, MaxArgs: 3},
+	{Name: "strcat", MinArgs: 1, MaxArgs: variadicArgs},
+	{Name: "strlen", MinArgs: 1, MaxArgs: 1},
+	{Name: "substring", MinArgs: 2, MaxArgs: 3},
+	{Name: "tolower", MinArgs: 1, MaxArgs: 1},
+	{Name: "tostring", MinArgs: 1, MaxArgs: 1},
+	{Name: "toupper", MinArgs: 1, MaxArgs: 1},
+	{Name: "trim", MinArgs: 2, MaxArgs: 2},
+}
+
+// aplReserved holds every word that reads as a keyword in an editor.
+var aplReserved = func() map[string]bool {
+	words := make(map[string]bool)
+	for _, list := range [][]string{aplTabularOperators, aplKeywords, aplTopLevelKeywords} {
+		for _, w := range list {
+			words[w] = true
+		}
+	}
+	return words
+}()
+
+// aplDeprecated maps functions that still parse but are on their way out to
+// their replacements. Validation warns on them; add new entries here.
+var aplDeprecated = map[string]string{
+	"make_dictionary": "make_bag",
+	"makelist":        "make_list",
+	"makeset":         "make_set",
+}
+
+// aplNondeterministic holds the functions, and the tabular operators, whose
+// result can change between two runs of the same query, making it unfit
+// for caching. Add new entries here.
+var aplNondeterministic = map[string]bool{
+	"ago":             true,
+	"new_guid":        true,
+	"now":             true,
+	"rand":            true,
+	"sample":          true,
+	"sample-distinct": true,
+}
+
+type aplFunctionDoc struct {
+	Signature   string
+	Description string
+}
+
+// aplFunctionDocs is what hover and signature help show for each entry in
+// aplFunctions. Parameters in brackets are optional.
+var aplFunctionDocs = map[string]aplFunctionDoc{
+	"arg_max":           {"arg_max(expr, column, ...)", "Returns the named columns of the row where expr is largest; * selects every column."},
+	"arg_min":           {"arg_min(expr, column, ...)", "Returns the named columns of the row where expr is smallest; * selects every column."},
+	"avg":               {"avg(expr)", "Average of expr across the group."},
+	"avgif":             {"avgif(expr, predicate)", "Average of expr over the rows where predicate is true."},
+	"count":             {"count([expr])", "Number of rows in the group."},
+	"countif":           {"countif(predicate)", "Number of rows where predicate is true."},
+	"dcount":            {"dcount(expr[, accuracy])", "Estimated number of distinct values of expr."},
+	"dcountif":          {"dcountif(expr, predicate[, accuracy])", "Estimated number of distinct values of expr over the rows where predicate is true."},
+	"histogram":         {"histogram(expr, buckets)", "Distribution of expr across the given number of buckets."},
+	"make_bag":          {"make_bag(expr[, maxSize])", "Merges the dynamic values of expr into one property bag."},
+	"make_list":         {"make_list(expr[, maxSize])", "Array of every value of expr in the group."},
+	"make_set":          {"make_set(expr[, maxSize])", "Array of the distinct values of expr in the group."},
+	"max":               {"max(expr)", "Largest value of expr in the group."},
+	"maxif":             {"maxif(expr, predicate)", "Largest value of expr over the rows where predicate is true."},
+	"min":               {"min(expr)", "Smallest value of expr in the group."},
+	"minif":             {"minif(expr, predicate)", "Smallest value of expr over the rows where predicate is true."},
+	"percentile":        {"percentile(expr, percentile)", "Estimated value of expr at the given percentile."},
+	"percentiles_array": {"percentiles_array(expr, percentile, ...)", "Estimated values of expr at each given percentile, as an array."},
+	"rate":              {"rate(expr[, interval])", "Rate of change of expr per interval, by default per second."},
+	"stdev":             {"stdev(expr)", "Sample standard deviation of expr in the group."},
+	"sum":               {"sum(expr)", "Sum of expr across the group."},
+	"sumif":             {"sumif(expr, predicate)", "Sum of expr over the rows where predicate is true."},
+	"topk":              {"topk(expr, k)", "The k most frequent values of expr, with their estimated counts."},
+	"variance":          {"variance(expr)", "Sample variance of expr in the group."},
+
+	"ago":             {"ago(timespan)", "The current time minus timespan."},
+	"bin":             {"bin(value, size)", "Rounds value down to a multiple of size."},
+	"bin_auto":        {"bin_auto(expr)", "Rounds expr down into bins sized for the query's time range."},
+	"case":            {"case(predicate, then, ..., else)", "The value paired with the first true predicate, or else."},
+	"coalesce":        {"coalesce(expr, expr, ...)", "The first argument that isn't null or empty."},
+	"datetime":        {"datetime(value)", "Parses value as a datetime."},
+	"extract":         {"extract(regex, group, source[, type])", "The given capture group of regex matched against source."},
+	"format_datetime": {"format_datetime(datetime, format)", "Formats datetime as a string using format."},
+	"iff":             {"iff(predicate, then, else)", "then if predicate is true, else otherwise."},
+	"indexof":         {"indexof(source, lookup[, start[, length[, occurrence]]])", "Position of lookup in source, or -1 when absent."},
+	"isempty":         {"isempty(value)", "Whether value is null or an empty string."},
+	"isnotempty":      {"isnotempty(value)", "Whether value is neither null nor an empty string."},
+	"isnotnull":       {"isnotnull(value)", "Whether value isn't null."},
+	"isnull":          {"isnull(value)", "Whether value is null."},
+	"now":             {"now([offset])", "The current time, shifted by offset."},
+	"parse_json":      {"parse_json(json)", "Parses a JSON string into a dynamic value."},
+	"parse_url":       {"parse_url(url)", "Splits url into its parts as a property bag."},
+	"replace_regex":   {"replace_regex(regex, rewrite, source)", "Replaces every match of regex in source with rewrite."},
+	"round":           {"round(number[, precision])", "Rounds number to the given number of decimal places."},
+	"split":           {"split(source, delimiter[, index])", "Splits source on delimiter into an array, or returns the element at index."},
+	"strcat":          {"strcat(value, ...)", "Concatenates its arguments as strings."},
+	"strlen":          {"strlen(source)", "Length of source in characters."},
+	"substring":       {"substring(source, start[, length])", "Part of source from start, optionally limited to length characters."},
+	"tolower":         {"tolower(source)", "source in lower case."},
+	"tostring":        {"tostring(value)", "value converted to a string."},
+	"toupper":         {"toupper(source)", "source in upper case."},
+	"trim":            {"trim(regex, source)", "source with leading and trailing matches of regex removed."},
+}
@@ -0,0 +1,83 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// stageCategories maps the operators that decide a classification to their
+// category. Filters, projections and the rest don't decide anything: a
+// query made only of them is a search.
+var stageCategories = map[string]string{
+	"join":        "join",
+	"lookup":      "join",
+	"union":       "join",
+	"make-series": "metrics",
+	"count":       "aggregate",
+	"distinct":    "aggregate",
+	"summarize":   "aggregate",
+	"top":         "aggregate",
+}
+
+// categoryOrder ranks the categories, so a join followed by a summarize is
+// a join.
+var categoryOrder = []string{"join", "metrics", "aggregate"}
+
+// classifyAPL puts the last statement of src in one category by the highest
+// ranked of the deciding operators it uses, "search" if it uses none. The
+// confidence is 1 when every deciding operator agrees with the category,
+// 0.5 when some point elsewhere.
+func classifyAPL(src string) (category string, confidence float64, err error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return "", 0, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return "", 0, err
+	}
+
+	stages, _ := lastPipeline(significant(toks))
+	counts := make(map[string]int)
+	deciding := 0
+	for _, stage := range stages[1:] {
+		op, _ := stageOperator(stage)
+		if c, ok := stageCategories[op]; ok {
+			counts[c]++
+			deciding++
+		}
+	}
+	for _, c := range categoryOrder {
+		if counts[c] == 0 {
+			continue
+		}
+		if counts[c] < deciding {
+			return c, 0.5, nil
+		}
+		return c, 1, nil
+	}
+	return "search", 1, nil
+}
+
+// jsClassifyAPL returns {valid, category, confidence}, category being one
+// of "search", "aggregate", "join" or "metrics".
+func jsClassifyAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	category, confidence, err := classifyAPL(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("category", category)
+	result.Set("confidence", confidence)
+	return result
+}
@@ -0,0 +1,53 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"syscall/js"
+)
+
+// stripComments removes every comment from src and leaves all other text
+// untouched, so the result parses to the same tree. A comment wedged between
+// two tokens with no other whitespace becomes a single space to keep them
+// apart. Line breaks after line comments are whitespace tokens and survive.
+// The text between comments is copied from src rather than rebuilt from
+// tokens, which leave out a BOM and the \r of a \r\n.
+func stripComments(src string) (string, error) {
+	toks, err := lexAPL(src)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.Grow(len(src))
+	from := 0
+	for i, tok := range toks {
+		if symbolOf(tok) != symComment {
+			continue
+		}
+		sb.WriteString(src[from:tok.Pos.Offset])
+		from = tok.Pos.Offset + len(tok.Value)
+		spaced := i == 0 || i == len(toks)-1 ||
+			symbolOf(toks[i-1]) == symWhitespace || symbolOf(toks[i+1]) == symWhitespace
+		if !spaced {
+			sb.WriteString(" ")
+		}
+	}
+	sb.WriteString(src[from:])
+	return sb.String(), nil
+}
+
+func jsStripCommentsAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	text, err := stripComments(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("text", text)
+	return result
+}
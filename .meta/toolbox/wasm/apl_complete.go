@@ -0,0 +1,170 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+type completion struct {
+	Label string
+	Kind  string // "function", "operator" or "keyword"
+}
+
+// completeAPL returns the candidates valid at byte offset in src. The context
+// comes from the significant tokens before the cursor; a word the cursor is
+// touching is treated as the prefix being typed and filters the candidates.
+func completeAPL(src string, offset int) []completion {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(src) {
+		offset = len(src)
+	}
+
+	toks, err := lexAPL(src[:offset])
+	if err != nil {
+		return keywordCompletions(aplTopLevelKeywords, "")
+	}
+	toks = significant(toks)
+
+	partial := ""
+	wordStart := offset
+	if n := len(toks); n > 0 {
+		last := toks[n-1]
+		if symbolOf(last) == symIdent && last.Pos.Offset+len(last.Value) == offset {
+			partial = last.Value
+			wordStart = last.Pos.Offset
+			toks = toks[:n-1]
+		}
+	}
+
+	// An error past the cursor is just the query being incomplete; one before
+	// it means the context below can't be trusted.
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		if pos, ok := positionOf(err); ok && pos.Offset < wordStart {
+			return keywordCompletions(aplTopLevelKeywords, partial)
+		}
+	}
+
+	if len(toks) == 0 {
+		return keywordCompletions(aplTopLevelKeywords, partial)
+	}
+
+	ctx := completionContextOf(toks)
+	last := toks[len(toks)-1]
+	switch {
+	case isPunct(last, "|"):
+		return operatorCompletions(partial)
+	case isPunct(last, "(") || isPunct(last, ",") || isExpressionOperator(last):
+		return functionCompletions(ctx.aggregating, partial)
+	case last.Value == "by" && ctx.stage == "summarize":
+		return functionCompletions(false, partial)
+	case symbolOf(last) == symIdent && len(toks) >= 2 && isPunct(toks[len(toks)-2], "|"):
+		// Directly after a tabular operator name.
+		return functionCompletions(ctx.aggregating, partial)
+	default:
+		return keywordCompletions(aplKeywords, partial)
+	}
+}
+
+type completionContext struct {
+	stage       string // tabular operator of the current pipeline stage
+	aggregating bool   // inside summarize, before its by clause
+}
+
+func completionContextOf(toks []lexer.Token) completionContext {
+	var ctx completionContext
+	depth := 0
+	for i, tok := range toks {
+		switch {
+		case isPunct(tok, "("):
+			depth++
+		case isPunct(tok, ")"):
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && isPunct(tok, "|"):
+			ctx = completionContext{}
+			if i+1 < len(toks) {
+				ctx.stage = toks[i+1].Value
+				ctx.aggregating = ctx.stage == "summarize"
+			}
+		case depth == 0 && tok.Value == "by" && symbolOf(tok) == symIdent:
+			ctx.aggregating = false
+		}
+	}
+	return ctx
+}
+
+// isPunct reports whether tok is the punctuation value, as opposed to a
+// string literal that happens to contain it.
+func isPunct(tok lexer.Token, value string) bool {
+	return tok.Value == value && symbolOf(tok) == symOperator
+}
+
+func isExpressionOperator(tok lexer.Token) bool {
+	switch tok.Value {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~", "=", "+", "-", "*", "/", "%":
+		return symbolOf(tok) == symOperator
+	case "and", "or", "not", "in", "has", "contains", "startswith", "endswith":
+		return symbolOf(tok) == symIdent
+	}
+	return false
+}
+
+func operatorCompletions(partial string) []completion {
+	var out []completion
+	for _, name := range aplTabularOperators {
+		if strings.HasPrefix(name, partial) {
+			out = append(out, completion{Label: name, Kind: "operator"})
+		}
+	}
+	return out
+}
+
+func keywordCompletions(keywords []string, partial string) []completion {
+	var out []completion
+	for _, name := range keywords {
+		if strings.HasPrefix(name, partial) {
+			out = append(out, completion{Label: name, Kind: "keyword"})
+		}
+	}
+	return out
+}
+
+func functionCompletions(aggregations bool, partial string) []completion {
+	var out []completion
+	for _, fn := range aplFunctions {
+		if fn.Aggregation != aggregations {
+			continue
+		}
+		if strings.HasPrefix(fn.Name, partial) {
+			out = append(out, completion{Label: fn.Name, Kind: "function"})
+		}
+	}
+	return out
+}
+
+func jsCompleteAPL(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeNumber {
+		return invalidArgs("expected a string and a number argument")
+	}
+
+	completions := completeAPL(args[0].String(), args[1].Int())
+	result := js.Global().Get("Array").New()
+	for i, c := range completions {
+		item := js.Global().Get("Object").New()
+		item.Set("label", c.Label)
+		item.Set("kind", c.Kind)
+		result.SetIndex(i, item)
+	}
+	return result
+}
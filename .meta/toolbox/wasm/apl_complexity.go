@@ -0,0 +1,98 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// Complexity weights. They're relative costs, not time estimates: a join
+// rereads a second dataset, a regex runs per row, an aggregation holds
+// state per group, and every stage adds a pass.
+const (
+	weightStage       = 1
+	weightJoin        = 10
+	weightRegexFilter = 5
+	weightAggregation = 3
+)
+
+// regexFunctions are the scalar functions that evaluate a regex per row.
+var regexFunctions = map[string]bool{
+	"extract":       true,
+	"extract_all":   true,
+	"replace_regex": true,
+}
+
+type complexity struct {
+	Stages       int
+	Joins        int
+	RegexFilters int
+	Aggregations int
+}
+
+func (c complexity) Score() int {
+	return c.Stages*weightStage + c.Joins*weightJoin + c.RegexFilters*weightRegexFilter + c.Aggregations*weightAggregation
+}
+
+// estimateComplexity counts the costly constructs in src, subqueries
+// included. It's a heuristic over the token stream, not a query plan.
+func estimateComplexity(src string) (complexity, error) {
+	var c complexity
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return c, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return c, err
+	}
+	toks = significant(toks)
+
+	if len(toks) > 0 {
+		c.Stages = 1
+	}
+	for i, tok := range toks {
+		afterPipe := i > 0 && isPunct(toks[i-1], "|")
+		switch {
+		case isPunct(tok, "|"):
+			c.Stages++
+		case isPunct(tok, ";") && i+1 < len(toks):
+			c.Stages++
+		case symbolOf(tok) != symIdent:
+		case afterPipe && (tok.Value == "join" || tok.Value == "lookup"):
+			c.Joins++
+		case afterPipe && tok.Value == "summarize":
+			c.Aggregations++
+		case tok.Value == "regex":
+			c.RegexFilters++
+		case regexFunctions[tok.Value] && i+1 < len(toks) && isPunct(toks[i+1], "("):
+			c.RegexFilters++
+		}
+	}
+	return c, nil
+}
+
+func jsEstimateComplexityAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	c, err := estimateComplexity(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	factors := js.Global().Get("Object").New()
+	factors.Set("stages", c.Stages)
+	factors.Set("joins", c.Joins)
+	factors.Set("regexFilters", c.RegexFilters)
+	factors.Set("aggregations", c.Aggregations)
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("score", c.Score())
+	result.Set("factors", factors)
+	return result
+}
@@ -0,0 +1,154 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"slices"
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// tabularSources are the operators whose parenthesised or listed arguments
+// are tabular expressions in their own right.
+var tabularSources = map[string]bool{
+	"join":   true,
+	"lookup": true,
+	"union":  true,
+}
+
+// extractDatasets returns the datasets src reads from, in order of first
+// appearance. Names bound with let are not datasets and are skipped.
+func extractDatasets(src string) ([]string, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, err
+	}
+	toks = significant(toks)
+
+	var (
+		datasets []string
+		seen     = map[string]bool{}
+		bound    = map[string]bool{}
+	)
+	add := func(name string) {
+		if name == "" || bound[name] || seen[name] {
+			return
+		}
+		seen[name] = true
+		datasets = append(datasets, name)
+	}
+
+	// stages[depth] is the tabular operator in effect at each paren depth.
+	stages := []string{""}
+	for i, tok := range toks {
+		depth := len(stages) - 1
+		switch {
+		case isPunct(tok, "("):
+			stages = append(stages, "")
+		case isPunct(tok, ")"):
+			if depth > 0 {
+				stages = stages[:depth]
+			}
+		case isPunct(tok, "|") || isPunct(tok, ";"):
+			stages[depth] = ""
+			if i+1 < len(toks) && isPunct(tok, "|") {
+				stages[depth] = toks[i+1].Value
+			}
+		case tok.Value == "union" && symbolOf(tok) == symIdent:
+			stages[depth] = "union"
+		case tok.Value == "let" && symbolOf(tok) == symIdent && i+1 < len(toks):
+			bound[toks[i+1].Value] = true
+		}
+		if startsTabular(toks, i, stages) {
+			add(datasetAt(toks, i))
+		}
+	}
+	return datasets, nil
+}
+
+// startsTabular reports whether toks[i] begins a tabular expression: the
+// start of a statement, the right-hand side of a let, or an argument of a
+// tabular source operator.
+func startsTabular(toks []lexer.Token, i int, stages []string) bool {
+	if i == 0 {
+		return true
+	}
+	prev := toks[i-1]
+	switch {
+	case isPunct(prev, ";"):
+		return true
+	case isPunct(prev, "=") && i >= 3 && toks[i-3].Value == "let":
+		return letsTabular(toks, i)
+	case isPunct(prev, "("):
+		// stages already includes the paren just opened.
+		if len(stages) < 2 {
+			return false
+		}
+		outer := stages[len(stages)-2]
+		if tabularSources[outer] {
+			return true
+		}
+		return i >= 2 && (toks[i-2].Value == "in" || toks[i-2].Value == "!in")
+	case prev.Value == "union" && symbolOf(prev) == symIdent:
+		return true
+	case isPunct(prev, ","):
+		return stages[len(stages)-1] == "union"
+	}
+	return false
+}
+
+// letsTabular reports whether the right-hand side of a let starting at
+// toks[i] is tabular: a dataset on its own or at the head of a pipe.
+// Anything else, such as let n = x + 1, binds a scalar.
+func letsTabular(toks []lexer.Token, i int) bool {
+	end := i + 1
+	if isPunct(toks[i], "[") {
+		end = i + 3
+	}
+	return end >= len(toks) || isPunct(toks[end], "|") || isPunct(toks[end], ";")
+}
+
+// datasetAt returns the dataset named at toks[i], either a bare identifier or
+// the ['quoted'] form, or "" if the expression starts with something else.
+func datasetAt(toks []lexer.Token, i int) string {
+	tok := toks[i]
+	if isPunct(tok, "[") && i+2 < len(toks) && symbolOf(toks[i+1]) == symString && isPunct(toks[i+2], "]") {
+		return unquote(toks[i+1].Value)
+	}
+	if symbolOf(tok) != symIdent {
+		return ""
+	}
+	// A name followed by ( is a call, such as now() or toscalar(...).
+	if i+1 < len(toks) && isPunct(toks[i+1], "(") {
+		return ""
+	}
+	for _, list := range [][]string{aplTopLevelKeywords, aplKeywords} {
+		if slices.Contains(list, tok.Value) {
+			return ""
+		}
+	}
+	return tok.Value
+}
+
+func jsExtractDatasetsAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	datasets, err := extractDatasets(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("datasets", jsStrings(datasets))
+	return result
+}
@@ -0,0 +1,248 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// lintDeadStage flags the stages after a take or limit of 0, or a where
+// whose predicate folds to false, since those stages never see a row. A
+// stage that makes rows of its own ends the run: count and a summarize
+// without by return a row even for no input, and a union or a join keeping
+// unmatched right rows bring in another table's.
+func lintDeadStage(stages [][]lexer.Token) []lintFinding {
+	var (
+		findings []lintFinding
+		cause    string
+	)
+	for _, stage := range stages[1:] {
+		op, args := stageOperator(stage)
+		if cause != "" {
+			if makesRows(op, args) {
+				cause = ""
+			} else {
+				findings = append(findings, lintFinding{Message: "stage is unreachable, " + cause, Pos: stage[0].Pos})
+			}
+			continue
+		}
+		switch {
+		case (op == "take" || op == "limit") && len(args) == 1 && symbolOf(args[0]) == symNumber:
+			if v, ok := literalValue(args[0]); ok && v == 0.0 {
+				cause = fmt.Sprintf("%s 0 on line %d returns no rows", op, stage[0].Pos.Line)
+			}
+		case op == "where":
+			if v, known := foldPredicate(args); known && !v {
+				cause = fmt.Sprintf("the where on line %d is always false", stage[0].Pos.Line)
+			}
+		}
+	}
+	return findings
+}
+
+// makesRows reports whether the stage op args returns rows when it gets
+// none.
+func makesRows(op string, args []lexer.Token) bool {
+	switch op {
+	case "count", "union":
+		return true
+	case "summarize":
+		return len(splitKeyword(args, "by")) == 1
+	case "join":
+		switch joinKind(args) {
+		case "rightouter", "fullouter", "rightanti", "rightantisemi":
+			return true
+		}
+	}
+	return false
+}
+
+// joinKind returns the kind= parameter of a join's arguments, or "" when
+// it has none.
+func joinKind(args []lexer.Token) string {
+	for i := 0; i+2 < len(args) && !isPunct(args[i], "("); i++ {
+		if args[i].Value == "kind" && isPunct(args[i+1], "=") && symbolOf(args[i+2]) == symIdent {
+			return args[i+2].Value
+		}
+	}
+	return ""
+}
+
+// foldPredicate evaluates toks when only literals decide it: true, false,
+// comparisons of two numbers or two strings, not(), and and/or, where one
+// false conjunct or true disjunct is enough. known is false for anything
+// that depends on the data.
+func foldPredicate(toks []lexer.Token) (value, known bool) {
+	for len(toks) >= 2 && isPunct(toks[0], "(") && matchingClose(toks, 0) == len(toks)-1 {
+		toks = toks[1 : len(toks)-1]
+	}
+	if parts := splitKeyword(toks, "or"); len(parts) > 1 {
+		return foldAll(parts, true)
+	}
+	if parts := splitKeyword(toks, "and"); len(parts) > 1 {
+		return foldAll(parts, false)
+	}
+	switch {
+	case len(toks) == 0:
+		return false, false
+	case len(toks) == 1:
+		v, ok := literalValue(toks[0])
+		b, isBool := v.(bool)
+		return b, ok && isBool
+	case toks[0].Value == "not" && isCall(toks, 0):
+		if _, closeIdx := callArgs(toks, 0); closeIdx == len(toks)-1 {
+			v, known := foldPredicate(toks[2:closeIdx])
+			return !v, known
+		}
+	case len(toks) == 3 && symbolOf(toks[1]) == symOperator:
+		return foldComparison(toks[0], toks[1].Value, toks[2])
+	}
+	return false, false
+}
+
+// foldAll folds the parts of an or when decisive is true, of an and when it
+// is false: any part folding to decisive decides the whole, otherwise
+// every part must be known.
+func foldAll(parts [][]lexer.Token, decisive bool) (value, known bool) {
+	known = true
+	for _, part := range parts {
+		v, k := foldPredicate(part)
+		if k && v == decisive {
+			return decisive, true
+		}
+		known = known && k
+	}
+	return !decisive, known
+}
+
+func foldComparison(a lexer.Token, op string, b lexer.Token) (value, known bool) {
+	x, okA := literalValue(a)
+	y, okB := literalValue(b)
+	if !okA || !okB {
+		return false, false
+	}
+	var order int
+	switch x := x.(type) {
+	case float64:
+		y, ok := y.(float64)
+		if !ok {
+			return false, false
+		}
+		order = cmp.Compare(x, y)
+	case string:
+		y, ok := y.(string)
+		if !ok {
+			return false, false
+		}
+		order = cmp.Compare(x, y)
+	default:
+		return false, false
+	}
+	switch op {
+	case "==":
+		return order == 0, true
+	case "!=":
+		return order != 0, true
+	case "<":
+		return order < 0, true
+	case "<=":
+		return order <= 0, true
+	case ">":
+		return order > 0, true
+	case ">=":
+		return order >= 0, true
+	}
+	return false, false
+}
+
+// splitKeyword splits toks on the word outside any brackets.
+func splitKeyword(toks []lexer.Token, word string) [][]lexer.Token {
+	var (
+		out   [][]lexer.Token
+		cur   []lexer.Token
+		depth int
+	)
+	for _, tok := range toks {
+		switch {
+		case isPunct(tok, "(") || isPunct(tok, "["):
+			depth++
+		case (isPunct(tok, ")") || isPunct(tok, "]")) && depth > 0:
+			depth--
+		case depth == 0 && symbolOf(tok) == symIdent && tok.Value == word:
+			out = append(out, cur)
+			cur = nil
+			continue
+		}
+		cur = append(cur, tok)
+	}
+	return append(out, cur)
+}
+
+// matchingClose returns the index of the bracket closing the one at
+// toks[open], or -1 if it is never closed.
+func matchingClose(toks []lexer.Token, open int) int {
+	depth := 0
+	for i := open; i < len(toks); i++ {
+		switch {
+		case isPunct(toks[i], "(") || isPunct(toks[i], "["):
+			depth++
+		case isPunct(toks[i], ")") || isPunct(toks[i], "]"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// deadStages runs lintDeadStage over each top-level pipeline of src.
+func deadStages(src string) ([]lintFinding, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []lintFinding
+	for _, stages := range splitPipelines(significant(toks)) {
+		findings = append(findings, lintDeadStage(stages)...)
+	}
+	return findings, nil
+}
+
+// jsDeadStageCheckAPL returns {valid, diagnostics}, each diagnostic being
+// {message, line, column} at a stage no row reaches. LintAPL reports the
+// same under the rule "dead-stage".
+func jsDeadStageCheckAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	findings, err := deadStages(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	arr := js.Global().Get("Array").New()
+	for i, f := range findings {
+		obj := js.Global().Get("Object").New()
+		obj.Set("message", f.Message)
+		obj.Set("line", f.Pos.Line)
+		obj.Set("column", f.Pos.Column)
+		arr.SetIndex(i, obj)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("diagnostics", arr)
+	return result
+}
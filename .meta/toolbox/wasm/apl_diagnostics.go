@@ -0,0 +1,171 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+type diagnostic struct {
+	Message string
+	Code    string
+	Pos     errorPos
+	HasPos  bool
+}
+
+// errorMessage is err without the file:line:col prefix, which callers get
+// as separate fields.
+func errorMessage(err error) string {
+	return validate.APLError(err).Message
+}
+
+// maxDiagnostics bounds the errors diagnoseAPL reports. Each one costs a
+// parse of the whole source, so a query of many broken stages would
+// otherwise take time quadratic in its length.
+const maxDiagnostics = 100
+
+// diagnoseAPL reports every parse error it can find in src, up to
+// maxDiagnostics. The parser stops at the first error, so after each one
+// the broken pipeline stage is blanked out and the rest is parsed again.
+// Blanking keeps line breaks, so later positions still point into the
+// original text. A broken first stage takes the rest of its statement with
+// it, since the stages after it have no input to fail against.
+func diagnoseAPL(src string) []diagnostic {
+	diags, _, _ := recoverAPL(src)
+	return diags
+}
+
+// blankedRange is a byte range diagnoseAPL blanked out for the error at
+// Diag.
+type blankedRange struct {
+	Start, End int
+	Diag       int
+}
+
+// recoverAPL is diagnoseAPL that also returns the tree parsed from what was
+// left, which is nil if recovery gave up first, and the ranges it blanked.
+// Positions in the tree point into src.
+func recoverAPL(src string) ([]diagnostic, *ast.Doc, []blankedRange) {
+	toks, err := lexAPL(src)
+	if err != nil {
+		pos, ok := positionOf(err)
+		return []diagnostic{{Message: errorMessage(err), Code: validate.APLError(err).Code, Pos: pos, HasPos: ok}}, nil, nil
+	}
+	bounds := stageBoundaries(significant(toks))
+
+	masked := []byte(src)
+	var (
+		diags   []diagnostic
+		blanked []blankedRange
+	)
+	lastOffset := -1
+	for {
+		var doc ast.Doc
+		err := validate.ParseAPL(string(masked), &doc)
+		if err == nil {
+			return diags, &doc, blanked
+		}
+		pos, ok := positionOf(err)
+		if ok && pos.Offset <= lastOffset {
+			return diags, nil, blanked
+		}
+		diags = append(diags, diagnostic{Message: errorMessage(err), Code: validate.APLError(err).Code, Pos: pos, HasPos: ok})
+		if !ok || len(diags) == maxDiagnostics {
+			return diags, nil, blanked
+		}
+		lastOffset = pos.Offset
+
+		start, end := brokenStage(bounds, pos.Offset, len(src))
+		blanked = append(blanked, blankedRange{Start: start, End: end, Diag: len(diags) - 1})
+		for i := start; i < end; i++ {
+			if masked[i] != '\n' {
+				masked[i] = ' '
+			}
+		}
+	}
+}
+
+type stageBoundary struct {
+	Offset    int
+	Statement bool // ';' rather than '|'
+}
+
+// stageBoundaries returns the top-level pipes and semicolons in toks.
+func stageBoundaries(toks []lexer.Token) []stageBoundary {
+	var bounds []stageBoundary
+	depth := 0
+	for _, tok := range toks {
+		switch {
+		case isPunct(tok, "(") || isPunct(tok, "["):
+			depth++
+		case (isPunct(tok, ")") || isPunct(tok, "]")) && depth > 0:
+			depth--
+		case depth == 0 && isPunct(tok, "|"):
+			bounds = append(bounds, stageBoundary{Offset: tok.Pos.Offset})
+		case depth == 0 && isPunct(tok, ";"):
+			bounds = append(bounds, stageBoundary{Offset: tok.Pos.Offset, Statement: true})
+		}
+	}
+	return bounds
+}
+
+// brokenStage returns the byte range to blank for an error at offset. An
+// error reported on a pipe belongs to the stage before it. A whole statement
+// is blanked along with its semicolon so no empty statement is left behind.
+func brokenStage(bounds []stageBoundary, offset, size int) (int, int) {
+	start, first := 0, true
+	end := size
+	for _, b := range bounds {
+		if b.Offset < offset {
+			start, first = b.Offset, b.Statement
+			if b.Statement {
+				start++
+			}
+			continue
+		}
+		if first && !b.Statement {
+			continue
+		}
+		end = b.Offset
+		if first {
+			end++
+		}
+		break
+	}
+	return start, end
+}
+
+func jsValidateAPLAll(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	return diagnosticsResult(diagnoseAPL(args[0].String()))
+}
+
+// diagnosticsResult is the {valid, errors} object for diags.
+func diagnosticsResult(diags []diagnostic) js.Value {
+	errs := js.Global().Get("Array").New()
+	for i, d := range diags {
+		obj := js.Global().Get("Object").New()
+		obj.Set("message", d.Message)
+		obj.Set("code", d.Code)
+		if d.HasPos {
+			obj.Set("line", d.Pos.Line)
+			obj.Set("column", d.Pos.Column)
+		} else {
+			obj.Set("line", js.Null())
+			obj.Set("column", js.Null())
+		}
+		errs.SetIndex(i, obj)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", len(diags) == 0)
+	result.Set("errors", errs)
+	return result
+}
@@ -0,0 +1,215 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+const (
+	changeAdded    = "added"
+	changeRemoved  = "removed"
+	changeModified = "modified"
+)
+
+// astChange is one difference between two ASTs. Path names the node the
+// way it's reached from the root, e.g. "Statements[0].Stages[2]", with the
+// index on the side the node exists on (b for added and modified). Before
+// and After are the node's source text, "" on the side it's missing from.
+type astChange struct {
+	Path   string
+	Kind   string
+	Before string
+	After  string
+}
+
+// diffAPL compares the ASTs of a and b. Spans never take part, so layout
+// and comments don't show up. side is "a" or "b" when that one didn't
+// parse.
+func diffAPL(a, b string) (changes []astChange, side string, err error) {
+	var docA, docB ast.Doc
+	if err := validate.ParseAPL(a, &docA); err != nil {
+		return nil, "a", err
+	}
+	if err := validate.ParseAPL(b, &docB); err != nil {
+		return nil, "b", err
+	}
+	d := &astDiffer{a: a, b: b}
+	d.node("", toASTNode(reflect.ValueOf(&docA).Elem()), toASTNode(reflect.ValueOf(&docB).Elem()))
+	return d.changes, "", nil
+}
+
+type astDiffer struct {
+	a, b    string
+	changes []astChange
+}
+
+// node compares two nodes found at the same path. A node whose type or
+// attrs changed is reported whole rather than field by field.
+func (d *astDiffer) node(path string, x, y *astNode) {
+	if x.Type != y.Type || !reflect.DeepEqual(x.Attrs, y.Attrs) {
+		d.add(path, changeModified, x, y)
+		return
+	}
+	var fields []string
+	seen := map[string]bool{}
+	for _, c := range append(append([]*astNode(nil), x.Children...), y.Children...) {
+		if !seen[c.Field] {
+			seen[c.Field] = true
+			fields = append(fields, c.Field)
+		}
+	}
+	for _, f := range fields {
+		prefix := f
+		if path != "" {
+			prefix = path + "." + f
+		}
+		d.list(prefix, childrenIn(x, f), childrenIn(y, f))
+	}
+}
+
+// list aligns two runs of siblings on their longest common subsequence of
+// equal subtrees, so inserting a stage reports one addition instead of
+// every later stage as changed. Between matches, leftover nodes on both
+// sides are paired up as modifications.
+func (d *astDiffer) list(prefix string, xs, ys []*astNode) {
+	kx, ky := make([]string, len(xs)), make([]string, len(ys))
+	for i, n := range xs {
+		kx[i] = subtreeKey(n)
+	}
+	for j, n := range ys {
+		ky[j] = subtreeKey(n)
+	}
+	// lcs[i][j] is the common length of kx[i:] and ky[j:].
+	lcs := make([][]int, len(xs)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(ys)+1)
+	}
+	for i := len(xs) - 1; i >= 0; i-- {
+		for j := len(ys) - 1; j >= 0; j-- {
+			if kx[i] == ky[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	index := func(i int) string { return prefix + "[" + strconv.Itoa(i) + "]" }
+	var removed, added []int
+	flush := func() {
+		n := min(len(removed), len(added))
+		for k := 0; k < n; k++ {
+			d.node(index(added[k]), xs[removed[k]], ys[added[k]])
+		}
+		for _, i := range removed[n:] {
+			d.add(index(i), changeRemoved, xs[i], nil)
+		}
+		for _, j := range added[n:] {
+			d.add(index(j), changeAdded, nil, ys[j])
+		}
+		removed, added = removed[:0], added[:0]
+	}
+	i, j := 0, 0
+	for i < len(xs) || j < len(ys) {
+		switch {
+		case i < len(xs) && j < len(ys) && kx[i] == ky[j]:
+			flush()
+			i++
+			j++
+		case j == len(ys) || (i < len(xs) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	flush()
+}
+
+func (d *astDiffer) add(path, kind string, x, y *astNode) {
+	c := astChange{Path: path, Kind: kind}
+	if x != nil {
+		c.Before = spanText(d.a, x.Span)
+	}
+	if y != nil {
+		c.After = spanText(d.b, y.Span)
+	}
+	d.changes = append(d.changes, c)
+}
+
+func childrenIn(n *astNode, field string) []*astNode {
+	var out []*astNode
+	for _, c := range n.Children {
+		if c.Field == field {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// subtreeKey identifies a subtree by everything but its spans.
+func subtreeKey(n *astNode) string {
+	var sb strings.Builder
+	sb.WriteString(n.Type)
+	if len(n.Attrs) > 0 {
+		// Maps marshal with sorted keys, so equal attrs give equal text.
+		attrs, _ := json.Marshal(n.Attrs)
+		sb.Write(attrs)
+	}
+	sb.WriteString("{")
+	for _, c := range n.Children {
+		sb.WriteString(c.Field + ":" + subtreeKey(c) + ";")
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+func spanText(src string, span astSpan) string {
+	start, end := max(0, min(span.Start, len(src))), max(0, min(span.End, len(src)))
+	if end < start {
+		return ""
+	}
+	return strings.TrimSpace(src[start:end])
+}
+
+func jsDiffAPL(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeString {
+		return invalidArgs("expected 2 string arguments")
+	}
+
+	changes, side, err := diffAPL(args[0].String(), args[1].String())
+	if err != nil {
+		result := invalidQuery(err)
+		result.Set("side", side)
+		return result
+	}
+	arr := js.Global().Get("Array").New()
+	for i, c := range changes {
+		obj := js.Global().Get("Object").New()
+		obj.Set("path", c.Path)
+		obj.Set("kind", c.Kind)
+		obj.Set("before", js.Null())
+		obj.Set("after", js.Null())
+		if c.Kind != changeAdded {
+			obj.Set("before", c.Before)
+		}
+		if c.Kind != changeRemoved {
+			obj.Set("after", c.After)
+		}
+		arr.SetIndex(i, obj)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("changes", arr)
+	return result
+}
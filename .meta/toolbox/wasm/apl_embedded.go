@@ -0,0 +1,52 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"toolbox/validate"
+)
+
+// shiftPosition moves the line and column of obj from the snippet into the
+// host document the snippet starts at baseLine:baseColumn. Only the
+// snippet's first line starts mid-line, so only its columns move. A null
+// line leaves obj alone.
+func shiftPosition(obj js.Value, baseLine, baseColumn int) {
+	line := obj.Get("line")
+	if line.Type() != js.TypeNumber {
+		return
+	}
+	if line.Int() == 1 {
+		obj.Set("column", obj.Get("column").Int()+baseColumn-1)
+	}
+	obj.Set("line", line.Int()+baseLine-1)
+}
+
+// jsValidateAPLAt is ValidateAPL for a snippet that starts at baseLine and
+// baseColumn, both 1-based, of a larger document: the error's line and
+// column, and those of every warning and of unmatchedOpen, are the
+// document's. offset stays an offset into the snippet, since where the
+// snippet starts in bytes isn't known, and so does the position the parser
+// writes into the error text.
+func jsValidateAPLAt(this js.Value, args []js.Value) any {
+	if len(args) != 3 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeNumber || args[2].Type() != js.TypeNumber {
+		return invalidArgs("expected source, baseLine and baseColumn")
+	}
+	baseLine, baseColumn := args[1].Float(), args[2].Float()
+	if baseLine < 1 || baseColumn < 1 || baseLine != float64(int(baseLine)) || baseColumn != float64(int(baseColumn)) {
+		return invalidArgs("baseLine and baseColumn must be positive integers")
+	}
+
+	var p validate.APLParser
+	result := validateAPL(&p, args[0].String())
+	shiftPosition(result, int(baseLine), int(baseColumn))
+	warnings := result.Get("warnings")
+	for i := 0; i < warnings.Length(); i++ {
+		shiftPosition(warnings.Index(i), int(baseLine), int(baseColumn))
+	}
+	if open := result.Get("unmatchedOpen"); open.Type() == js.TypeObject {
+		shiftPosition(open, int(baseLine), int(baseColumn))
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// explainAPL describes each stage of the last statement in src, the source
+// first, in a short phrase such as "filter where status >= 500". Operators
+// it has no phrasing for are described by their own text.
+func explainAPL(src string) ([]string, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, err
+	}
+
+	stages, _ := lastPipeline(significant(toks))
+	explanation := make([]string, 0, len(stages))
+	explanation = append(explanation, "read "+tokenText(src, stages[0]))
+	for _, stage := range stages[1:] {
+		explanation = append(explanation, explainStage(src, stage))
+	}
+	return explanation, nil
+}
+
+func explainStage(src string, stage []lexer.Token) string {
+	op, args := stageOperator(stage)
+	text := func(toks []lexer.Token) string { return tokenText(src, toks) }
+	switch {
+	case op == "where" && len(args) > 0:
+		return "filter where " + text(args)
+	case op == "summarize" && len(args) > 0:
+		aggs, keys := splitSummarize(args)
+		what := "compute " + wordList(src, aggs)
+		if items := splitList(aggs); len(items) == 1 && len(items[0]) == 3 && isCall(items[0], 0) && items[0][0].Value == "count" {
+			what = "count"
+		}
+		if keys == nil {
+			return what
+		}
+		var by []string
+		for _, item := range splitList(keys) {
+			by = append(by, text(item))
+		}
+		return "group by " + strings.Join(by, ", ") + " and " + what
+	case (op == "sort" || op == "order") && len(args) > 1 && args[0].Value == "by":
+		var keys []string
+		for _, item := range splitList(args[1:]) {
+			if len(item) == 0 {
+				continue
+			}
+			dir := "descending"
+			if last := item[len(item)-1]; len(item) > 1 && (last.Value == "asc" || last.Value == "desc") {
+				if last.Value == "asc" {
+					dir = "ascending"
+				}
+				item = item[:len(item)-1]
+			}
+			keys = append(keys, dir+" by "+text(item))
+		}
+		return "sort " + strings.Join(keys, ", then ")
+	case (op == "take" || op == "limit") && len(args) > 0:
+		return "take " + text(args)
+	case op == "top" && len(args) > 0:
+		return "take the top " + text(args)
+	case op == "count" && len(args) == 0:
+		return "count the rows"
+	case op == "project" && len(args) > 0:
+		return "keep " + wordList(src, args)
+	case op == "project-away" && len(args) > 0:
+		return "drop " + wordList(src, args)
+	case op == "project-rename" && len(args) > 0:
+		return "rename " + wordList(src, args)
+	case op == "extend" && len(args) > 0:
+		return "add " + wordList(src, args)
+	case op == "distinct" && len(args) > 0:
+		return "keep the distinct values of " + wordList(src, args)
+	}
+	return text(stage)
+}
+
+// wordList writes a comma-separated list as "a, b and c", each item as
+// written.
+func wordList(src string, toks []lexer.Token) string {
+	var items []string
+	for _, item := range splitList(toks) {
+		items = append(items, tokenText(src, item))
+	}
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
+
+// jsExplainAPL returns {valid, explanation}, the explanation holding one
+// string per stage of the last statement, the source included.
+func jsExplainAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	explanation, err := explainAPL(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("explanation", jsStrings(explanation))
+	return result
+}
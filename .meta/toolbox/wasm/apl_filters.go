@@ -0,0 +1,226 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// filterPredicate is one conjunct of a where stage. Field, Op and Value are
+// set when it has the form `field op literal` or `field op (literal, ...)`;
+// otherwise Expression holds its text.
+type filterPredicate struct {
+	Field      string
+	Op         string
+	Value      any // string, float64, bool, nil or []any
+	Expression string
+	Line       int
+	Column     int
+}
+
+// extractFilters returns the predicates of every top-level where stage in
+// src, in order, with each stage split on its top-level ands. A top-level
+// or keeps its stage whole, since splitting it would change its meaning.
+func extractFilters(src string) ([]filterPredicate, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var preds []filterPredicate
+	for _, stages := range splitPipelines(significant(toks)) {
+		for _, stage := range stages[1:] {
+			if op, args := stageOperator(stage); op == "where" && len(args) > 0 {
+				for _, conj := range splitConjuncts(args) {
+					if len(conj) > 0 {
+						preds = append(preds, predicateOf(src, conj))
+					}
+				}
+			}
+		}
+	}
+	return preds, nil
+}
+
+// splitConjuncts splits toks on the ands outside any brackets, unless
+// there is also an or there.
+func splitConjuncts(toks []lexer.Token) [][]lexer.Token {
+	var (
+		out   [][]lexer.Token
+		cur   []lexer.Token
+		depth int
+	)
+	for _, tok := range toks {
+		switch {
+		case isPunct(tok, "(") || isPunct(tok, "["):
+			depth++
+		case (isPunct(tok, ")") || isPunct(tok, "]")) && depth > 0:
+			depth--
+		case depth == 0 && symbolOf(tok) == symIdent && tok.Value == "or":
+			return [][]lexer.Token{toks}
+		case depth == 0 && symbolOf(tok) == symIdent && tok.Value == "and" && len(cur) > 0:
+			out = append(out, cur)
+			cur = nil
+			continue
+		}
+		cur = append(cur, tok)
+	}
+	return append(out, cur)
+}
+
+// predicateOf reads one conjunct. The operator is whatever one or two
+// tokens sit between the field and the value, so !contains, matches regex
+// and the like need no list of their own.
+func predicateOf(src string, toks []lexer.Token) filterPredicate {
+	pred := filterPredicate{Line: toks[0].Pos.Line, Column: toks[0].Pos.Column}
+	field, n := fieldAt(toks)
+	if n > 0 {
+		if value, m, ok := literalSuffix(toks[n:]); ok {
+			if op := toks[n : len(toks)-m]; len(op) > 0 && len(op) <= 2 && !hasLiteral(op) {
+				pred.Field, pred.Op, pred.Value = field, tokenText(src, op), value
+				return pred
+			}
+		}
+	}
+	pred.Expression = tokenText(src, toks)
+	return pred
+}
+
+// fieldAt reads a field reference at the start of toks: a name with
+// optional .member and ['member'] parts, or ['name']. It returns the
+// dotted name and how many tokens it took, 0 if there is none.
+func fieldAt(toks []lexer.Token) (string, int) {
+	var parts []string
+	i := 0
+	for i < len(toks) {
+		switch {
+		case isPunct(toks[i], "[") && i+2 < len(toks) && symbolOf(toks[i+1]) == symString && isPunct(toks[i+2], "]"):
+			parts = append(parts, unquote(toks[i+1].Value))
+			i += 3
+		case i == 0 && symbolOf(toks[i]) == symIdent && !aplReserved[toks[i].Value] && !isCall(toks, i):
+			parts = append(parts, toks[i].Value)
+			i++
+		case i > 0 && isPunct(toks[i], ".") && i+1 < len(toks) && symbolOf(toks[i+1]) == symIdent:
+			parts = append(parts, toks[i+1].Value)
+			i += 2
+		default:
+			return strings.Join(parts, "."), i
+		}
+	}
+	// Nothing but a field is no comparison.
+	return "", 0
+}
+
+// literalSuffix reads the literal, or parenthesized list of literals, that
+// toks ends with, and how many tokens it took.
+func literalSuffix(toks []lexer.Token) (any, int, bool) {
+	if len(toks) == 0 {
+		return nil, 0, false
+	}
+	last := len(toks) - 1
+	if !isPunct(toks[last], ")") {
+		v, ok := literalValue(toks[last])
+		if ok && last > 0 && isPunct(toks[last-1], "-") && symbolOf(toks[last]) == symNumber {
+			return -v.(float64), 2, true
+		}
+		return v, 1, ok
+	}
+	open := -1
+	for i := last - 1; i >= 0 && open < 0; i-- {
+		switch {
+		case isPunct(toks[i], "("):
+			open = i
+		case !isPunct(toks[i], ","):
+			if _, ok := literalValue(toks[i]); !ok {
+				return nil, 0, false
+			}
+		}
+	}
+	if open < 0 {
+		return nil, 0, false
+	}
+	values := []any{}
+	for _, item := range splitList(toks[open+1 : last]) {
+		if len(item) != 1 {
+			return nil, 0, false
+		}
+		v, _ := literalValue(item[0])
+		values = append(values, v)
+	}
+	return values, len(toks) - open, true
+}
+
+func literalValue(tok lexer.Token) (any, bool) {
+	switch symbolOf(tok) {
+	case symString:
+		return unquote(tok.Value), true
+	case symNumber:
+		if f, err := strconv.ParseFloat(tok.Value, 64); err == nil {
+			return f, true
+		}
+	case symIdent:
+		switch tok.Value {
+		case "true", "false":
+			return tok.Value == "true", true
+		case "null":
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+func hasLiteral(toks []lexer.Token) bool {
+	for _, tok := range toks {
+		if _, ok := literalValue(tok); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// jsExtractFiltersAPL returns {valid, filters}, each filter being {field,
+// op, value, expression, line, column} with the unused of the two forms
+// null.
+func jsExtractFiltersAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	preds, err := extractFilters(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	filters := js.Global().Get("Array").New()
+	for i, p := range preds {
+		obj := js.Global().Get("Object").New()
+		obj.Set("field", js.Null())
+		obj.Set("op", js.Null())
+		obj.Set("value", js.Null())
+		obj.Set("expression", js.Null())
+		if p.Expression != "" {
+			obj.Set("expression", p.Expression)
+		} else {
+			obj.Set("field", p.Field)
+			obj.Set("op", p.Op)
+			obj.Set("value", p.Value)
+		}
+		obj.Set("line", p.Line)
+		obj.Set("column", p.Column)
+		filters.SetIndex(i, obj)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("filters", filters)
+	return result
+}
@@ -0,0 +1,52 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"syscall/js"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// fingerprintAPL hashes the significant tokens of src. Whitespace and
+// comments don't contribute, so any two queries that format to the same
+// text (give or take comments) share a fingerprint.
+func fingerprintAPL(src string) (string, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return "", err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, tok := range significant(toks) {
+		// NUL separators keep token boundaries from shifting between
+		// otherwise equal streams.
+		h.Write([]byte(symbolOf(tok)))
+		h.Write([]byte{0})
+		h.Write([]byte(tok.Value))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func jsFingerprintAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	fp, err := fingerprintAPL(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("fingerprint", fp)
+	return result
+}
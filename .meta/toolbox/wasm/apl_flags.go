@@ -0,0 +1,79 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2"
+
+	"toolbox/validate"
+)
+
+// experimentalOperators maps each tabular operator shipped behind a
+// feature flag to the flag's name in the flags object. Gate a new operator
+// by adding it here.
+var experimentalOperators = map[string]string{
+	"join":        "experimentalJoins",
+	"lookup":      "experimentalJoins",
+	"make-series": "experimentalMakeSeries",
+	"parse-kv":    "experimentalParseKv",
+	"redact":      "experimentalRedact",
+}
+
+// flagsFromJS reads a flags object. As with the PromQL features, absent or
+// non-boolean flags leave their operators enabled.
+func flagsFromJS(v js.Value) map[string]bool {
+	enabled := make(map[string]bool)
+	for _, flag := range experimentalOperators {
+		enabled[flag] = true
+		if v.Type() != js.TypeObject {
+			continue
+		}
+		if fv := v.Get(flag); fv.Type() == js.TypeBoolean {
+			enabled[flag] = fv.Bool()
+		}
+	}
+	return enabled
+}
+
+// checkFlags returns an error at the first stage, subqueries included,
+// whose operator is gated by a flag that's off.
+func checkFlags(src string, enabled map[string]bool) error {
+	toks, err := lexAPL(src)
+	if err != nil {
+		return err
+	}
+	toks = significant(toks)
+	for i := 1; i < len(toks); i++ {
+		if !isPunct(toks[i-1], "|") {
+			continue
+		}
+		op, _ := stageOperator(toks[i:])
+		if flag, ok := experimentalOperators[op]; ok && !enabled[flag] {
+			return participle.Errorf(toks[i].Pos, "%s is experimental and disabled by the %s flag", op, flag)
+		}
+	}
+	return nil
+}
+
+// jsValidateAPLWithFlags is ValidateAPL, except that a query using an
+// operator whose flag is off in flags is invalid with code
+// experimental_disabled, positioned at the operator. With every flag on, or
+// no flags object, it is ValidateAPL.
+func jsValidateAPLWithFlags(this js.Value, args []js.Value) any {
+	if len(args) < 1 || len(args) > 2 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected source and an optional flags object")
+	}
+
+	var p validate.APLParser
+	src := args[0].String()
+	result := validateAPL(&p, src)
+	if len(args) == 1 || !result.Get("valid").Bool() {
+		return result
+	}
+	if err := checkFlags(src, flagsFromJS(args[1])); err != nil {
+		return aplOutcome{err: err, code: validate.CodeExperimentalDisabled}.result()
+	}
+	return result
+}
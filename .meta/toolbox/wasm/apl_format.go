@@ -0,0 +1,228 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// continuationIndent starts a line that continues a stage after a comment.
+const continuationIndent = "    "
+
+// formatAPL renders src in canonical form: one pipeline stage per line,
+// single spaces around binary operators, none inside brackets. Only the
+// whitespace between tokens changes, and since layout is decided from the
+// tokens alone formatting is idempotent.
+func formatAPL(src string) (string, error) {
+	f := aplFormatter{lineStart: true, stmtStart: true}
+	if err := renderAPL(src, &f); err != nil {
+		return src, err
+	}
+	return strings.TrimRight(f.sb.String(), " \n"), nil
+}
+
+// tokenLayout is the whitespace around a token in the source.
+type tokenLayout struct {
+	Gap     bool // whitespace before it
+	Newline bool // that whitespace has a line break
+	Tight   bool // no whitespace after it
+}
+
+// aplRenderer lays out a query one significant token at a time. Comments
+// are passed on; whitespace only shows up in the tokenLayout.
+type aplRenderer interface {
+	render(tok lexer.Token, layout tokenLayout)
+}
+
+// renderAPL checks that src parses and feeds its tokens to r.
+func renderAPL(src string, r aplRenderer) error {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return err
+	}
+	for i, tok := range toks {
+		if symbolOf(tok) == symWhitespace {
+			continue
+		}
+		gap := i > 0 && symbolOf(toks[i-1]) == symWhitespace
+		r.render(tok, tokenLayout{
+			Gap:     gap,
+			Newline: gap && strings.Contains(toks[i-1].Value, "\n"),
+			Tight:   nextTight(toks, i),
+		})
+	}
+	return nil
+}
+
+// nextTight reports whether toks[i] is directly followed by a significant
+// token, with no whitespace in between.
+func nextTight(toks []lexer.Token, i int) bool {
+	return i+1 < len(toks) && symbolOf(toks[i+1]) != symWhitespace
+}
+
+type aplFormatter struct {
+	sb strings.Builder
+
+	prev       lexer.Token
+	hasPrev    bool
+	depth      int
+	lineStart  bool // nothing written on the current line yet
+	stmtStart  bool // nothing written for the current statement yet
+	sawNewline bool // the source had a line break before this token
+	noSpace    bool // the previous token binds to the next one
+}
+
+func (f *aplFormatter) render(tok lexer.Token, layout tokenLayout) {
+	f.sawNewline = layout.Newline
+	f.token(tok, layout.Gap, layout.Tight)
+}
+
+func (f *aplFormatter) token(tok lexer.Token, gap, tight bool) {
+	if symbolOf(tok) == symComment {
+		f.comment(tok)
+		return
+	}
+
+	switch {
+	case f.depth == 0 && isPunct(tok, "|"):
+		if !f.lineStart {
+			f.sb.WriteString("\n")
+		}
+		f.sb.WriteString("| ")
+		f.lineStart, f.stmtStart = false, false
+		f.prev, f.hasPrev, f.noSpace = tok, true, true
+		return
+	case f.depth == 0 && isPunct(tok, ";"):
+		f.sb.WriteString(";\n")
+		f.lineStart, f.stmtStart = true, true
+		f.hasPrev, f.noSpace = false, false
+		return
+	}
+
+	switch {
+	case f.lineStart && !f.stmtStart:
+		f.sb.WriteString(continuationIndent)
+	case f.lineStart:
+	case f.wantSpace(tok, gap, tight):
+		f.sb.WriteString(" ")
+	}
+	f.sb.WriteString(tok.Value)
+
+	f.noSpace = f.bindsNext(tok, gap, tight)
+	switch {
+	case isPunct(tok, "(") || isPunct(tok, "["):
+		f.depth++
+	case (isPunct(tok, ")") || isPunct(tok, "]")) && f.depth > 0:
+		f.depth--
+	}
+	f.prev, f.hasPrev = tok, true
+	f.lineStart, f.stmtStart = false, false
+}
+
+// comment keeps a comment where it was relative to its line: trailing
+// comments stay trailing, own-line comments stay on their own line.
+func (f *aplFormatter) comment(tok lexer.Token) {
+	text := strings.TrimRight(tok.Value, " \t\r\n")
+	if !f.lineStart {
+		if f.sawNewline {
+			f.sb.WriteString("\n")
+			if !f.stmtStart {
+				f.sb.WriteString(continuationIndent)
+			}
+		} else {
+			f.sb.WriteString(" ")
+		}
+	} else if !f.stmtStart {
+		f.sb.WriteString(continuationIndent)
+	}
+	f.sb.WriteString(text)
+	if strings.HasPrefix(text, "//") {
+		f.sb.WriteString("\n")
+		f.lineStart = true
+		f.noSpace = false
+		return
+	}
+	f.lineStart = false
+}
+
+func (f *aplFormatter) wantSpace(tok lexer.Token, gap, tight bool) bool {
+	if !f.hasPrev || f.noSpace {
+		return false
+	}
+	if symbolOf(tok) != symOperator {
+		return true
+	}
+	switch tok.Value {
+	case ",", ")", "]", ".", ":":
+		return false
+	case "(", "[":
+		// A call or index binds to its name; a parenthesised operand doesn't.
+		if symbolOf(f.prev) == symIdent || isPunct(f.prev, ")") || isPunct(f.prev, "]") {
+			return gap
+		}
+		return true
+	case "-":
+		// Hyphenated names such as project-away may lex as three tokens.
+		if !gap && tight && symbolOf(f.prev) == symIdent {
+			return false
+		}
+	case "!":
+		return gap
+	case "=":
+		// Operator parameters are written kind=inner.
+		return symbolOf(f.prev) != symIdent || f.prev.Value != "kind"
+	}
+	return true
+}
+
+// bindsNext reports whether no space may follow tok.
+func (f *aplFormatter) bindsNext(tok lexer.Token, gap, tight bool) bool {
+	if symbolOf(tok) != symOperator {
+		return false
+	}
+	switch tok.Value {
+	case "(", "[", ".", ":":
+		return true
+	case "!":
+		return tight
+	case "=":
+		return f.hasPrev && f.prev.Value == "kind"
+	case "-", "+":
+		if !gap && tight && f.hasPrev && symbolOf(f.prev) == symIdent {
+			return true
+		}
+		// Unary sign: nothing before it that could be a left operand.
+		return !f.hasPrev || (symbolOf(f.prev) == symOperator && !isPunct(f.prev, ")") && !isPunct(f.prev, "]"))
+	}
+	return false
+}
+
+func jsFormatAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	text, err := formatAPL(src)
+	if err != nil {
+		result := invalidQuery(err)
+		result.Set("formatted", false)
+		result.Set("text", src)
+		return result
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("formatted", true)
+	result.Set("text", text)
+	result.Set("error", js.Null())
+	return result
+}
@@ -0,0 +1,55 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"sync"
+	"syscall/js"
+
+	"toolbox/validate"
+)
+
+// disposedParser holds the methods a parser handle is left with once
+// disposed, shared by every handle so none has to stay alive for it.
+var disposedParser = sync.OnceValues(func() (js.Func, js.Func) {
+	validateFn := js.FuncOf(func(this js.Value, args []js.Value) any {
+		return invalidArgs("parser has been disposed")
+	})
+	disposeFn := js.FuncOf(func(this js.Value, args []js.Value) any {
+		return js.Undefined()
+	})
+	return validateFn, disposeFn
+})
+
+// jsCreateAPLParser returns a handle {validate(source), dispose()}.
+// validate is ValidateAPL, reusing the handle's parse tree from one call to
+// the next instead of starting from a fresh parser. dispose frees it; after
+// that validate, called through the handle, returns an invalid_arguments
+// result saying so, and dispose does nothing. Like ValidateAPLIncremental, a handle is meant for one
+// editor at a time.
+func jsCreateAPLParser(this js.Value, args []js.Value) any {
+	if len(args) != 0 {
+		return invalidArgs("expected no arguments")
+	}
+
+	var p validate.APLParser
+	var validateFn, disposeFn js.Func
+	handle := js.Global().Get("Object").New()
+	validateFn = guarded(func(this js.Value, args []js.Value) any {
+		if len(args) != 1 || args[0].Type() != js.TypeString {
+			return invalidArgs("expected 1 string argument")
+		}
+		return validateAPL(&p, args[0].String())
+	})
+	disposeFn = js.FuncOf(func(this js.Value, args []js.Value) any {
+		v, d := disposedParser()
+		handle.Set("validate", v)
+		handle.Set("dispose", d)
+		validateFn.Release()
+		disposeFn.Release()
+		return js.Undefined()
+	})
+	handle.Set("validate", validateFn)
+	handle.Set("dispose", disposeFn)
+	return handle
+}
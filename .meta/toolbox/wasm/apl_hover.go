@@ -0,0 +1,66 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// enclosingCall returns the index in toks of the name of the innermost call
+// to a documented function containing offset. The call's text runs from its
+// name to its closing paren, or with inArgs from just after the opening
+// paren up to and including the closing one, where an editor's cursor is
+// between arguments. Unterminated calls run to the end of the source.
+func enclosingCall(toks []lexer.Token, offset int, inArgs bool) (int, bool) {
+	best, found := 0, false
+	for i := range toks {
+		if !isCall(toks, i) {
+			continue
+		}
+		if _, ok := aplFunctionDocs[toks[i].Value]; !ok {
+			continue
+		}
+		start, end := toks[i].Pos.Offset, -1
+		if inArgs {
+			start = toks[i+1].Pos.Offset + 1
+		}
+		if start > offset {
+			break
+		}
+		if _, closeIdx := callArgs(toks, i); closeIdx < len(toks) {
+			end = toks[closeIdx].Pos.Offset + 1
+			if inArgs {
+				end = toks[closeIdx].Pos.Offset
+			}
+		}
+		if end < 0 || offset < end || (inArgs && offset == end) {
+			best, found = i, true
+		}
+	}
+	return best, found
+}
+
+func jsHoverAPL(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeNumber {
+		return invalidArgs("expected source and offset")
+	}
+
+	toks, err := lexAPL(args[0].String())
+	if err != nil {
+		return js.Null()
+	}
+	toks = significant(toks)
+	i, ok := enclosingCall(toks, args[1].Int(), false)
+	if !ok {
+		return js.Null()
+	}
+	name := toks[i].Value
+	doc := aplFunctionDocs[name]
+	result := js.Global().Get("Object").New()
+	result.Set("name", name)
+	result.Set("signature", doc.Signature)
+	result.Set("description", doc.Description)
+	return result
+}
@@ -0,0 +1,60 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"html"
+	"strings"
+	"syscall/js"
+)
+
+// tokenError is the class of whatever follows the point where lexing
+// failed.
+const tokenError = "error"
+
+// highlightHTML renders src as HTML with each token in a
+// <span class="tok-<type>">. All text, including what lies between tokens,
+// is escaped, so the result can be inserted as is. If the lexer fails, the
+// source up to the failure is highlighted and the rest goes in one
+// tok-error span.
+func highlightHTML(src string) string {
+	text, rest := src, ""
+	toks, err := tokenizeAPL(src)
+	if err != nil {
+		pos, _ := positionOf(err)
+		off := max(0, min(pos.Offset, len(src)))
+		text, rest = src[:off], src[off:]
+		if toks, err = tokenizeAPL(text); err != nil {
+			text, rest, toks = "", src, nil
+		}
+	}
+
+	var sb strings.Builder
+	end := 0
+	for _, tok := range toks {
+		sb.WriteString(html.EscapeString(text[end:tok.Start]))
+		writeSpan(&sb, tok.Type, text[tok.Start:tok.End])
+		end = tok.End
+	}
+	sb.WriteString(html.EscapeString(text[end:]))
+	if rest != "" {
+		writeSpan(&sb, tokenError, rest)
+	}
+	return sb.String()
+}
+
+func writeSpan(sb *strings.Builder, class, text string) {
+	sb.WriteString(`<span class="tok-`)
+	sb.WriteString(class)
+	sb.WriteString(`">`)
+	sb.WriteString(html.EscapeString(text))
+	sb.WriteString(`</span>`)
+}
+
+func jsHighlightAPLToHTML(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	return highlightHTML(args[0].String())
+}
@@ -0,0 +1,161 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"syscall/js"
+	"unicode/utf8"
+)
+
+// statementCache holds the diagnostics of each statement of the last source
+// seen by jsValidateAPLIncremental, keyed by statement text, with offsets
+// relative to the start of the statement.
+//
+// Invalidation rules:
+//   - The cache belongs to one document. If the source passed in is not the
+//     one the cache was built from, it's dropped.
+//   - An edit whose replaced range or new text contains a statement
+//     separator drops the cache, since statements may have merged or split.
+//   - A source where a statement uses a name an earlier let binds is
+//     diagnosed as a whole and not cached, since that statement means
+//     nothing on its own.
+//   - Otherwise every statement whose text is unchanged reuses its entry,
+//     shifted to its new position, and only the edited one is parsed.
+//   - After each call the cache holds exactly the new source's statements.
+//
+// Statements are diagnosed on their own in both the cached and the uncached
+// path, so results don't depend on what was cached.
+var statementCache struct {
+	source string
+	diags  map[string][]diagnostic
+}
+
+type statementSpan struct {
+	Start, End int
+}
+
+// splitStatements returns the byte ranges of the top-level statements in
+// src, excluding their separators.
+func splitStatements(src string) ([]statementSpan, bool) {
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, false
+	}
+	var spans []statementSpan
+	start := 0
+	for _, b := range stageBoundaries(significant(toks)) {
+		if b.Statement {
+			spans = append(spans, statementSpan{start, b.Offset})
+			start = b.Offset + 1
+		}
+	}
+	return append(spans, statementSpan{start, len(src)}), true
+}
+
+// letDependencies returns, for each statement of src, the indexes of the
+// earlier let statements whose names it uses, either bare or in the
+// ['name'] form.
+func letDependencies(src string, spans []statementSpan) [][]int {
+	deps := make([][]int, len(spans))
+	toks, err := lexAPL(src)
+	if err != nil {
+		return deps
+	}
+	toks = significant(toks)
+	bound := map[string]int{}
+	stmt, first := 0, true
+	for i, tok := range toks {
+		for stmt < len(spans)-1 && tok.Pos.Offset >= spans[stmt].End {
+			stmt, first = stmt+1, true
+		}
+		if isPunct(tok, ";") {
+			continue
+		}
+		if first && tok.Value == "let" && symbolOf(tok) == symIdent && i+1 < len(toks) {
+			bound[toks[i+1].Value] = stmt
+		}
+		first = false
+		name := ""
+		switch {
+		case symbolOf(tok) == symIdent:
+			name = tok.Value
+		case symbolOf(tok) == symString && i > 0 && isPunct(toks[i-1], "[") && i+1 < len(toks) && isPunct(toks[i+1], "]"):
+			name = unquote(tok.Value)
+		}
+		if at, ok := bound[name]; ok && at < stmt && !slices.Contains(deps[stmt], at) {
+			deps[stmt] = append(deps[stmt], at)
+		}
+	}
+	return deps
+}
+
+// validateIncremental applies the edit to prev and diagnoses the result,
+// reusing cached statements where the rules above allow. It reports whether
+// the cache was used.
+func validateIncremental(prev string, editStart, editEnd int, newText string) ([]diagnostic, bool) {
+	editStart = max(0, min(editStart, len(prev)))
+	editEnd = max(editStart, min(editEnd, len(prev)))
+	src := prev[:editStart] + newText + prev[editEnd:]
+
+	cached := statementCache.diags
+	if statementCache.source != prev || strings.Contains(prev[editStart:editEnd], ";") || strings.Contains(newText, ";") {
+		cached = nil
+	}
+
+	spans, ok := splitStatements(src)
+	if !ok || slices.ContainsFunc(letDependencies(src, spans), func(d []int) bool { return len(d) > 0 }) {
+		// Nothing to split on, or statements that only mean something
+		// together; the whole source is reported as one statement.
+		statementCache.source, statementCache.diags = src, nil
+		return diagnoseAPL(src), false
+	}
+
+	fresh := make(map[string][]diagnostic, len(spans))
+	var all []diagnostic
+	for _, span := range spans {
+		text := src[span.Start:span.End]
+		diags, hit := cached[text]
+		if !hit {
+			if strings.TrimSpace(text) == "" {
+				diags = nil
+			} else {
+				diags = diagnoseAPL(text)
+			}
+		}
+		fresh[text] = diags
+		for _, d := range diags {
+			all = append(all, rebase(src, d, span.Start))
+		}
+	}
+	statementCache.source, statementCache.diags = src, fresh
+	return all, cached != nil
+}
+
+// rebase moves a statement-relative diagnostic to its place in src.
+func rebase(src string, d diagnostic, start int) diagnostic {
+	if !d.HasPos {
+		return d
+	}
+	off := min(start+d.Pos.Offset, len(src))
+	lineStart := strings.LastIndexByte(src[:off], '\n') + 1
+	d.Pos = errorPos{
+		Line:   strings.Count(src[:off], "\n") + 1,
+		Column: utf8.RuneCountInString(src[lineStart:off]) + 1,
+		Offset: off,
+	}
+	return d
+}
+
+func jsValidateAPLIncremental(this js.Value, args []js.Value) any {
+	if len(args) != 4 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeNumber ||
+		args[2].Type() != js.TypeNumber || args[3].Type() != js.TypeString {
+		return invalidArgs("expected source, editStart, editEnd and newText")
+	}
+
+	diags, incremental := validateIncremental(args[0].String(), args[1].Int(), args[2].Int(), args[3].String())
+	result := diagnosticsResult(diags)
+	result.Set("incremental", incremental)
+	return result
+}
@@ -0,0 +1,215 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"syscall/js"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// astNode is the JSON form of a kirby AST node:
+//
+//	{
+//	  "type": "Doc",                       // Go type name of the node
+//	  "field": "Stages",                   // parent field holding it, absent on the root
+//	  "span": {"start": 0, "end": 42, "line": 1, "column": 1},
+//	  "attrs": {"Operator": "where"},      // scalar fields, zero values omitted
+//	  "children": [ ... ]                  // nested nodes in field order
+//	}
+//
+// Offsets are bytes, end exclusive. The schema only depends on how nodes are
+// shaped, not on which nodes exist, so grammar changes add types and attrs
+// without breaking consumers.
+type astNode struct {
+	Type     string         `json:"type"`
+	Field    string         `json:"field,omitempty"`
+	Span     astSpan        `json:"span"`
+	Attrs    map[string]any `json:"attrs,omitempty"`
+	Children []*astNode     `json:"children,omitempty"`
+}
+
+type astSpan struct {
+	Start  int `json:"start"`
+	End    int `json:"end"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+var (
+	positionType = reflect.TypeOf(lexer.Position{})
+	tokensType   = reflect.TypeOf([]lexer.Token{})
+)
+
+// astToJSON serializes doc in the astNode schema.
+func astToJSON(doc *ast.Doc) (string, error) {
+	return nodeToJSON(toASTNode(reflect.ValueOf(doc).Elem()))
+}
+
+func nodeToJSON(node *astNode) (string, error) {
+	b, err := json.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// partialAST is the tree recoverAPL salvaged from src, with an "Error" node
+// under the root's "Errors" field for each range it had to blank. Error
+// spans skip the whitespace at either end of the range and carry the
+// message as their Message attr. When nothing could be salvaged the root is
+// an empty Doc holding only the error nodes.
+func partialAST(src string, doc *ast.Doc, diags []diagnostic, blanked []blankedRange) *astNode {
+	root := &astNode{Type: "Doc", Span: astSpan{End: len(src), Line: 1, Column: 1}}
+	if doc != nil {
+		root = toASTNode(reflect.ValueOf(doc).Elem())
+	}
+	for _, b := range blanked {
+		text := src[b.Start:b.End]
+		start := b.Start + len(text) - len(strings.TrimLeft(text, " \t\r\n"))
+		end := b.Start + len(strings.TrimRight(text, " \t\r\n"))
+		if end < start {
+			end = start
+		}
+		lineStart := strings.LastIndexByte(src[:start], '\n') + 1
+		root.Children = append(root.Children, &astNode{
+			Type:  "Error",
+			Field: "Errors",
+			Span: astSpan{
+				Start:  start,
+				End:    end,
+				Line:   strings.Count(src[:start], "\n") + 1,
+				Column: utf8.RuneCountInString(src[lineStart:start]) + 1,
+			},
+			Attrs: map[string]any{"Message": diags[b.Diag].Message},
+		})
+	}
+	return root
+}
+
+func toASTNode(v reflect.Value) *astNode {
+	t := v.Type()
+	node := &astNode{Type: t.Name()}
+	hasEnd := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		switch {
+		case f.Type == positionType && f.Name == "Pos":
+			pos := fv.Interface().(lexer.Position)
+			node.Span.Start, node.Span.Line, node.Span.Column = pos.Offset, pos.Line, pos.Column
+		case f.Type == positionType && f.Name == "EndPos":
+			node.Span.End = fv.Interface().(lexer.Position).Offset
+			hasEnd = true
+		case f.Type == tokensType:
+			if toks := fv.Interface().([]lexer.Token); len(toks) > 0 && !hasEnd {
+				last := toks[len(toks)-1]
+				node.Span.End = last.Pos.Offset + len(last.Value)
+				hasEnd = true
+			}
+		case f.Type == positionType:
+		default:
+			addField(node, f.Name, fv)
+		}
+	}
+	if !hasEnd {
+		node.Span.End = node.Span.Start
+		for _, c := range node.Children {
+			if c.Span.End > node.Span.End {
+				node.Span.End = c.Span.End
+			}
+		}
+	}
+	return node
+}
+
+// addField records fv as children when it holds nodes, otherwise as an attr.
+func addField(node *astNode, name string, fv reflect.Value) {
+	for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		child := toASTNode(fv)
+		child.Field = name
+		node.Children = append(node.Children, child)
+	case reflect.Slice:
+		if fv.Len() == 0 {
+			return
+		}
+		if isNodeType(fv.Type().Elem()) {
+			for i := 0; i < fv.Len(); i++ {
+				addField(node, name, fv.Index(i))
+			}
+			return
+		}
+		setAttr(node, name, fv.Interface())
+	default:
+		if !fv.IsZero() {
+			setAttr(node, name, fv.Interface())
+		}
+	}
+}
+
+func isNodeType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Interface
+}
+
+func setAttr(node *astNode, name string, value any) {
+	if node.Attrs == nil {
+		node.Attrs = make(map[string]any)
+	}
+	node.Attrs[name] = value
+}
+
+func jsParseAPLToJSON(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	var doc ast.Doc
+	if err := validate.ParseAPL(args[0].String(), &doc); err != nil {
+		return invalidQuery(err)
+	}
+	out, err := astToJSON(&doc)
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("ast", out)
+	return result
+}
+
+func jsParseAPLPartial(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	diags, doc, blanked := recoverAPL(src)
+	out, err := nodeToJSON(partialAST(src, doc, diags, blanked))
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := diagnosticsResult(diags)
+	result.Set("complete", len(diags) == 0)
+	result.Set("ast", out)
+	return result
+}
@@ -0,0 +1,117 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// Rule names of the kirby lexer. Token types are only meaningful relative to
+// ast.Lexer, so everything here goes through symbolNames rather than
+// hard-coding type values.
+const (
+	symIdent      = "Ident"
+	symString     = "String"
+	symNumber     = "Number"
+	symOperator   = "Operator"
+	symComment    = "Comment"
+	symWhitespace = "Whitespace"
+)
+
+var symbolNames = func() map[lexer.TokenType]string {
+	names := make(map[lexer.TokenType]string)
+	for name, typ := range ast.Lexer.Symbols() {
+		names[typ] = name
+	}
+	return names
+}()
+
+// symbolOf returns the lexer rule name that produced tok.
+func symbolOf(tok lexer.Token) string {
+	return symbolNames[tok.Type]
+}
+
+// lexAPL runs the kirby lexer over src, normalized as validate.ParseAPL
+// normalizes it, and returns every token, including whitespace and
+// comments, without the trailing EOF. Offsets and values are moved back
+// into src, so tokenText slices src; a \r dropped before a line break is
+// in no token.
+func lexAPL(src string) ([]lexer.Token, error) {
+	n := validate.Normalize(src)
+	lx, err := ast.Lexer.Lex("query.apl", strings.NewReader(n.Text))
+	if err != nil {
+		return nil, err
+	}
+	toks, err := lexer.ConsumeAll(lx)
+	if err != nil {
+		var lerr *lexer.Error
+		if errors.As(err, &lerr) {
+			shifted := *lerr
+			shifted.Pos.Offset = n.Original(shifted.Pos.Offset)
+			err = &shifted
+		}
+		return nil, err
+	}
+	if last := len(toks) - 1; last >= 0 && toks[last].EOF() {
+		toks = toks[:last]
+	}
+	if n.Text != src {
+		for i := range toks {
+			start, end := n.OriginalSpan(toks[i].Pos.Offset, toks[i].Pos.Offset+len(toks[i].Value))
+			toks[i].Pos.Offset, toks[i].Value = start, src[start:end]
+		}
+	}
+	return toks, nil
+}
+
+// significant drops whitespace and comment tokens.
+func significant(toks []lexer.Token) []lexer.Token {
+	out := make([]lexer.Token, 0, len(toks))
+	for _, tok := range toks {
+		switch symbolOf(tok) {
+		case symWhitespace, symComment:
+			continue
+		}
+		out = append(out, tok)
+	}
+	return out
+}
+
+// unquote returns the value of a string literal token. APL accepts both
+// quote styles with backslash escapes, plus verbatim @"..." strings.
+func unquote(lit string) string {
+	verbatim := strings.HasPrefix(lit, "@")
+	lit = strings.TrimPrefix(lit, "@")
+	if len(lit) < 2 {
+		return lit
+	}
+	body := lit[1 : len(lit)-1]
+	if verbatim {
+		return body
+	}
+	var sb strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] == '\\' && i+1 < len(body) {
+			i++
+			switch body[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			default:
+				sb.WriteByte(body[i])
+			}
+			continue
+		}
+		sb.WriteByte(body[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,233 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"cmp"
+	"slices"
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// lintFinding is one thing a lint rule flags, positioned at the stage or
+// token it is about. Name is the identifier at fault, "" if none is.
+type lintFinding struct {
+	Message string
+	Pos     lexer.Position
+	Name    string
+}
+
+// lintRule checks the stages of one pipeline, the source included.
+type lintRule struct {
+	ID    string
+	Check func(stages [][]lexer.Token) []lintFinding
+}
+
+// lintRules run in this order; add a rule by appending it here.
+var lintRules = []lintRule{
+	{"redundant-project", lintRedundantProject},
+	{"summarize-without-by", lintSummarizeWithoutBy},
+	{"sort-without-take", lintSortWithoutTake},
+	{"shadowed-name", lintShadowedName},
+	{"dead-stage", lintDeadStage},
+}
+
+var lintSeverities = map[string]bool{"off": true, "warn": true, "error": true}
+
+// lintDiagnostic is a lintFinding with the rule and severity it came from.
+type lintDiagnostic struct {
+	lintFinding
+	RuleID   string
+	Severity string
+}
+
+// lintRedundantProject flags a project of bare columns that the next stage
+// projects again, since the second project alone gives the same result.
+func lintRedundantProject(stages [][]lexer.Token) []lintFinding {
+	var findings []lintFinding
+	for i := 1; i+1 < len(stages); i++ {
+		op, args := stageOperator(stages[i])
+		next, _ := stageOperator(stages[i+1])
+		if op != "project" || next != "project" || len(args) == 0 {
+			continue
+		}
+		bare := true
+		for _, item := range splitList(args) {
+			bare = bare && len(item) == 1 && symbolOf(item[0]) == symIdent
+		}
+		if bare {
+			findings = append(findings, lintFinding{Message: "project is redundant, the next stage projects again", Pos: stages[i][0].Pos})
+		}
+	}
+	return findings
+}
+
+// lintSummarizeWithoutBy flags a summarize with no by clause, which folds
+// the whole input into a single row.
+func lintSummarizeWithoutBy(stages [][]lexer.Token) []lintFinding {
+	var findings []lintFinding
+	for _, stage := range stages[1:] {
+		op, args := stageOperator(stage)
+		if op != "summarize" {
+			continue
+		}
+		if _, keys := splitSummarize(args); keys == nil {
+			findings = append(findings, lintFinding{Message: "summarize without by returns a single row", Pos: stage[0].Pos})
+		}
+	}
+	return findings
+}
+
+// lintSortWithoutTake flags a sort that no later take, limit or top cuts
+// short, which sorts every row only to return them all.
+func lintSortWithoutTake(stages [][]lexer.Token) []lintFinding {
+	var findings []lintFinding
+	for i, stage := range stages[1:] {
+		if op, _ := stageOperator(stage); op != "sort" && op != "order" {
+			continue
+		}
+		limited := false
+		for _, later := range stages[i+2:] {
+			op, _ := stageOperator(later)
+			limited = limited || op == "take" || op == "limit" || op == "top"
+		}
+		if !limited {
+			findings = append(findings, lintFinding{Message: "sort without a later take returns every row", Pos: stage[0].Pos})
+		}
+	}
+	return findings
+}
+
+// lintShadowedName flags a column named after a built-in function, and an
+// extend that overwrites a column an earlier stage made. Only the columns
+// the pipeline names itself are known: project and summarize start the
+// set over, extend and project-rename add to it, project-away takes from
+// it.
+func lintShadowedName(stages [][]lexer.Token) []lintFinding {
+	var findings []lintFinding
+	known := make(map[string]bool)
+	for _, stage := range stages[1:] {
+		op, args := stageOperator(stage)
+		items := splitList(args)
+		if op == "summarize" {
+			aggs, keys := splitSummarize(args)
+			items = append(splitList(keys), splitList(aggs)...)
+		}
+		switch op {
+		case "project", "summarize", "count":
+			known = make(map[string]bool)
+		case "project-away":
+			for _, name := range listColumns(args, false) {
+				delete(known, name)
+			}
+		}
+		for _, item := range items {
+			name, _, ok := aliased(item)
+			if !ok {
+				if name, ok := columnName(item, op == "summarize"); ok && (op == "project" || op == "summarize") {
+					known[name] = true
+				}
+				continue
+			}
+			pos := item[0].Pos
+			switch {
+			case slices.ContainsFunc(aplFunctions, func(fn aplFunction) bool { return fn.Name == name }):
+				findings = append(findings, lintFinding{Message: name + " shadows the built-in function " + name + "()", Pos: pos, Name: name})
+			case op == "extend" && known[name]:
+				findings = append(findings, lintFinding{Message: "extend overwrites the column " + name + " made by an earlier stage", Pos: pos, Name: name})
+			}
+			known[name] = true
+		}
+	}
+	return findings
+}
+
+// lintAPL runs every rule not turned off in severities against each
+// top-level pipeline of src, rules missing from severities at "warn". The
+// diagnostics come in source order.
+func lintAPL(src string, severities map[string]string) ([]lintDiagnostic, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var diags []lintDiagnostic
+	for _, rule := range lintRules {
+		severity, ok := severities[rule.ID]
+		if !ok {
+			severity = "warn"
+		}
+		if severity == "off" {
+			continue
+		}
+		for _, stages := range splitPipelines(significant(toks)) {
+			for _, f := range rule.Check(stages) {
+				diags = append(diags, lintDiagnostic{f, rule.ID, severity})
+			}
+		}
+	}
+	slices.SortStableFunc(diags, func(a, b lintDiagnostic) int {
+		return cmp.Compare(a.Pos.Offset, b.Pos.Offset)
+	})
+	return diags, nil
+}
+
+// jsLintAPL takes the source and optionally a config mapping rule IDs to
+// "off", "warn" or "error", and returns {valid, diagnostics}, each
+// diagnostic being {ruleId, severity, message, name, line, column}, name
+// being the identifier at fault or null. Rule IDs the linter doesn't know
+// are ignored, so one config works across versions. A source that doesn't
+// parse is the usual invalid result.
+func jsLintAPL(this js.Value, args []js.Value) any {
+	if len(args) < 1 || len(args) > 2 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected source and an optional config object")
+	}
+	severities := make(map[string]string)
+	if len(args) == 2 && !args[1].IsUndefined() && !args[1].IsNull() {
+		config := args[1]
+		if config.Type() != js.TypeObject {
+			return invalidArgs("expected source and an optional config object")
+		}
+		for _, rule := range lintRules {
+			v := config.Get(rule.ID)
+			if v.IsUndefined() {
+				continue
+			}
+			if v.Type() != js.TypeString || !lintSeverities[v.String()] {
+				return invalidArgs(`severity of ` + rule.ID + ` must be "off", "warn" or "error"`)
+			}
+			severities[rule.ID] = v.String()
+		}
+	}
+
+	diags, err := lintAPL(args[0].String(), severities)
+	if err != nil {
+		return invalidQuery(err)
+	}
+	arr := js.Global().Get("Array").New()
+	for i, d := range diags {
+		obj := js.Global().Get("Object").New()
+		obj.Set("ruleId", d.RuleID)
+		obj.Set("severity", d.Severity)
+		obj.Set("message", d.Message)
+		obj.Set("name", js.Null())
+		if d.Name != "" {
+			obj.Set("name", d.Name)
+		}
+		obj.Set("line", d.Pos.Line)
+		obj.Set("column", d.Pos.Column)
+		arr.SetIndex(i, obj)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("diagnostics", arr)
+	return result
+}
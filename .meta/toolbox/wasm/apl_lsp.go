@@ -0,0 +1,87 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"syscall/js"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"toolbox/validate"
+)
+
+// utf16Len counts the UTF-16 code units JS sees in s. An invalid byte
+// arrives in JS as one U+FFFD, as it does here.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// utf16Column converts a 1-based column counted in runes, as the parser
+// counts them, on the given line of src into one counted in UTF-16 code
+// units. The parser counts in the normalized text, so the position is
+// found there and the line up to it measured in src, where a BOM, which
+// JS sees too, counts.
+func utf16Column(src string, line, column int) int {
+	n := validate.Normalize(src)
+	start := 0
+	for ; line > 1; line-- {
+		i := strings.IndexByte(n.Text[start:], '\n')
+		if i < 0 {
+			return column
+		}
+		start += i + 1
+	}
+	end := start
+	for ; column > 1 && end < len(n.Text) && n.Text[end] != '\n'; column-- {
+		_, size := utf8.DecodeRuneInString(n.Text[end:])
+		end += size
+	}
+	lineStart, off := n.OriginalSpan(start, end)
+	if start == 0 {
+		lineStart = 0
+	}
+	return utf16Len(src[lineStart:off]) + 1
+}
+
+// toUTF16 rewrites the column of obj, and its offset if it has one, in
+// UTF-16 code units of src. A null line leaves obj alone.
+func toUTF16(obj js.Value, src string) {
+	line := obj.Get("line")
+	if line.Type() != js.TypeNumber {
+		return
+	}
+	obj.Set("column", utf16Column(src, line.Int(), obj.Get("column").Int()))
+	if off := obj.Get("offset"); off.Type() == js.TypeNumber && off.Int() <= len(src) {
+		obj.Set("offset", utf16Len(src[:off.Int()]))
+	}
+}
+
+// jsValidateAPLLSP is ValidateAPL with positions as JS strings and the
+// Language Server Protocol index them: the columns of the error, of every
+// warning and of unmatchedOpen, and the error's offset, count UTF-16 code
+// units rather than runes and bytes. Lines are the same either way, and
+// the position the parser writes into the error text isn't converted.
+// ValidateAPL keeps the parser's units.
+func jsValidateAPLLSP(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	var p validate.APLParser
+	result := validateAPL(&p, src)
+	toUTF16(result, src)
+	warnings := result.Get("warnings")
+	for i := 0; i < warnings.Length(); i++ {
+		toUTF16(warnings.Index(i), src)
+	}
+	if open := result.Get("unmatchedOpen"); open.Type() == js.TypeObject {
+		toUTF16(open, src)
+	}
+	return result
+}
@@ -0,0 +1,115 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"syscall/js"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// queryMetrics describes the shape of a query for analytics. The set of
+// fields is part of the API: add to it, don't change what one counts.
+type queryMetrics struct {
+	NodeCount  int // nodes of the tree ParseAPLToJSON returns
+	MaxDepth   int // depth of that tree, 1 for the root alone
+	StageCount int // pipeline stages, not counting the sources
+	CallCount  int // function calls, aggregations included
+}
+
+// measureAPL computes the metrics of src in one walk of its tree. Stage
+// arguments are kept as tokens by the parser, so calls are counted on
+// the token stream, the way the other token helpers find them.
+func measureAPL(src string) (queryMetrics, error) {
+	var m queryMetrics
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return m, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return m, err
+	}
+
+	var walk func(n *astNode, depth int)
+	walk = func(n *astNode, depth int) {
+		m.NodeCount++
+		m.MaxDepth = max(m.MaxDepth, depth)
+		if n.Field == "Stages" {
+			m.StageCount++
+		}
+		for _, c := range n.Children {
+			walk(c, depth+1)
+		}
+	}
+	walk(toASTNode(reflect.ValueOf(&doc).Elem()), 1)
+
+	toks = significant(toks)
+	for i, tok := range toks {
+		switch {
+		case !isCall(toks, i):
+		case slices.Contains(aplKeywords, tok.Value) && tok.Value != "not":
+			// A keyword before a list, as in x in (1, 2).
+		default:
+			m.CallCount++
+		}
+	}
+	return m, nil
+}
+
+func jsQueryMetricsAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	m, err := measureAPL(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := jsQueryMetrics(m)
+	result.Set("valid", true)
+	return result
+}
+
+func jsQueryMetrics(m queryMetrics) js.Value {
+	obj := js.Global().Get("Object").New()
+	obj.Set("nodeCount", m.NodeCount)
+	obj.Set("maxDepth", m.MaxDepth)
+	obj.Set("stageCount", m.StageCount)
+	obj.Set("callCount", m.CallCount)
+	return obj
+}
+
+// jsValidateAPLWithStageLimit is ValidateAPL, except that a query that
+// parses but has more than maxStages stages, counted as QueryMetricsAPL's
+// stageCount, is invalid with code too_many_stages, its count and the
+// limit. A query at the limit passes.
+func jsValidateAPLWithStageLimit(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeNumber || args[1].Int() < 0 {
+		return invalidArgs("expected source and a non-negative maxStages")
+	}
+
+	var p validate.APLParser
+	src, limit := args[0].String(), args[1].Int()
+	result := validateAPL(&p, src)
+	if !result.Get("valid").Bool() {
+		return result
+	}
+	m, err := measureAPL(src)
+	if err != nil {
+		return invalidQuery(err)
+	}
+	if m.StageCount <= limit {
+		return result
+	}
+	err = fmt.Errorf("query has %d stages, more than the limit of %d", m.StageCount, limit)
+	result = aplOutcome{err: err, code: validate.CodeTooManyStages}.result()
+	result.Set("count", m.StageCount)
+	result.Set("limit", limit)
+	return result
+}
@@ -0,0 +1,126 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strings"
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// minifyAPL renders src with comments dropped and the whitespace between
+// tokens removed wherever the lexer would still split them the same way, so
+// the result parses to the same tree.
+func minifyAPL(src string) (string, error) {
+	m := aplMinifier{}
+	if err := renderAPL(src, &m); err != nil {
+		return src, err
+	}
+	out := m.sb.String()
+	if sameTokens(src, out) {
+		return out, nil
+	}
+	// A join the two-token window couldn't see changed the lexing; fall back
+	// to keeping every separation the source had.
+	m = aplMinifier{keepGaps: true}
+	if err := renderAPL(src, &m); err != nil {
+		return src, err
+	}
+	return m.sb.String(), nil
+}
+
+type aplMinifier struct {
+	sb       strings.Builder
+	keepGaps bool
+
+	// The last two tokens written and the text of both, separator included,
+	// against which the next join is checked.
+	recent []string
+	window string
+	// A comment stood between the previous token and the next one.
+	commentGap bool
+}
+
+func (m *aplMinifier) render(tok lexer.Token, layout tokenLayout) {
+	if symbolOf(tok) == symComment {
+		m.commentGap = true
+		return
+	}
+	sep := ""
+	if len(m.recent) > 0 && (layout.Gap || m.commentGap) && (m.keepGaps || !m.joins(tok.Value)) {
+		sep = " "
+	}
+	m.commentGap = false
+	m.sb.WriteString(sep)
+	m.sb.WriteString(tok.Value)
+
+	if len(m.recent) == 2 {
+		m.window = strings.TrimPrefix(m.window, m.recent[0])
+		m.window = strings.TrimPrefix(m.window, " ")
+		m.recent = m.recent[1:]
+	}
+	m.recent = append(m.recent, tok.Value)
+	m.window += sep + tok.Value
+}
+
+// joins reports whether value can follow the window directly and still lex
+// as a token of its own.
+func (m *aplMinifier) joins(value string) bool {
+	toks, err := lexAPL(m.window + value)
+	if err != nil {
+		return false
+	}
+	toks = significant(toks)
+	if len(toks) != len(m.recent)+1 {
+		return false
+	}
+	for i, prev := range m.recent {
+		if toks[i].Value != prev {
+			return false
+		}
+	}
+	return toks[len(toks)-1].Value == value
+}
+
+// sameTokens reports whether a and b lex to the same significant tokens.
+func sameTokens(a, b string) bool {
+	ta, err := lexAPL(a)
+	if err != nil {
+		return false
+	}
+	tb, err := lexAPL(b)
+	if err != nil {
+		return false
+	}
+	ta, tb = significant(ta), significant(tb)
+	if len(ta) != len(tb) {
+		return false
+	}
+	for i := range ta {
+		if ta[i].Type != tb[i].Type || ta[i].Value != tb[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+func jsMinifyAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	text, err := minifyAPL(src)
+	if err != nil {
+		result := invalidQuery(err)
+		result.Set("minified", false)
+		result.Set("text", src)
+		return result
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("minified", true)
+	result.Set("text", text)
+	result.Set("error", js.Null())
+	return result
+}
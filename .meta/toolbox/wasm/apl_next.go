@@ -0,0 +1,161 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"slices"
+	"syscall/js"
+)
+
+type stageSuggestion struct {
+	Operator string
+	Reason   string
+}
+
+// Suggestions shared by several operators.
+var (
+	suggestWhere     = stageSuggestion{"where", "filter the rows"}
+	suggestSummarize = stageSuggestion{"summarize", "aggregate the rows, optionally by group"}
+	suggestProject   = stageSuggestion{"project", "keep only the columns you need"}
+	suggestExtend    = stageSuggestion{"extend", "add a computed column"}
+	suggestSort      = stageSuggestion{"sort", "order the rows"}
+	suggestTake      = stageSuggestion{"take", "look at a few rows"}
+	suggestTop       = stageSuggestion{"top", "keep the first rows by some column"}
+)
+
+// nextStages ranks what usually follows each operator, best first. The
+// source of a pipeline is keyed by "". Operators missing here and from
+// stageAliases get fallbackStages.
+var nextStages = map[string][]stageSuggestion{
+	"": {
+		{"where", "filter first, so later stages see fewer rows"},
+		suggestSummarize,
+		suggestProject,
+		suggestTake,
+		suggestExtend,
+	},
+	"where": {
+		{"summarize", "aggregate the matching rows"},
+		suggestProject,
+		{"sort", "order the matching rows"},
+		suggestTake,
+		suggestExtend,
+	},
+	"extend": {
+		suggestProject,
+		suggestSummarize,
+		{"where", "filter on the new column"},
+	},
+	"project": {
+		suggestWhere,
+		suggestSort,
+		suggestTake,
+		suggestSummarize,
+	},
+	"summarize": {
+		{"sort", "order the groups"},
+		{"where", "filter on the aggregates"},
+		{"top", "keep the largest groups"},
+		{"project", "rename or drop the aggregates"},
+	},
+	"sort": {
+		{"take", "keep the first rows"},
+		suggestProject,
+	},
+	"top": {
+		suggestProject,
+		suggestExtend,
+	},
+	"take": {
+		suggestProject,
+		suggestSort,
+	},
+	"count": {
+		{"extend", "compute from the count"},
+	},
+	"distinct": {
+		suggestSort,
+		{"count", "count the distinct values"},
+		suggestTake,
+	},
+	"join": {
+		{"where", "filter the joined rows"},
+		suggestProject,
+		suggestSummarize,
+	},
+	"parse": {
+		{"where", "filter on the parsed columns"},
+		suggestProject,
+		suggestSummarize,
+	},
+	"make-series": {
+		{"mv-expand", "turn the series back into rows"},
+		suggestProject,
+	},
+}
+
+var fallbackStages = []stageSuggestion{suggestWhere, suggestProject, suggestSummarize, suggestTop}
+
+// stageAliases are operators followed by the same stages as another.
+var stageAliases = map[string]string{
+	"order":           "sort",
+	"limit":           "take",
+	"sample":          "take",
+	"lookup":          "join",
+	"parse-kv":        "parse",
+	"mv-expand":       "parse",
+	"project-away":    "project",
+	"project-keep":    "project",
+	"project-rename":  "project",
+	"project-reorder": "project",
+}
+
+// suggestNextStage ranks operators to follow the last complete stage of
+// the last statement in src. src needn't parse: a stage still being typed,
+// such as a trailing | or an operator name cut short, is passed over. The
+// result is nil when src can't be lexed or is empty.
+func suggestNextStage(src string) []stageSuggestion {
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil
+	}
+	toks = significant(toks)
+	if len(toks) == 0 {
+		return nil
+	}
+
+	stages, _ := lastPipeline(toks)
+	for i := len(stages) - 1; i > 0; i-- {
+		op, _ := stageOperator(stages[i])
+		if !slices.Contains(aplTabularOperators, op) {
+			continue
+		}
+		if like, ok := stageAliases[op]; ok {
+			op = like
+		}
+		if next, ok := nextStages[op]; ok {
+			return next
+		}
+		return fallbackStages
+	}
+	if len(stages[0]) == 0 {
+		return nil
+	}
+	return nextStages[""]
+}
+
+// jsSuggestNextStageAPL returns a ranked array of {operator, reason}.
+func jsSuggestNextStageAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	result := js.Global().Get("Array").New()
+	for i, s := range suggestNextStage(args[0].String()) {
+		obj := js.Global().Get("Object").New()
+		obj.Set("operator", s.Operator)
+		obj.Set("reason", s.Reason)
+		result.SetIndex(i, obj)
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"reflect"
+	"syscall/js"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// nodePath returns the nodes of the tree ParseAPLToJSON gives for src from
+// the root down to the innermost one whose span holds the byte offset. An
+// offset at the very end of src is held by the nodes ending there, so a
+// cursor after the last character still lands in them. The root is always
+// on the path, even over leading or trailing whitespace.
+func nodePath(src string, offset int) ([]*astNode, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, err
+	}
+	path := []*astNode{toASTNode(reflect.ValueOf(&doc).Elem())}
+	for {
+		var next *astNode
+		for _, c := range path[len(path)-1].Children {
+			if c.Span.Start <= offset && (offset < c.Span.End || (offset == len(src) && c.Span.End == len(src))) {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return path, nil
+		}
+		path = append(path, next)
+	}
+}
+
+// jsNodeAtOffsetAPL returns {path, span}: the type of each node from the
+// root down to the innermost one at offset, and that node's span as in
+// ParseAPLToJSON. It returns null for an offset outside the source, and
+// the usual invalid result for a source that doesn't parse.
+func jsNodeAtOffsetAPL(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeNumber {
+		return invalidArgs("expected source and offset")
+	}
+
+	src, offset := args[0].String(), args[1].Int()
+	if offset < 0 || offset > len(src) {
+		return js.Null()
+	}
+	path, err := nodePath(src, offset)
+	if err != nil {
+		return invalidQuery(err)
+	}
+	types := make([]string, len(path))
+	for i, n := range path {
+		types[i] = n.Type
+	}
+	node := path[len(path)-1]
+	span := js.Global().Get("Object").New()
+	span.Set("start", node.Span.Start)
+	span.Set("end", node.Span.End)
+	span.Set("line", node.Span.Line)
+	span.Set("column", node.Span.Column)
+	result := js.Global().Get("Object").New()
+	result.Set("path", jsStrings(types))
+	result.Set("span", span)
+	return result
+}
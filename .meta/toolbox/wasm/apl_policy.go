@@ -0,0 +1,92 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+
+	"toolbox/validate"
+)
+
+// policyError is a call to a function the deployment doesn't allow.
+type policyError struct {
+	Message  string
+	Function string
+	Line     int
+	Column   int
+}
+
+// checkPolicy reports every call in src to a function missing from
+// allowed. Only function calls are checked: operators and keywords, even
+// ones taking a parenthesized list, are always allowed.
+func checkPolicy(src string, allowed map[string]bool) ([]policyError, error) {
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, err
+	}
+	toks = significant(toks)
+	var errs []policyError
+	for i, tok := range toks {
+		if !isFunctionCall(toks, i) || allowed[tok.Value] {
+			continue
+		}
+		errs = append(errs, policyError{
+			Message:  fmt.Sprintf("function %s is not allowed", tok.Value),
+			Function: tok.Value,
+			Line:     tok.Pos.Line,
+			Column:   tok.Pos.Column,
+		})
+	}
+	return errs, nil
+}
+
+// jsValidateAPLWithPolicy is ValidateAPL plus a policyErrors array of
+// {message, line, column, code, function}, one per call to a function not
+// in allowedFunctions. As with ValidateAPLWithSchema, syntax errors leave
+// policyErrors empty and a query with policy errors only is invalid with a
+// null error. An empty or absent list allows every function.
+func jsValidateAPLWithPolicy(this js.Value, args []js.Value) any {
+	if len(args) < 1 || len(args) > 2 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected source and an optional array of allowed functions")
+	}
+
+	var p validate.APLParser
+	src := args[0].String()
+	var allowed map[string]bool
+	if len(args) == 2 && !args[1].IsUndefined() && !args[1].IsNull() {
+		list := args[1]
+		if !js.Global().Get("Array").Call("isArray", list).Bool() {
+			return invalidArgs("expected source and an optional array of allowed functions")
+		}
+		allowed = make(map[string]bool, list.Length())
+		for i := 0; i < list.Length(); i++ {
+			if list.Index(i).Type() != js.TypeString {
+				return invalidArgs("allowed functions must be strings")
+			}
+			allowed[list.Index(i).String()] = true
+		}
+	}
+
+	result := validateAPL(&p, src)
+	policyErrors := js.Global().Get("Array").New()
+	result.Set("policyErrors", policyErrors)
+	if len(allowed) == 0 || !result.Get("valid").Bool() {
+		return result
+	}
+	errs, err := checkPolicy(src, allowed)
+	if err != nil {
+		return invalidQuery(err)
+	}
+	for i, e := range errs {
+		obj := js.Global().Get("Object").New()
+		obj.Set("message", e.Message)
+		obj.Set("line", e.Line)
+		obj.Set("column", e.Column)
+		obj.Set("code", validate.CodeFunctionNotAllowed)
+		obj.Set("function", e.Function)
+		policyErrors.SetIndex(i, obj)
+	}
+	result.Set("valid", len(errs) == 0)
+	return result
+}
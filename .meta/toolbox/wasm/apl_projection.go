@@ -0,0 +1,181 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// projectedColumn is an output column of a projection. Expression is the
+// text assigned to it, "" when the column is passed through as it is.
+type projectedColumn struct {
+	Name       string
+	Expression string
+}
+
+// projection is what the final project, extend or summarize of a query
+// outputs. Dynamic means the columns aren't all known from the text; for an
+// extend, Columns still holds the ones it adds.
+type projection struct {
+	Columns []projectedColumn
+	Dynamic bool
+}
+
+// projectedColumns reads the last project, extend or summarize stage of the
+// last statement in src. Unlike inferShape it doesn't follow the pipeline
+// through: a later stage that may change the columns, or no such stage at
+// all, makes the projection dynamic.
+func projectedColumns(src string) (projection, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return projection{}, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return projection{}, err
+	}
+
+	stages, _ := lastPipeline(significant(toks))
+	for i := len(stages) - 1; i > 0; i-- {
+		op, args := stageOperator(stages[i])
+		switch op {
+		case "project":
+			return columnsOf(src, args, false), nil
+		case "extend":
+			p := columnsOf(src, args, false)
+			p.Dynamic = true
+			return p, nil
+		case "summarize":
+			aggs, keys := splitSummarize(args)
+			p := columnsOf(src, keys, false)
+			if q := columnsOf(src, aggs, true); !p.Dynamic && !q.Dynamic {
+				return projection{Columns: append(p.Columns, q.Columns...)}, nil
+			}
+			return projection{Dynamic: true}, nil
+		}
+		if !shapePreserving[op] && op != "top" {
+			break
+		}
+	}
+	return projection{Dynamic: true}, nil
+}
+
+// columnsOf names each item of a comma-separated list the way listColumns
+// does, keeping the expression behind each computed column. A wildcard or
+// any other item it can't name makes the whole list dynamic.
+func columnsOf(src string, toks []lexer.Token, aggregations bool) projection {
+	var p projection
+	for _, item := range splitList(toks) {
+		name, ok := columnName(item, aggregations)
+		if !ok {
+			return projection{Dynamic: true}
+		}
+		col := projectedColumn{Name: name}
+		if _, expr, ok := aliased(item); ok {
+			col.Expression = tokenText(src, expr)
+		} else if len(item) > 1 && !(len(item) == 3 && isPunct(item[0], "[")) {
+			col.Expression = tokenText(src, item)
+		}
+		p.Columns = append(p.Columns, col)
+	}
+	return p
+}
+
+// jsProjectedColumnsAPL returns {valid, dynamic, columns}, columns being
+// [{name, expression}] in output order, expression null for a column
+// passed through unchanged. columns is null when dynamic, except after an
+// extend, where it lists the added columns.
+func jsProjectedColumnsAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	p, err := projectedColumns(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("dynamic", p.Dynamic)
+	result.Set("columns", js.Null())
+	if p.Columns != nil {
+		cols := js.Global().Get("Array").New()
+		for i, c := range p.Columns {
+			obj := js.Global().Get("Object").New()
+			obj.Set("name", c.Name)
+			obj.Set("expression", js.Null())
+			if c.Expression != "" {
+				obj.Set("expression", c.Expression)
+			}
+			cols.SetIndex(i, obj)
+		}
+		result.Set("columns", cols)
+	}
+	return result
+}
+
+// columnDiff compares the projected columns of an old and a new version of
+// a query by name, added in the new order and removed in the old. side is
+// "old" or "new" when that one didn't parse. Dynamic is set, and the lists
+// left nil, when either projection is dynamic, since a column can then
+// neither be shown to be there nor gone.
+func columnDiff(oldSrc, newSrc string) (added, removed []string, dynamic bool, side string, err error) {
+	before, err := projectedColumns(oldSrc)
+	if err != nil {
+		return nil, nil, false, "old", err
+	}
+	after, err := projectedColumns(newSrc)
+	if err != nil {
+		return nil, nil, false, "new", err
+	}
+	if before.Dynamic || after.Dynamic {
+		return nil, nil, true, "", nil
+	}
+	return missingColumns(after.Columns, before.Columns), missingColumns(before.Columns, after.Columns), false, "", nil
+}
+
+// missingColumns names the columns of a that b has none of, in a's order.
+func missingColumns(a, b []projectedColumn) []string {
+	in := make(map[string]bool, len(b))
+	for _, c := range b {
+		in[c.Name] = true
+	}
+	missing := []string{}
+	for _, c := range a {
+		if !in[c.Name] {
+			missing = append(missing, c.Name)
+		}
+	}
+	return missing
+}
+
+// jsColumnDiffAPL returns {valid, dynamic, added, removed}, the lists null
+// when dynamic. If either query is invalid the result is its usual invalid
+// result with side "old" or "new", as with DiffAPL.
+func jsColumnDiffAPL(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeString {
+		return invalidArgs("expected 2 string arguments")
+	}
+
+	added, removed, dynamic, side, err := columnDiff(args[0].String(), args[1].String())
+	if err != nil {
+		result := invalidQuery(err)
+		result.Set("side", side)
+		return result
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("dynamic", dynamic)
+	result.Set("added", js.Null())
+	result.Set("removed", js.Null())
+	if !dynamic {
+		result.Set("added", jsStrings(added))
+		result.Set("removed", jsStrings(removed))
+	}
+	return result
+}
@@ -0,0 +1,43 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"syscall/js"
+)
+
+var plainIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// aplStringEscaper escapes what unquote reads back, so the two round-trip.
+var aplStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// quoteAPLString writes v as a double-quoted APL string literal.
+func quoteAPLString(v string) string {
+	return `"` + aplStringEscaper.Replace(v) + `"`
+}
+
+// quoteAPLIdentifier writes name as it's referenced in a query: as is when
+// it's a plain identifier that isn't a keyword, otherwise in the ["name"]
+// form.
+func quoteAPLIdentifier(name string) string {
+	if plainIdentifier.MatchString(name) && !aplReserved[name] {
+		return name
+	}
+	return "[" + quoteAPLString(name) + "]"
+}
+
+func jsQuoteAPLIdentifier(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+	return quoteAPLIdentifier(args[0].String())
+}
+
+func jsQuoteAPLString(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+	return quoteAPLString(args[0].String())
+}
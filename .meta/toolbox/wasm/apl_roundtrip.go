@@ -0,0 +1,95 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"reflect"
+	"syscall/js"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// roundTripTransforms are the rewrites RoundTripCheckAPL can check, all of
+// which promise to leave the tree alone.
+var roundTripTransforms = map[string]func(string) (string, error){
+	"format": formatAPL,
+	"minify": minifyAPL,
+}
+
+type roundTrip struct {
+	Output    string
+	FirstAST  string
+	SecondAST string // "" when Output doesn't parse
+	OutputErr error  // why Output doesn't parse
+	Stable    bool
+}
+
+// checkRoundTrip rewrites src with transform and compares the trees of the
+// two. Spans take no part, since moving text around is the point of a
+// rewrite. The error is for src itself not parsing.
+func checkRoundTrip(src string, transform func(string) (string, error)) (roundTrip, error) {
+	var rt roundTrip
+	var first ast.Doc
+	if err := validate.ParseAPL(src, &first); err != nil {
+		return rt, err
+	}
+	var err error
+	if rt.FirstAST, err = astToJSON(&first); err != nil {
+		return rt, err
+	}
+	if rt.Output, err = transform(src); err != nil {
+		return rt, err
+	}
+
+	var second ast.Doc
+	if rt.OutputErr = validate.ParseAPL(rt.Output, &second); rt.OutputErr != nil {
+		return rt, nil
+	}
+	if rt.SecondAST, err = astToJSON(&second); err != nil {
+		return rt, err
+	}
+	rt.Stable = subtreeKey(toASTNode(reflect.ValueOf(&first).Elem())) == subtreeKey(toASTNode(reflect.ValueOf(&second).Elem()))
+	return rt, nil
+}
+
+// jsRoundTripCheckAPL takes the source and optionally the transform,
+// "format" (the default) or "minify". It returns {valid, stable, output,
+// firstAST, secondAST, outputError}, the ASTs as ParseAPLToJSON gives them.
+// When the output doesn't parse, stable is false, secondAST null and
+// outputError says why. A source that doesn't parse is the usual invalid
+// result.
+func jsRoundTripCheckAPL(this js.Value, args []js.Value) any {
+	if len(args) < 1 || len(args) > 2 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected source and an optional transform")
+	}
+	transform := roundTripTransforms["format"]
+	if len(args) == 2 && !args[1].IsUndefined() {
+		var ok bool
+		if args[1].Type() == js.TypeString {
+			transform, ok = roundTripTransforms[args[1].String()]
+		}
+		if !ok {
+			return invalidArgs(`transform must be "format" or "minify"`)
+		}
+	}
+
+	rt, err := checkRoundTrip(args[0].String(), transform)
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("stable", rt.Stable)
+	result.Set("output", rt.Output)
+	result.Set("firstAST", rt.FirstAST)
+	result.Set("secondAST", js.Null())
+	result.Set("outputError", js.Null())
+	if rt.OutputErr != nil {
+		result.Set("outputError", rt.OutputErr.Error())
+	} else {
+		result.Set("secondAST", rt.SecondAST)
+	}
+	return result
+}
@@ -0,0 +1,89 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// rowReducing are the operators after which a filter no longer narrows
+// the scan, since it then filters their output rather than the dataset.
+var rowReducing = map[string]bool{
+	"count":       true,
+	"distinct":    true,
+	"make-series": true,
+	"summarize":   true,
+	"top":         true,
+}
+
+// unboundedScan returns the first dataset in src, let bindings included,
+// that a pipeline reads with no where or search ahead of its first
+// aggregation. Those are what narrow a scan, by time or by field; with
+// neither the whole dataset is read. It returns "" when every dataset is
+// filtered, or the query reads none directly.
+func unboundedScan(src string) (string, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return "", err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return "", err
+	}
+
+	bound := map[string]bool{}
+	for _, stages := range splitPipelines(significant(toks)) {
+		source := stages[0]
+		if len(source) >= 3 && source[0].Value == "let" && symbolOf(source[0]) == symIdent && isPunct(source[2], "=") {
+			bound[source[1].Value] = true
+			source = source[3:]
+		}
+		if len(source) != 1 && len(source) != 3 {
+			continue
+		}
+		dataset := datasetAt(source, 0)
+		if dataset == "" || bound[dataset] {
+			continue
+		}
+		filtered := false
+		for _, stage := range stages[1:] {
+			op, _ := stageOperator(stage)
+			if rowReducing[op] {
+				break
+			}
+			if op == "where" || op == "search" {
+				filtered = true
+				break
+			}
+		}
+		if !filtered {
+			return dataset, nil
+		}
+	}
+	return "", nil
+}
+
+// jsUnboundedScanWarningAPL returns {valid, unbounded, dataset}, dataset
+// being the one read in full, or null when unbounded is false.
+func jsUnboundedScanWarningAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	dataset, err := unboundedScan(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("unbounded", dataset != "")
+	result.Set("dataset", js.Null())
+	if dataset != "" {
+		result.Set("dataset", dataset)
+	}
+	return result
+}
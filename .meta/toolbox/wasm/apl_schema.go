@@ -0,0 +1,401 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// fieldError is a reference to a field the schema doesn't have at that
+// point of the pipeline.
+type fieldError struct {
+	Message string
+	Field   string
+	Line    int
+	Column  int
+}
+
+// checkFields reports every field reference in src that is missing from
+// schema, which maps dataset names to their columns. Each statement is
+// followed stage by stage, so columns added by extend, project or
+// summarize are known downstream and columns dropped by them are not.
+//
+// Checking a statement stops where its columns can no longer be told from
+// the text: at a join, union, parse or similar, or at a list entry nothing
+// names. Statements reading from a dataset the schema doesn't list aren't
+// checked at all. A dotted reference is found if it or any prefix of it is
+// a column, since object columns hold their own paths.
+//
+// A join still ends the check of its statement, but not before its on
+// keys are looked up in the columns of both sides, for a right side that
+// reads a dataset the schema lists through stages checkFields follows.
+// Keys missing there are the join errors.
+func checkFields(src string, schema map[string][]string) ([]fieldError, []joinKeyError, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, nil, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &fieldChecker{bound: map[string]bool{}, schema: schema}
+	for _, stages := range splitPipelines(significant(toks)) {
+		source := stages[0]
+		if len(source) > 1 && source[0].Value == "let" && symbolOf(source[0]) == symIdent {
+			c.bound[source[1].Value] = true
+			continue
+		}
+		if len(source) != 1 && len(source) != 3 {
+			continue
+		}
+		cols, ok := schema[datasetAt(source, 0)]
+		if !ok {
+			continue
+		}
+		c.cols = slices.Clone(cols)
+		for _, stage := range stages[1:] {
+			if !c.stage(stage) {
+				break
+			}
+		}
+	}
+	return c.errors, c.joinErrors, nil
+}
+
+// joinKeyError is a join key missing from one side of the join, Side
+// being "left" or "right".
+type joinKeyError struct {
+	Message string
+	Side    string
+	Key     string
+	Line    int
+	Column  int
+}
+
+type fieldChecker struct {
+	cols       []string        // columns at the current stage
+	bound      map[string]bool // names bound with let
+	schema     map[string][]string
+	errors     []fieldError
+	joinErrors []joinKeyError
+}
+
+// stage checks the references in one stage and moves cols past it. It
+// returns false once cols is unknown.
+func (c *fieldChecker) stage(stage []lexer.Token) bool {
+	op, args := stageOperator(stage)
+	switch op {
+	case "where", "sort", "order", "take", "limit", "top", "sample":
+		c.refs(args)
+		return true
+
+	case "count":
+		c.cols = []string{"Count"}
+		return true
+
+	case "extend", "project", "distinct":
+		var named []string
+		for _, item := range splitList(args) {
+			if _, expr, ok := aliased(item); ok {
+				c.refs(expr)
+			} else {
+				c.refs(item)
+			}
+			name, ok := columnName(item, false)
+			if !ok {
+				return false
+			}
+			named = append(named, name)
+		}
+		if op == "extend" {
+			named = append(c.cols, named...)
+		}
+		c.cols = named
+		return true
+
+	case "summarize":
+		aggs, keys := splitSummarize(args)
+		var named []string
+		for _, list := range []struct {
+			toks         []lexer.Token
+			aggregations bool
+		}{{keys, false}, {aggs, true}} {
+			for _, item := range splitList(list.toks) {
+				if _, expr, ok := aliased(item); ok {
+					c.refs(expr)
+				} else {
+					c.refs(item)
+				}
+				name, ok := columnName(item, list.aggregations)
+				if !ok {
+					return false
+				}
+				named = append(named, name)
+			}
+		}
+		c.cols = named
+		return true
+
+	case "project-away", "project-keep":
+		names := listColumns(args, false)
+		if names == nil {
+			// Wildcards and the like.
+			return false
+		}
+		c.refs(args)
+		if op == "project-away" {
+			c.cols = removeColumns(c.cols, names)
+		} else {
+			c.cols = slices.DeleteFunc(slices.Clone(c.cols), func(col string) bool { return !slices.Contains(names, col) })
+		}
+		return true
+
+	case "project-rename":
+		for _, item := range splitList(args) {
+			if len(item) == 3 && isPunct(item[1], "=") {
+				c.refs(item[2:])
+			}
+		}
+		c.cols = renameColumns(c.cols, args)
+		return c.cols != nil
+
+	case "join":
+		c.join(args)
+		return false
+	}
+	return false
+}
+
+// join checks the on keys of `join [kind=...] (right) on keys`. A key is
+// either a column both sides share or $left.a == $right.b. A right side
+// whose columns aren't known is left unchecked.
+func (c *fieldChecker) join(args []lexer.Token) {
+	open := slices.IndexFunc(args, func(tok lexer.Token) bool { return isPunct(tok, "(") })
+	if open < 0 {
+		return
+	}
+	closeIdx := open + 1
+	for depth := 1; closeIdx < len(args); closeIdx++ {
+		if isPunct(args[closeIdx], "(") {
+			depth++
+		} else if isPunct(args[closeIdx], ")") {
+			if depth--; depth == 0 {
+				break
+			}
+		}
+	}
+	if closeIdx+1 >= len(args) || args[closeIdx+1].Value != "on" {
+		return
+	}
+	right, rightKnown := c.columnsOf(args[open+1 : closeIdx])
+
+	check := func(side string, cols []string, key string, tok lexer.Token) {
+		if slices.Contains(cols, key) {
+			return
+		}
+		c.joinErrors = append(c.joinErrors, joinKeyError{
+			Message: fmt.Sprintf("join key %s is missing from the %s side", key, side),
+			Side:    side,
+			Key:     key,
+			Line:    tok.Pos.Line,
+			Column:  tok.Pos.Column,
+		})
+	}
+	for _, item := range splitList(args[closeIdx+2:]) {
+		if key, ok := columnName(item, false); ok {
+			check("left", c.cols, key, item[0])
+			if rightKnown {
+				check("right", right, key, item[0])
+			}
+			continue
+		}
+		eq := slices.IndexFunc(item, func(tok lexer.Token) bool { return tok.Value == "==" || tok.Value == "=" })
+		if eq <= 0 {
+			continue
+		}
+		rhs := item[eq+1:]
+		if item[eq].Value == "=" && len(rhs) > 0 && rhs[0].Value == "=" {
+			rhs = rhs[1:]
+		}
+		for _, ref := range [][]lexer.Token{item[:eq], rhs} {
+			if len(ref) == 0 {
+				continue
+			}
+			// However the lexer splits $left.a, its values join back up.
+			var text string
+			for _, tok := range ref {
+				text += tok.Value
+			}
+			if key, ok := strings.CutPrefix(text, "$left."); ok {
+				check("left", c.cols, key, ref[0])
+			} else if key, ok := strings.CutPrefix(text, "$right."); ok && rightKnown {
+				check("right", right, key, ref[0])
+			}
+		}
+	}
+}
+
+// columnsOf follows a parenthesized tabular expression the way checkFields
+// follows a statement, and returns its columns if they're known.
+func (c *fieldChecker) columnsOf(toks []lexer.Token) ([]string, bool) {
+	stages := splitPipelines(toks)[0]
+	source := stages[0]
+	if len(source) != 1 && len(source) != 3 {
+		return nil, false
+	}
+	name := datasetAt(source, 0)
+	cols, ok := c.schema[name]
+	if !ok || c.bound[name] {
+		return nil, false
+	}
+	sub := &fieldChecker{cols: slices.Clone(cols), bound: c.bound, schema: c.schema}
+	for _, stage := range stages[1:] {
+		if !sub.stage(stage) {
+			return nil, false
+		}
+	}
+	return sub.cols, true
+}
+
+// refs checks every field reference in an expression.
+func (c *fieldChecker) refs(toks []lexer.Token) {
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		var name string
+		switch {
+		case isPunct(tok, "[") && i+2 < len(toks) && symbolOf(toks[i+1]) == symString && isPunct(toks[i+2], "]"):
+			if prev := i - 1; prev >= 0 && ((symbolOf(toks[prev]) == symIdent && !aplReserved[toks[prev].Value]) ||
+				isPunct(toks[prev], "]") || isPunct(toks[prev], ")")) {
+				// Indexing into a value, not a column.
+				i += 2
+				continue
+			}
+			name = unquote(toks[i+1].Value)
+			i += 2
+		case symbolOf(tok) != symIdent || isCall(toks, i) || aplReserved[tok.Value] || c.bound[tok.Value]:
+			continue
+		case i > 0 && (isPunct(toks[i-1], ".") || toks[i-1].Value == "nulls"):
+			continue
+		case i+1 < len(toks) && isPunct(toks[i+1], "=") && (i+2 >= len(toks) || !isPunct(toks[i+2], "=")):
+			// A named argument or an alias.
+			continue
+		default:
+			name = tok.Value
+			for i+2 < len(toks) && isPunct(toks[i+1], ".") && symbolOf(toks[i+2]) == symIdent {
+				name += "." + toks[i+2].Value
+				i += 2
+			}
+		}
+		switch name {
+		case "true", "false", "null":
+			continue
+		}
+		if !c.known(name) {
+			c.errors = append(c.errors, fieldError{
+				Message: fmt.Sprintf("unknown field %s", name),
+				Field:   name,
+				Line:    tok.Pos.Line,
+				Column:  tok.Pos.Column,
+			})
+		}
+	}
+}
+
+func (c *fieldChecker) known(name string) bool {
+	for {
+		if slices.Contains(c.cols, name) {
+			return true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
+// schemaFromJS reads an object of dataset names to arrays of column names.
+func schemaFromJS(v js.Value) (map[string][]string, error) {
+	schema := make(map[string][]string)
+	keys := js.Global().Get("Object").Call("keys", v)
+	for i := 0; i < keys.Length(); i++ {
+		name := keys.Index(i).String()
+		cols := v.Get(name)
+		if !js.Global().Get("Array").Call("isArray", cols).Bool() {
+			return nil, fmt.Errorf("columns of dataset %s must be an array", name)
+		}
+		for j := 0; j < cols.Length(); j++ {
+			if cols.Index(j).Type() != js.TypeString {
+				return nil, fmt.Errorf("columns of dataset %s must be strings", name)
+			}
+			schema[name] = append(schema[name], cols.Index(j).String())
+		}
+	}
+	return schema, nil
+}
+
+// jsValidateAPLWithSchema is ValidateAPL plus a fieldErrors array of
+// {message, line, column, field} and a joinErrors array of {message, side,
+// key, line, column}. Syntax errors are reported as by ValidateAPL, in
+// which case both are empty; a query with field or join errors only is
+// invalid with a null error. Without a schema it is ValidateAPL.
+func jsValidateAPLWithSchema(this js.Value, args []js.Value) any {
+	if len(args) < 1 || len(args) > 2 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected source and an optional schema object")
+	}
+
+	var p validate.APLParser
+	src := args[0].String()
+	if len(args) == 1 || args[1].IsUndefined() || args[1].IsNull() {
+		return validateAPL(&p, src)
+	}
+	if args[1].Type() != js.TypeObject {
+		return invalidArgs("expected source and an optional schema object")
+	}
+	schema, err := schemaFromJS(args[1])
+	if err != nil {
+		return invalidArgs(err.Error())
+	}
+
+	result := validateAPL(&p, src)
+	fieldErrors := js.Global().Get("Array").New()
+	joinErrors := js.Global().Get("Array").New()
+	result.Set("fieldErrors", fieldErrors)
+	result.Set("joinErrors", joinErrors)
+	if !result.Get("valid").Bool() {
+		return result
+	}
+	errs, joinErrs, err := checkFields(src, schema)
+	if err != nil {
+		return invalidQuery(err)
+	}
+	for i, e := range errs {
+		obj := js.Global().Get("Object").New()
+		obj.Set("message", e.Message)
+		obj.Set("line", e.Line)
+		obj.Set("column", e.Column)
+		obj.Set("field", e.Field)
+		fieldErrors.SetIndex(i, obj)
+	}
+	for i, e := range joinErrs {
+		obj := js.Global().Get("Object").New()
+		obj.Set("message", e.Message)
+		obj.Set("side", e.Side)
+		obj.Set("key", e.Key)
+		obj.Set("line", e.Line)
+		obj.Set("column", e.Column)
+		joinErrors.SetIndex(i, obj)
+	}
+	result.Set("valid", len(errs) == 0 && len(joinErrs) == 0)
+	return result
+}
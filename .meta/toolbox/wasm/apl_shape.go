@@ -0,0 +1,342 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// Result shapes.
+const (
+	shapeTabular    = "tabular"
+	shapeScalar     = "scalar"
+	shapeTimeSeries = "timeseries"
+	shapeUnknown    = "unknown"
+)
+
+// resultShape is what the last statement of a query returns. Columns is nil
+// when the column names can't all be worked out from the text.
+type resultShape struct {
+	Shape   string
+	Columns []string
+}
+
+// shapePreserving are the operators that filter or reorder rows without
+// changing what they hold.
+var shapePreserving = map[string]bool{
+	"limit":  true,
+	"order":  true,
+	"sample": true,
+	"sort":   true,
+	"take":   true,
+	"where":  true,
+}
+
+// inferShape follows the pipeline of the last statement in src, stage by
+// stage. It's a reading of the text, not of the schema: the source's
+// columns are never known, so only stages that name their output produce
+// columns.
+func inferShape(src string) (resultShape, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return resultShape{}, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return resultShape{}, err
+	}
+	toks = significant(toks)
+
+	stages, _ := lastPipeline(toks)
+	shape := resultShape{Shape: shapeTabular}
+	if op, args := stageOperator(stages[0]); op == "print" {
+		shape.Columns = listColumns(args, false)
+	}
+	for _, stage := range stages[1:] {
+		shape = applyStage(shape, stage)
+	}
+	return shape, nil
+}
+
+// lastPipeline splits the last statement in toks into its pipeline stages,
+// the source being the first. It also returns how many statements there are.
+func lastPipeline(toks []lexer.Token) ([][]lexer.Token, int) {
+	pipelines := splitPipelines(toks)
+	return pipelines[len(pipelines)-1], len(pipelines)
+}
+
+// splitPipelines splits every statement in toks into its pipeline stages.
+// A trailing semicolon doesn't start another statement.
+func splitPipelines(toks []lexer.Token) [][][]lexer.Token {
+	pipelines := [][][]lexer.Token{{nil}}
+	depth := 0
+	for i, tok := range toks {
+		stages := pipelines[len(pipelines)-1]
+		switch {
+		case isPunct(tok, "(") || isPunct(tok, "["):
+			depth++
+		case (isPunct(tok, ")") || isPunct(tok, "]")) && depth > 0:
+			depth--
+		case depth == 0 && isPunct(tok, ";"):
+			if i+1 < len(toks) {
+				pipelines = append(pipelines, [][]lexer.Token{nil})
+			}
+			continue
+		case depth == 0 && isPunct(tok, "|"):
+			pipelines[len(pipelines)-1] = append(stages, nil)
+			continue
+		}
+		stages[len(stages)-1] = append(stages[len(stages)-1], tok)
+	}
+	return pipelines
+}
+
+func applyStage(shape resultShape, stage []lexer.Token) resultShape {
+	op, args := stageOperator(stage)
+	switch {
+	case shapePreserving[op]:
+		return shape
+	case op == "count":
+		return resultShape{Shape: shapeScalar, Columns: []string{"Count"}}
+	case op == "summarize":
+		return summarizeShape(args)
+	case op == "make-series":
+		return resultShape{Shape: shapeTimeSeries}
+	case op == "project" || op == "distinct":
+		shape.Columns = listColumns(args, false)
+		if op == "distinct" {
+			shape.Shape = shapeTabular
+		}
+		return shape
+	case op == "extend":
+		if shape.Columns != nil {
+			if added := listColumns(args, false); added != nil {
+				shape.Columns = append(shape.Columns, added...)
+			} else {
+				shape.Columns = nil
+			}
+		}
+		return shape
+	case op == "project-away":
+		if shape.Columns != nil {
+			shape.Columns = removeColumns(shape.Columns, listColumns(args, false))
+		}
+		return shape
+	case op == "project-rename":
+		if shape.Columns != nil {
+			shape.Columns = renameColumns(shape.Columns, args)
+		}
+		return shape
+	case op == "top":
+		return resultShape{Shape: shapeTabular, Columns: shape.Columns}
+	}
+	for _, name := range aplTabularOperators {
+		if name == op {
+			return resultShape{Shape: shapeTabular}
+		}
+	}
+	return resultShape{Shape: shapeUnknown}
+}
+
+// summarizeShape reads `summarize aggs [by keys]`. Grouping on a bin of
+// _time makes a time series; no grouping and a single aggregation makes a
+// scalar.
+func summarizeShape(args []lexer.Token) resultShape {
+	aggs, keys := splitSummarize(args)
+	shape := resultShape{Shape: shapeTabular}
+	items := splitList(keys)
+	switch {
+	case len(items) == 0 && len(splitList(aggs)) == 1:
+		shape.Shape = shapeScalar
+	default:
+		for _, item := range items {
+			if isTimeBin(item) {
+				shape.Shape = shapeTimeSeries
+			}
+		}
+	}
+	keyCols := listColumns(keys, false)
+	aggCols := listColumns(aggs, true)
+	if keyCols != nil && aggCols != nil {
+		shape.Columns = append(keyCols, aggCols...)
+	}
+	return shape
+}
+
+// splitSummarize splits the arguments of summarize into the aggregations
+// and the grouping keys after by.
+func splitSummarize(args []lexer.Token) (aggs, keys []lexer.Token) {
+	depth := 0
+	for i, tok := range args {
+		switch {
+		case isPunct(tok, "(") || isPunct(tok, "["):
+			depth++
+		case (isPunct(tok, ")") || isPunct(tok, "]")) && depth > 0:
+			depth--
+		case depth == 0 && symbolOf(tok) == symIdent && tok.Value == "by":
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// isTimeBin reports whether a grouping key is bin(_time, ...) or
+// bin_auto(_time).
+func isTimeBin(item []lexer.Token) bool {
+	if len(item) < 3 || !isCall(item, 0) || (item[0].Value != "bin" && item[0].Value != "bin_auto") {
+		return false
+	}
+	return symbolOf(item[2]) == symIdent && item[2].Value == "_time"
+}
+
+// stageOperator returns the tabular operator starting a stage, joining
+// hyphenated names the lexer may split, and the tokens after it.
+func stageOperator(stage []lexer.Token) (string, []lexer.Token) {
+	if len(stage) == 0 || symbolOf(stage[0]) != symIdent {
+		return "", nil
+	}
+	name, i := stage[0].Value, 1
+	for i+1 < len(stage) && isPunct(stage[i], "-") && symbolOf(stage[i+1]) == symIdent &&
+		stage[i].Pos.Offset == stage[i-1].Pos.Offset+len(stage[i-1].Value) &&
+		stage[i+1].Pos.Offset == stage[i].Pos.Offset+1 {
+		name += "-" + stage[i+1].Value
+		i += 2
+	}
+	return name, stage[i:]
+}
+
+// splitList splits toks on its top-level commas.
+func splitList(toks []lexer.Token) [][]lexer.Token {
+	if len(toks) == 0 {
+		return nil
+	}
+	var (
+		items [][]lexer.Token
+		cur   []lexer.Token
+		depth int
+	)
+	for _, tok := range toks {
+		switch {
+		case isPunct(tok, "(") || isPunct(tok, "["):
+			depth++
+		case (isPunct(tok, ")") || isPunct(tok, "]")) && depth > 0:
+			depth--
+		case depth == 0 && isPunct(tok, ","):
+			items = append(items, cur)
+			cur = nil
+			continue
+		}
+		cur = append(cur, tok)
+	}
+	return append(items, cur)
+}
+
+// listColumns names the columns a comma-separated list produces, or returns
+// nil if any of them can't be named. Unaliased aggregations are named the
+// way APL does it: count() is count_, avg(x) is avg_x.
+func listColumns(toks []lexer.Token, aggregations bool) []string {
+	items := splitList(toks)
+	cols := make([]string, 0, len(items))
+	for _, item := range items {
+		name, ok := columnName(item, aggregations)
+		if !ok {
+			return nil
+		}
+		cols = append(cols, name)
+	}
+	return cols
+}
+
+// aliased splits `name = expr` into its parts.
+func aliased(item []lexer.Token) (string, []lexer.Token, bool) {
+	switch {
+	case len(item) >= 3 && symbolOf(item[0]) == symIdent && isPunct(item[1], "="):
+		return item[0].Value, item[2:], true
+	case len(item) >= 5 && isPunct(item[0], "[") && symbolOf(item[1]) == symString && isPunct(item[2], "]") && isPunct(item[3], "="):
+		return unquote(item[1].Value), item[4:], true
+	}
+	return "", nil, false
+}
+
+func columnName(item []lexer.Token, aggregation bool) (string, bool) {
+	switch {
+	case len(item) >= 2 && symbolOf(item[0]) == symIdent && isPunct(item[1], "="):
+		return item[0].Value, true
+	case len(item) >= 4 && isPunct(item[0], "[") && symbolOf(item[1]) == symString && isPunct(item[2], "]") && isPunct(item[3], "="):
+		return unquote(item[1].Value), true
+	case len(item) == 1 && symbolOf(item[0]) == symIdent:
+		return item[0].Value, true
+	case len(item) == 3 && isPunct(item[0], "[") && symbolOf(item[1]) == symString && isPunct(item[2], "]"):
+		return unquote(item[1].Value), true
+	case isTimeBin(item):
+		return "_time", true
+	case aggregation && len(item) == 3 && isCall(item, 0) && isPunct(item[2], ")"):
+		return item[0].Value + "_", true
+	case aggregation && len(item) == 4 && isCall(item, 0) && symbolOf(item[2]) == symIdent && isPunct(item[3], ")"):
+		return item[0].Value + "_" + item[2].Value, true
+	}
+	return "", false
+}
+
+func removeColumns(cols, drop []string) []string {
+	if drop == nil {
+		return nil
+	}
+	gone := make(map[string]bool, len(drop))
+	for _, name := range drop {
+		gone[name] = true
+	}
+	kept := make([]string, 0, len(cols))
+	for _, name := range cols {
+		if !gone[name] {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+// renameColumns applies `project-rename new = old, ...`.
+func renameColumns(cols []string, args []lexer.Token) []string {
+	renamed := append([]string(nil), cols...)
+	for _, item := range splitList(args) {
+		if len(item) != 3 || !isPunct(item[1], "=") {
+			return nil
+		}
+		to, ok := columnName(item[:1], false)
+		from, ok2 := columnName(item[2:], false)
+		if !ok || !ok2 {
+			return nil
+		}
+		for i, name := range renamed {
+			if name == from {
+				renamed[i] = to
+			}
+		}
+	}
+	return renamed
+}
+
+func jsResultShapeAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	shape, err := inferShape(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("shape", shape.Shape)
+	if shape.Columns != nil {
+		result.Set("columns", jsStrings(shape.Columns))
+	} else {
+		result.Set("columns", js.Null())
+	}
+	return result
+}
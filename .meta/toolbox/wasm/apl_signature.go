@@ -0,0 +1,52 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// activeParameter counts the top-level commas between the opening paren of
+// the call at toks[i] and offset.
+func activeParameter(toks []lexer.Token, i, offset int) int {
+	n, depth := 0, 0
+	for _, tok := range toks[i+2:] {
+		if tok.Pos.Offset >= offset {
+			break
+		}
+		switch {
+		case isPunct(tok, "(") || isPunct(tok, "["):
+			depth++
+		case isPunct(tok, ")") || isPunct(tok, "]"):
+			depth--
+		case isPunct(tok, ",") && depth == 0:
+			n++
+		}
+	}
+	return n
+}
+
+func jsSignatureHelpAPL(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeNumber {
+		return invalidArgs("expected source and offset")
+	}
+
+	toks, err := lexAPL(args[0].String())
+	if err != nil {
+		return js.Null()
+	}
+	toks = significant(toks)
+	offset := args[1].Int()
+	i, ok := enclosingCall(toks, offset, true)
+	if !ok {
+		return js.Null()
+	}
+	name := toks[i].Value
+	result := js.Global().Get("Object").New()
+	result.Set("name", name)
+	result.Set("signature", aplFunctionDocs[name].Signature)
+	result.Set("activeParameter", activeParameter(toks, i, offset))
+	return result
+}
@@ -0,0 +1,138 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"strconv"
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// sortKey is one key of a sort, Field being the expression as written and
+// Direction "asc" or "desc".
+type sortKey struct {
+	Field     string
+	Direction string
+}
+
+// resetsOrder are the operators whose output rows are built anew, so no
+// earlier sort or limit carries over to them.
+var resetsOrder = map[string]bool{
+	"count":       true,
+	"distinct":    true,
+	"join":        true,
+	"lookup":      true,
+	"make-series": true,
+	"mv-expand":   true,
+	"summarize":   true,
+	"union":       true,
+}
+
+// sortLimit reads the order and row limit the last statement of src
+// returns its rows in. A later sort replaces an earlier one, while limits
+// keep the smallest. sort is nil when the rows come unsorted, limit -1 when
+// they are not limited or the limit isn't a literal.
+func sortLimit(src string) (sort []sortKey, limit int, err error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, -1, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	limit = -1
+	stages, _ := lastPipeline(significant(toks))
+	for _, stage := range stages[1:] {
+		op, args := stageOperator(stage)
+		switch {
+		case resetsOrder[op]:
+			sort, limit = nil, -1
+		case (op == "sort" || op == "order") && len(args) > 1 && args[0].Value == "by":
+			sort = nil
+			for _, item := range splitList(args[1:]) {
+				if len(item) > 0 {
+					sort = append(sort, sortKeyOf(src, item))
+				}
+			}
+		case op == "take" || op == "limit":
+			if n, ok := rowCount(args); ok && (limit < 0 || n < limit) {
+				limit = n
+			}
+		case op == "top" && len(args) > 2 && args[1].Value == "by":
+			sort = []sortKey{sortKeyOf(src, args[2:])}
+			if n, ok := rowCount(args[:1]); ok && (limit < 0 || n < limit) {
+				limit = n
+			}
+		}
+	}
+	return sort, limit, nil
+}
+
+// sortKeyOf reads one key of a sort or top, which APL sorts descending
+// unless told otherwise. A nulls first or nulls last is dropped.
+func sortKeyOf(src string, item []lexer.Token) sortKey {
+	key := sortKey{Direction: "desc"}
+	for len(item) > 1 {
+		last := item[len(item)-1]
+		switch {
+		case symbolOf(last) != symIdent:
+		case last.Value == "asc" || last.Value == "desc":
+			key.Direction = last.Value
+			item = item[:len(item)-1]
+			continue
+		case (last.Value == "first" || last.Value == "last") && len(item) > 2 && item[len(item)-2].Value == "nulls":
+			item = item[:len(item)-2]
+			continue
+		}
+		break
+	}
+	key.Field = tokenText(src, item)
+	return key
+}
+
+// rowCount reads a row count given as a single integer literal.
+func rowCount(toks []lexer.Token) (int, bool) {
+	if len(toks) != 1 || symbolOf(toks[0]) != symNumber {
+		return 0, false
+	}
+	n, err := strconv.Atoi(toks[0].Value)
+	return n, err == nil && n >= 0
+}
+
+// jsExtractSortLimitAPL returns {valid, sort, limit}, sort being the keys
+// in order as {field, direction} and limit the most rows returned, each
+// null when the query doesn't sort or limit its result.
+func jsExtractSortLimitAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	sort, limit, err := sortLimit(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("sort", js.Null())
+	if sort != nil {
+		keys := js.Global().Get("Array").New()
+		for i, k := range sort {
+			obj := js.Global().Get("Object").New()
+			obj.Set("field", k.Field)
+			obj.Set("direction", k.Direction)
+			keys.SetIndex(i, obj)
+		}
+		result.Set("sort", keys)
+	}
+	result.Set("limit", js.Null())
+	if limit >= 0 {
+		result.Set("limit", limit)
+	}
+	return result
+}
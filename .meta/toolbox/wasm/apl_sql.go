@@ -0,0 +1,594 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// The SQL written here is the subset of SQL:2008 below, plus % for the
+// remainder. It's meant for PostgreSQL, which takes all of it, but what
+// TestConvertAPLToSQL checks every translation against is this grammar,
+// not PostgreSQL's. Identifiers are double quoted, with "" for a quote, and
+// strings single quoted, with '' for one and no backslash escapes. Every
+// column reference is quoted, so APL names survive the trip with their
+// case.
+//
+//	query   = "SELECT" column {"," column} "FROM" source ["WHERE" expr]
+//	          ["GROUP BY" expr {"," expr}] ["ORDER BY" key {"," key}]
+//	          ["FETCH FIRST" number "ROWS ONLY"]
+//	column  = "*" | expr ["AS" ident]
+//	source  = ident | "(" query ")" "AS" name
+//	key     = expr ("ASC" | "DESC") "NULLS" ("FIRST" | "LAST")
+//	expr    = and {"OR" and}
+//	and     = not {"AND" not}
+//	not     = "NOT" not | sum [rhs]
+//	rhs     = ("=" | "<>" | "<" | "<=" | ">" | ">=") sum
+//	        | "IN" "(" expr {"," expr} ")"
+//	        | "BETWEEN" sum "AND" sum
+//	        | "LIKE" sum "ESCAPE" string
+//	        | "IS" ["NOT"] "NULL"
+//	sum     = product {("+" | "-") product}
+//	product = unary {("*" | "/" | "%") unary}
+//	unary   = ["-"] primary
+//	primary = number | string | ident | "TRUE" | "FALSE" | "NULL"
+//	        | "CURRENT_TIMESTAMP"
+//	        | "INTERVAL" string ("DAY" | "HOUR" | "MINUTE" | "SECOND")
+//	        | "CASE" "WHEN" expr "THEN" expr "END"
+//	        | "COUNT" "(" "*" ")" | function "(" ["DISTINCT"] expr {"," expr} ")"
+//	        | "(" expr ")"
+//	function = "COUNT" | "AVG" | "MAX" | "MIN" | "SUM" | "COALESCE"
+//	         | "ROUND" | "CHAR_LENGTH" | "LOWER" | "UPPER"
+
+// sqlUnsupportedError names an APL construct with no SQL translation.
+type sqlUnsupportedError struct {
+	what string
+}
+
+func (e sqlUnsupportedError) Error() string {
+	return "unsupported: " + e.what
+}
+
+// SQL clauses in the order a SELECT evaluates them. A stage that needs a
+// clause earlier than one already used wraps the query so far in a
+// subquery, since APL stages run strictly in sequence.
+const (
+	clauseFrom = iota
+	clauseWhere
+	clauseSelect
+	clauseOrder
+	clauseLimit
+)
+
+type sqlSelect struct {
+	from    string
+	where   []string
+	columns []string // nil for *
+	groupBy []string
+	orderBy []string
+	limit   string
+
+	clause int // last clause filled in
+	depth  int // subqueries wrapped so far, for naming them
+}
+
+// next makes the query ready for clause, wrapping it when clause can't be
+// added in place.
+func (q *sqlSelect) next(clause int) {
+	if clause < q.clause || (clause == q.clause && clause != clauseWhere) {
+		*q = sqlSelect{
+			from:  "(" + q.String() + ") AS t" + strconv.Itoa(q.depth+1),
+			depth: q.depth + 1,
+		}
+	}
+	q.clause = clause
+}
+
+func (q *sqlSelect) String() string {
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	if q.columns == nil {
+		sb.WriteString("*")
+	} else {
+		sb.WriteString(strings.Join(q.columns, ", "))
+	}
+	sb.WriteString("\nFROM " + q.from)
+	if len(q.where) > 0 {
+		sb.WriteString("\nWHERE " + strings.Join(q.where, " AND "))
+	}
+	if len(q.groupBy) > 0 {
+		sb.WriteString("\nGROUP BY " + strings.Join(q.groupBy, ", "))
+	}
+	if len(q.orderBy) > 0 {
+		sb.WriteString("\nORDER BY " + strings.Join(q.orderBy, ", "))
+	}
+	if q.limit != "" {
+		sb.WriteString("\nFETCH FIRST " + q.limit + " ROWS ONLY")
+	}
+	return sb.String()
+}
+
+// convertAPLToSQL translates a single-statement query made of where,
+// project, extend, summarize, sort, take and count stages.
+func convertAPLToSQL(src string) (string, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return "", err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return "", err
+	}
+	stages, statements := lastPipeline(significant(toks))
+	if statements > 1 {
+		return "", &sqlUnsupportedError{"multiple statements"}
+	}
+
+	q := &sqlSelect{}
+	if q.from, err = sqlSource(stages[0]); err != nil {
+		return "", err
+	}
+	for _, stage := range stages[1:] {
+		if err := sqlStage(q, stage); err != nil {
+			return "", err
+		}
+	}
+	return q.String(), nil
+}
+
+func sqlSource(toks []lexer.Token) (string, error) {
+	switch {
+	case len(toks) == 3 && isPunct(toks[0], "[") && symbolOf(toks[1]) == symString && isPunct(toks[2], "]"):
+		return sqlIdent(unquote(toks[1].Value)), nil
+	case len(toks) == 1 && symbolOf(toks[0]) == symIdent && !aplReserved[toks[0].Value]:
+		return sqlIdent(toks[0].Value), nil
+	case len(toks) > 0:
+		return "", &sqlUnsupportedError{"source " + toks[0].Value}
+	}
+	return "", &sqlUnsupportedError{"empty source"}
+}
+
+func sqlStage(q *sqlSelect, stage []lexer.Token) error {
+	op, args := stageOperator(stage)
+	switch op {
+	case "where":
+		cond, err := sqlExpr(args, false)
+		if err != nil {
+			return err
+		}
+		q.next(clauseWhere)
+		q.where = append(q.where, "("+cond+")")
+
+	case "project", "extend":
+		cols, err := sqlColumns(args, false)
+		if err != nil {
+			return err
+		}
+		q.next(clauseSelect)
+		if op == "extend" {
+			cols = append([]string{"*"}, cols...)
+		}
+		q.columns = cols
+
+	case "summarize":
+		aggs, keys := splitSummarize(args)
+		keyCols, err := sqlColumns(keys, false)
+		if err != nil {
+			return err
+		}
+		aggCols, err := sqlColumns(aggs, true)
+		if err != nil {
+			return err
+		}
+		q.next(clauseSelect)
+		q.columns = append(keyCols, aggCols...)
+		for _, item := range splitList(keys) {
+			if _, expr, ok := aliased(item); ok {
+				item = expr
+			}
+			key, _ := sqlExpr(item, false)
+			q.groupBy = append(q.groupBy, key)
+		}
+
+	case "count":
+		if len(args) > 0 {
+			return &sqlUnsupportedError{"count with arguments"}
+		}
+		q.next(clauseSelect)
+		q.columns = []string{`COUNT(*) AS "Count"`}
+
+	case "sort", "order":
+		if len(args) == 0 || args[0].Value != "by" {
+			return &sqlUnsupportedError{op + " without by"}
+		}
+		keys, err := sqlOrderBy(args[1:])
+		if err != nil {
+			return err
+		}
+		q.next(clauseOrder)
+		q.orderBy = keys
+
+	case "take", "limit":
+		if len(args) != 1 || symbolOf(args[0]) != symNumber || !sqlNumberRe.MatchString(args[0].Value) {
+			return &sqlUnsupportedError{op + " without a row count"}
+		}
+		q.next(clauseLimit)
+		q.limit = args[0].Value
+
+	default:
+		return &sqlUnsupportedError{"operator " + op}
+	}
+	return nil
+}
+
+// sqlColumns translates a project, extend or summarize list into select
+// columns, naming them the way APL would.
+func sqlColumns(toks []lexer.Token, aggregations bool) ([]string, error) {
+	var cols []string
+	for _, item := range splitList(toks) {
+		if name, expr, ok := aliased(item); ok {
+			s, err := sqlExpr(expr, aggregations)
+			if err != nil {
+				return nil, err
+			}
+			cols = append(cols, s+" AS "+sqlIdent(name))
+			continue
+		}
+		s, err := sqlExpr(item, aggregations)
+		if err != nil {
+			return nil, err
+		}
+		if name, ok := columnName(item, aggregations); ok && s != sqlIdent(name) {
+			s += " AS " + sqlIdent(name)
+		}
+		cols = append(cols, s)
+	}
+	return cols, nil
+}
+
+// sqlOrderBy translates sort keys. APL sorts descending unless told
+// otherwise, with nulls last when descending and first when ascending,
+// which SQL does the other way round, so both are always spelled out.
+func sqlOrderBy(toks []lexer.Token) ([]string, error) {
+	var keys []string
+	for _, item := range splitList(toks) {
+		dir := "DESC"
+		nulls := ""
+		for len(item) > 1 {
+			last := item[len(item)-1]
+			switch {
+			case symbolOf(last) != symIdent:
+			case last.Value == "asc" || last.Value == "desc":
+				dir = strings.ToUpper(last.Value)
+				item = item[:len(item)-1]
+				continue
+			case (last.Value == "first" || last.Value == "last") && len(item) > 2 && item[len(item)-2].Value == "nulls":
+				nulls = strings.ToUpper(last.Value)
+				item = item[:len(item)-2]
+				continue
+			}
+			break
+		}
+		if nulls == "" {
+			nulls = "LAST"
+			if dir == "ASC" {
+				nulls = "FIRST"
+			}
+		}
+		key, err := sqlExpr(item, false)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key+" "+dir+" NULLS "+nulls)
+	}
+	return keys, nil
+}
+
+var sqlOperators = map[string]string{
+	"==": "=", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">=",
+	"+": "+", "-": "-", "*": "*", "/": "/", "%": "%",
+	"(": "(", ")": ")", ",": ",",
+}
+
+// sqlKeywords are the APL words that carry over to SQL unchanged, apart
+// from case.
+var sqlKeywords = map[string]string{
+	"and": "AND", "or": "OR", "in": "IN",
+	"true": "TRUE", "false": "FALSE", "null": "NULL",
+}
+
+var sqlNumberRe = regexp.MustCompile(`^\d+(\.\d+)?([eE][+-]?\d+)?$`)
+
+// sqlLike maps the APL string operators to LIKE patterns; the case
+// insensitive ones compare lowered text.
+var sqlLike = map[string]struct {
+	prefix, suffix string
+	caseSensitive  bool
+}{
+	"contains":      {"%", "%", false},
+	"contains_cs":   {"%", "%", true},
+	"startswith":    {"", "%", false},
+	"startswith_cs": {"", "%", true},
+	"endswith":      {"%", "", false},
+	"endswith_cs":   {"%", "", true},
+}
+
+// sqlExpr translates a scalar expression. Aggregations are only allowed
+// when aggregations is set.
+func sqlExpr(toks []lexer.Token, aggregations bool) (string, error) {
+	if len(toks) == 0 {
+		return "", &sqlUnsupportedError{"empty expression"}
+	}
+	var out []string
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		switch {
+		case isPunct(tok, "[") && i+2 < len(toks) && symbolOf(toks[i+1]) == symString && isPunct(toks[i+2], "]"):
+			out = append(out, sqlIdent(unquote(toks[i+1].Value)))
+			i += 2
+
+		case sqlKeywords[tok.Value] != "" && symbolOf(tok) == symIdent:
+			out = append(out, sqlKeywords[tok.Value])
+
+		case isCall(toks, i):
+			args, closeIdx := callArgs(toks, i)
+			s, err := sqlCall(tok.Value, args, aggregations)
+			if err != nil {
+				return "", err
+			}
+			out = append(out, s)
+			i = closeIdx
+
+		case symbolOf(tok) == symIdent:
+			if like, ok := sqlLike[tok.Value]; ok {
+				if len(out) == 0 || i+1 >= len(toks) || symbolOf(toks[i+1]) != symString {
+					return "", &sqlUnsupportedError{tok.Value + " without a string literal"}
+				}
+				pattern := sqlString(like.prefix + sqlEscapeLike(unquote(toks[i+1].Value)) + like.suffix)
+				lhs := out[len(out)-1]
+				if !like.caseSensitive {
+					lhs, pattern = "LOWER("+lhs+")", "LOWER("+pattern+")"
+				}
+				out[len(out)-1] = lhs + " LIKE " + pattern + ` ESCAPE '\'`
+				i++
+				continue
+			}
+			if aplReserved[tok.Value] {
+				return "", &sqlUnsupportedError{"keyword " + tok.Value}
+			}
+			out = append(out, sqlIdent(tok.Value))
+
+		case symbolOf(tok) == symString:
+			out = append(out, sqlString(unquote(tok.Value)))
+
+		case symbolOf(tok) == symNumber:
+			if !sqlNumberRe.MatchString(tok.Value) {
+				return "", &sqlUnsupportedError{"literal " + tok.Value}
+			}
+			out = append(out, tok.Value)
+
+		default:
+			op, ok := sqlOperators[tok.Value]
+			if !ok {
+				return "", &sqlUnsupportedError{"operator " + tok.Value}
+			}
+			out = append(out, op)
+		}
+	}
+	return joinSQL(out), nil
+}
+
+// joinSQL puts single spaces between expression parts, none inside
+// parentheses or before commas.
+func joinSQL(parts []string) string {
+	var sb strings.Builder
+	for i, p := range parts {
+		if i > 0 && p != ")" && p != "," && parts[i-1] != "(" {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(p)
+	}
+	return sb.String()
+}
+
+var sqlAggregations = map[string]string{
+	"avg": "AVG",
+	"max": "MAX",
+	"min": "MIN",
+	"sum": "SUM",
+}
+
+var sqlScalars = map[string]string{
+	"coalesce": "COALESCE",
+	"round":    "ROUND",
+	"strlen":   "CHAR_LENGTH",
+	"tolower":  "LOWER",
+	"toupper":  "UPPER",
+}
+
+func sqlCall(name string, args [][]lexer.Token, aggregations bool) (string, error) {
+	if !sqlSupportedCall(name, aggregations) {
+		return "", &sqlUnsupportedError{"function " + name}
+	}
+	exprs := make([]string, len(args))
+	if name != "between" && name != "ago" {
+		for i, arg := range args {
+			s, err := sqlExpr(arg, false)
+			if err != nil {
+				return "", err
+			}
+			exprs[i] = s
+		}
+	}
+	one := func() error {
+		if len(args) != 1 {
+			return &sqlUnsupportedError{name + " with " + strconv.Itoa(len(args)) + " arguments"}
+		}
+		return nil
+	}
+
+	if fn, ok := sqlAggregations[name]; ok && aggregations {
+		if err := one(); err != nil {
+			return "", err
+		}
+		return fn + "(" + exprs[0] + ")", nil
+	}
+	switch {
+	case name == "count" && aggregations:
+		if len(args) == 0 {
+			return "COUNT(*)", nil
+		}
+		if err := one(); err != nil {
+			return "", err
+		}
+		return "COUNT(" + exprs[0] + ")", nil
+	case name == "dcount" && aggregations:
+		if err := one(); err != nil {
+			return "", err
+		}
+		return "COUNT(DISTINCT " + exprs[0] + ")", nil
+	case name == "countif" && aggregations:
+		if err := one(); err != nil {
+			return "", err
+		}
+		return "COUNT(CASE WHEN " + exprs[0] + " THEN 1 END)", nil
+	case name == "sumif" && aggregations:
+		if len(args) != 2 {
+			return "", &sqlUnsupportedError{"sumif with " + strconv.Itoa(len(args)) + " arguments"}
+		}
+		return "SUM(CASE WHEN " + exprs[1] + " THEN " + exprs[0] + " END)", nil
+	}
+
+	switch name {
+	case "isnull", "isnotnull", "isempty", "isnotempty", "not":
+		if err := one(); err != nil {
+			return "", err
+		}
+		x := exprs[0]
+		return map[string]string{
+			"isnull":     "(" + x + " IS NULL)",
+			"isnotnull":  "(" + x + " IS NOT NULL)",
+			"isempty":    "(" + x + " IS NULL OR " + x + " = '')",
+			"isnotempty": "(" + x + " IS NOT NULL AND " + x + " <> '')",
+			"not":        "(NOT " + x + ")",
+		}[name], nil
+	case "now":
+		if len(args) != 0 {
+			return "", &sqlUnsupportedError{"now with an offset"}
+		}
+		return "CURRENT_TIMESTAMP", nil
+	case "ago":
+		if err := one(); err != nil {
+			return "", err
+		}
+		interval, ok := sqlInterval(args[0])
+		if !ok {
+			return "", &sqlUnsupportedError{"ago without a timespan literal"}
+		}
+		return "(CURRENT_TIMESTAMP - " + interval + ")", nil
+	case "between":
+		// x between (from .. to) reaches here as a call on "between".
+		return sqlBetween(args)
+	}
+	return sqlScalars[name] + "(" + strings.Join(exprs, ", ") + ")", nil
+}
+
+func sqlSupportedCall(name string, aggregations bool) bool {
+	if _, ok := sqlScalars[name]; ok {
+		return true
+	}
+	if _, ok := sqlAggregations[name]; ok && aggregations {
+		return true
+	}
+	switch name {
+	case "count", "dcount", "countif", "sumif":
+		return aggregations
+	case "isnull", "isnotnull", "isempty", "isnotempty", "not", "now", "ago", "between":
+		return true
+	}
+	return false
+}
+
+func sqlBetween(args [][]lexer.Token) (string, error) {
+	if len(args) != 1 {
+		return "", &sqlUnsupportedError{"between without a range"}
+	}
+	fromToks, toToks, ok := splitRange(args[0])
+	if !ok {
+		return "", &sqlUnsupportedError{"between without a range"}
+	}
+	from, err := sqlExpr(fromToks, false)
+	if err != nil {
+		return "", err
+	}
+	to, err := sqlExpr(toToks, false)
+	if err != nil {
+		return "", err
+	}
+	return "BETWEEN " + from + " AND " + to, nil
+}
+
+// sqlInterval renders a timespan literal in the largest unit that divides
+// it.
+func sqlInterval(toks []lexer.Token) (string, bool) {
+	if len(toks) != 1 {
+		return "", false
+	}
+	d, ok := parseTimespan(toks[0].Value)
+	if !ok {
+		return "", false
+	}
+	for _, u := range []struct {
+		name string
+		size time.Duration
+	}{{"DAY", 24 * time.Hour}, {"HOUR", time.Hour}, {"MINUTE", time.Minute}, {"SECOND", time.Second}} {
+		if d%u.size == 0 {
+			return "INTERVAL '" + strconv.FormatInt(int64(d/u.size), 10) + "' " + u.name, true
+		}
+	}
+	return "INTERVAL '" + strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "' SECOND", true
+}
+
+func sqlIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sqlEscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func jsConvertAPLToSQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	sql, err := convertAPLToSQL(src)
+	if err != nil {
+		result.Set("ok", false)
+		result.Set("reason", err.Error())
+		return result
+	}
+	result.Set("ok", true)
+	result.Set("sql", sql)
+	return result
+}
@@ -0,0 +1,91 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"syscall/js"
+	"unicode"
+
+	"toolbox/validate"
+)
+
+// statementResult is the validity of one statement of a document. Start
+// and End are byte offsets of its text without surrounding whitespace.
+type statementResult struct {
+	Start, End int
+	Err        error
+}
+
+// validateStatements parses each statement of src on its own, so an error
+// in one doesn't hide the others. A statement using names bound by earlier
+// lets is parsed after those lets, the ones that are valid, since it means
+// nothing without them, and after the lets those use in turn. Blank statements, such as after a trailing ;, are
+// left out. When src can't be lexed there is nothing to split on and the
+// whole of it is one statement.
+func validateStatements(src string) []statementResult {
+	spans, ok := splitStatements(src)
+	if !ok {
+		spans = []statementSpan{{0, len(src)}}
+	}
+	deps := letDependencies(src, spans)
+	for i := range deps {
+		needs := slices.Clone(deps[i])
+		for _, dep := range deps[i] {
+			needs = append(needs, deps[dep]...)
+		}
+		slices.Sort(needs)
+		deps[i] = slices.Compact(needs)
+	}
+	valid := make([]bool, len(spans))
+	var p validate.APLParser
+	var out []statementResult
+	for i, span := range spans {
+		text := src[span.Start:span.End]
+		trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+		start := span.Start + len(text) - len(trimmed)
+		trimmed = strings.TrimRightFunc(trimmed, unicode.IsSpace)
+		if trimmed == "" && ok {
+			continue
+		}
+		var context strings.Builder
+		for _, dep := range deps[i] {
+			if valid[dep] {
+				context.WriteString(src[spans[dep].Start:spans[dep].End])
+				context.WriteString(";")
+			}
+		}
+		_, err := p.Validate(context.String() + trimmed)
+		valid[i] = err == nil
+		out = append(out, statementResult{Start: start, End: start + len(trimmed), Err: err})
+	}
+	return out
+}
+
+// jsValidateAPLStatements returns an array of {index, start, end, valid,
+// error, code}, one per statement, with byte offsets into the source as in
+// TokenizeAPL. error and code are null for a valid statement.
+func jsValidateAPLStatements(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	arr := js.Global().Get("Array").New()
+	for i, st := range validateStatements(args[0].String()) {
+		obj := js.Global().Get("Object").New()
+		obj.Set("index", i)
+		obj.Set("start", st.Start)
+		obj.Set("end", st.End)
+		obj.Set("valid", st.Err == nil)
+		obj.Set("error", js.Null())
+		obj.Set("code", js.Null())
+		if st.Err != nil {
+			e := validate.APLError(st.Err)
+			obj.Set("error", e.Message)
+			obj.Set("code", e.Code)
+		}
+		arr.SetIndex(i, obj)
+	}
+	return arr
+}
@@ -0,0 +1,66 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+type stringLiteral struct {
+	Value  string
+	Line   int
+	Column int
+}
+
+// extractStringLiterals returns every string literal in src, subqueries
+// included, unquoted. Quoted names like ['my-dataset'] or ['field.name']
+// are identifiers, not literals, and are left out.
+func extractStringLiterals(src string) ([]stringLiteral, error) {
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return nil, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, err
+	}
+	toks = significant(toks)
+	var lits []stringLiteral
+	for i, tok := range toks {
+		if symbolOf(tok) != symString {
+			continue
+		}
+		if i > 0 && isPunct(toks[i-1], "[") && i+1 < len(toks) && isPunct(toks[i+1], "]") {
+			continue
+		}
+		lits = append(lits, stringLiteral{Value: unquote(tok.Value), Line: tok.Pos.Line, Column: tok.Pos.Column})
+	}
+	return lits, nil
+}
+
+func jsExtractStringLiteralsAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	lits, err := extractStringLiterals(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	arr := js.Global().Get("Array").New()
+	for i, lit := range lits {
+		obj := js.Global().Get("Object").New()
+		obj.Set("value", lit.Value)
+		obj.Set("line", lit.Line)
+		obj.Set("column", lit.Column)
+		arr.SetIndex(i, obj)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("literals", arr)
+	return result
+}
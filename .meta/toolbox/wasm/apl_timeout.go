@@ -0,0 +1,84 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"errors"
+	"syscall/js"
+	"time"
+
+	"toolbox/validate"
+)
+
+var errValidationTimedOut = errors.New("validation timed out")
+
+// checkAPLContext is checkAPL that gives up when ctx is done. The parser
+// can't be interrupted, so it keeps going on its own goroutine and exits
+// once it's finished; the buffered channel means nobody has to be there to
+// receive. A panic in the parser is re-raised on the caller's goroutine.
+func checkAPLContext(ctx context.Context, src string) aplOutcome {
+	type outcome struct {
+		aplOutcome
+		panicked any
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{panicked: r}
+			}
+		}()
+		var p validate.APLParser
+		done <- outcome{aplOutcome: checkAPL(&p, src, validate.MaxAPLBytes)}
+	}()
+	select {
+	case o := <-done:
+		if o.panicked != nil {
+			panic(o.panicked)
+		}
+		return o.aplOutcome
+	case <-ctx.Done():
+		return aplOutcome{err: errValidationTimedOut}
+	}
+}
+
+// jsValidateAPLWithTimeout returns a Promise for the ValidateAPL result, or
+// for {valid:false, error:"validation timed out"} once timeoutMs has passed.
+// A zero or negative timeout means no limit, and the Promise rejects only
+// if the parser panics.
+//
+// The module runs Go on a single thread and the parser never yields, so
+// the deadline is only noticed between the parser's own pauses: it bounds
+// how long a caller waits on a slow query, not how long the thread is busy.
+// Run the module in a Web Worker to keep a pathological query off the UI
+// thread.
+func jsValidateAPLWithTimeout(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeNumber {
+		return js.Global().Get("Promise").Call("resolve", invalidArgs("expected source and timeoutMs"))
+	}
+
+	src := args[0].String()
+	timeout := time.Duration(args[1].Float() * float64(time.Millisecond))
+	var executor js.Func
+	executor = js.FuncOf(func(this js.Value, pargs []js.Value) any {
+		resolve, reject := pargs[0], pargs[1]
+		go func() {
+			defer executor.Release()
+			defer func() {
+				if r := recover(); r != nil {
+					reject.Invoke(internalError(r))
+				}
+			}()
+			ctx := context.Background()
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			resolve.Invoke(checkAPLContext(ctx, src).result())
+		}()
+		return nil
+	})
+	return js.Global().Get("Promise").New(executor)
+}
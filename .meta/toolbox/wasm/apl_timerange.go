@@ -0,0 +1,102 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// aplTimeRange is every explicit time construct in a query. Values are the
+// source text of the argument, e.g. "1h" or "datetime(2024-01-01)".
+type aplTimeRange struct {
+	Lookbacks []string    // ago() arguments
+	Bins      []string    // bin(_time, ...) intervals
+	Between   [][2]string // _time between (from .. to)
+}
+
+func (tr aplTimeRange) HasRange() bool {
+	return len(tr.Lookbacks)+len(tr.Bins)+len(tr.Between) > 0
+}
+
+func extractAPLTimeRange(src string) (aplTimeRange, error) {
+	var tr aplTimeRange
+	var doc ast.Doc
+	if err := validate.ParseAPL(src, &doc); err != nil {
+		return tr, err
+	}
+	toks, err := lexAPL(src)
+	if err != nil {
+		return tr, err
+	}
+	toks = significant(toks)
+
+	for i, tok := range toks {
+		switch {
+		case isCall(toks, i) && tok.Value == "ago":
+			if args, _ := callArgs(toks, i); len(args) == 1 {
+				tr.Lookbacks = append(tr.Lookbacks, tokenText(src, args[0]))
+			}
+		case isCall(toks, i) && tok.Value == "bin":
+			args, _ := callArgs(toks, i)
+			if len(args) == 2 && tokenText(src, args[0]) == "_time" {
+				tr.Bins = append(tr.Bins, tokenText(src, args[1]))
+			}
+		case tok.Value == "between" && i > 0 && toks[i-1].Value == "_time" && i+1 < len(toks) && isPunct(toks[i+1], "("):
+			// between is parsed like a call whose single argument is from .. to.
+			args, _ := callArgs(toks, i)
+			if len(args) != 1 {
+				continue
+			}
+			if from, to, ok := splitRange(args[0]); ok {
+				tr.Between = append(tr.Between, [2]string{tokenText(src, from), tokenText(src, to)})
+			}
+		}
+	}
+	return tr, nil
+}
+
+// splitRange splits the from .. to argument of between.
+func splitRange(arg []lexer.Token) (from, to []lexer.Token, ok bool) {
+	for j := range arg {
+		// The range dots may lex as one token or two.
+		switch {
+		case isPunct(arg[j], ".."):
+			return arg[:j], arg[j+1:], true
+		case isPunct(arg[j], ".") && j+1 < len(arg) && isPunct(arg[j+1], "."):
+			return arg[:j], arg[j+2:], true
+		}
+	}
+	return nil, nil, false
+}
+
+func jsExtractTimeRangeAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	tr, err := extractAPLTimeRange(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("hasRange", tr.HasRange())
+	if tr.HasRange() {
+		between := js.Global().Get("Array").New()
+		for i, b := range tr.Between {
+			obj := js.Global().Get("Object").New()
+			obj.Set("from", b[0])
+			obj.Set("to", b[1])
+			between.SetIndex(i, obj)
+		}
+		result.Set("lookbacks", jsStrings(tr.Lookbacks))
+		result.Set("bins", jsStrings(tr.Bins))
+		result.Set("between", between)
+	}
+	return result
+}
@@ -0,0 +1,98 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// Token classes reported to editors.
+const (
+	tokenKeyword    = "keyword"
+	tokenIdentifier = "identifier"
+	tokenString     = "string"
+	tokenNumber     = "number"
+	tokenOperator   = "operator"
+	tokenComment    = "comment"
+	tokenFunction   = "function"
+)
+
+type highlightToken struct {
+	Start int // byte offset, inclusive
+	End   int // byte offset, exclusive
+	Type  string
+}
+
+// tokenizeAPL classifies the kirby lexer's tokens for highlighting. It works
+// on queries that don't parse, since that's most of what an editor shows.
+func tokenizeAPL(src string) ([]highlightToken, error) {
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]highlightToken, 0, len(toks))
+	end := 0
+	for i, tok := range toks {
+		start := tok.Pos.Offset
+		if len(tok.Value) == 0 || start < end {
+			continue
+		}
+		typ := tokenClass(toks, i)
+		if typ == "" {
+			continue
+		}
+		end = start + len(tok.Value)
+		out = append(out, highlightToken{Start: start, End: end, Type: typ})
+	}
+	return out, nil
+}
+
+// tokenClass returns the highlight class of toks[i], or "" for whitespace.
+func tokenClass(toks []lexer.Token, i int) string {
+	tok := toks[i]
+	switch symbolOf(tok) {
+	case symWhitespace:
+		return ""
+	case symComment:
+		return tokenComment
+	case symString:
+		return tokenString
+	case symNumber:
+		return tokenNumber
+	case symIdent:
+		if i+1 < len(toks) && isPunct(toks[i+1], "(") {
+			return tokenFunction
+		}
+		if aplReserved[tok.Value] {
+			return tokenKeyword
+		}
+		return tokenIdentifier
+	}
+	return tokenOperator
+}
+
+func jsTokenizeAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	toks, err := tokenizeAPL(args[0].String())
+	if err != nil {
+		return invalidQuery(err)
+	}
+	return jsTokens(toks)
+}
+
+func jsTokens(toks []highlightToken) js.Value {
+	arr := js.Global().Get("Array").New()
+	for i, tok := range toks {
+		obj := js.Global().Get("Object").New()
+		obj.Set("start", tok.Start)
+		obj.Set("end", tok.End)
+		obj.Set("type", tok.Type)
+		arr.SetIndex(i, obj)
+	}
+	return arr
+}
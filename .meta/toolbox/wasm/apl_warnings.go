@@ -0,0 +1,52 @@
+//go:build js && wasm
+
+package main
+
+import "syscall/js"
+
+type warning struct {
+	Message     string
+	Line        int
+	Column      int
+	Replacement string
+}
+
+// deprecationWarnings returns a warning for every call to a function in
+// aplDeprecated. src must already have parsed.
+func deprecationWarnings(src string) []warning {
+	toks, err := lexAPL(src)
+	if err != nil {
+		return nil
+	}
+	toks = significant(toks)
+	var warnings []warning
+	for i, tok := range toks {
+		if !isCall(toks, i) {
+			continue
+		}
+		replacement, ok := aplDeprecated[tok.Value]
+		if !ok {
+			continue
+		}
+		warnings = append(warnings, warning{
+			Message:     tok.Value + "() is deprecated, use " + replacement + "() instead",
+			Line:        tok.Pos.Line,
+			Column:      tok.Pos.Column,
+			Replacement: replacement,
+		})
+	}
+	return warnings
+}
+
+func jsWarnings(warnings []warning) js.Value {
+	arr := js.Global().Get("Array").New()
+	for i, w := range warnings {
+		obj := js.Global().Get("Object").New()
+		obj.Set("message", w.Message)
+		obj.Set("line", w.Line)
+		obj.Set("column", w.Column)
+		obj.Set("replacement", w.Replacement)
+		arr.SetIndex(i, obj)
+	}
+	return arr
+}
@@ -25,11 +25,24 @@ command -v tinygo >/dev/null 2>&1 || {
 AXIOM_COMMIT="$(cd "$AXIOM_DIR" && git rev-parse HEAD)"
 GO_VER="$(go version | awk '{print $3}')"
 TINYGO_VER="$(tinygo version | awk '{print $3}')"
+BUILD_COMMIT="$(cd "$SCRIPT_DIR" && git rev-parse HEAD)"
 
 # ── APL parser (TinyGo) ──────────────────────────────────────────────
 echo "Building apl-parser.wasm from axiom1@${AXIOM_COMMIT:0:12} (tinygo $TINYGO_VER)..."
-cd "$AXIOM_DIR"
-tinygo build -target=wasm -o "$SCRIPT_DIR/apl-parser.wasm" "$SCRIPT_DIR/main.go"
+# Stage main.go, its apl_*.go siblings and the APL half of validate/ as the
+# toolbox module, in a workspace with axiom1 so the kirby import resolves.
+APL_TMP="$(mktemp -d)"
+cp "$SCRIPT_DIR/main.go" "$SCRIPT_DIR"/apl_*.go "$APL_TMP/"
+mkdir "$APL_TMP/validate"
+cp "$SCRIPT_DIR/validate/validate.go" "$SCRIPT_DIR/validate/cache.go" "$SCRIPT_DIR/validate/apl.go" "$APL_TMP/validate/"
+cd "$APL_TMP"
+go mod init toolbox
+go work init . "$AXIOM_DIR"
+tinygo build -target=wasm \
+  -ldflags="-X main.buildCommit=$BUILD_COMMIT -X main.aplParserVersion=$AXIOM_COMMIT" \
+  -o "$SCRIPT_DIR/apl-parser.wasm" .
+cd "$SCRIPT_DIR"
+rm -rf "$APL_TMP"
 
 TINYGO_ROOT="$(tinygo env TINYGOROOT)"
 cp "$TINYGO_ROOT/targets/wasm_exec.js" "$SCRIPT_DIR/wasm_exec.js"
@@ -39,20 +52,24 @@ echo "  apl-parser.wasm: $(wc -c < "$SCRIPT_DIR/apl-parser.wasm" | tr -d ' ') by
 # ── PromQL parser (standard Go) ──────────────────────────────────────
 echo "Building promql-parser.wasm (go $GO_VER)..."
 PROMQL_TMP="$(mktemp -d)"
-cp "$SCRIPT_DIR/promql_main.go" "$PROMQL_TMP/main.go"
+cp "$SCRIPT_DIR"/promql_*.go "$PROMQL_TMP/"
 # Remove the build constraint so it compiles as main
-sed -i '' '/^\/\/go:build ignore/d' "$PROMQL_TMP/main.go"
+sed -i '' '/^\/\/go:build ignore/d' "$PROMQL_TMP"/promql_*.go
+mkdir "$PROMQL_TMP/validate"
+cp "$SCRIPT_DIR/validate/validate.go" "$SCRIPT_DIR/validate/cache.go" "$SCRIPT_DIR/validate/promql.go" "$PROMQL_TMP/validate/"
 
 cd "$PROMQL_TMP"
-go mod init promql-validate
+go mod init toolbox
 go mod tidy
-GOOS=js GOARCH=wasm go build -o "$SCRIPT_DIR/promql-parser.wasm" .
+PROM_VER="$(go list -m -f '{{.Version}}' github.com/prometheus/prometheus)"
+GOOS=js GOARCH=wasm go build \
+  -ldflags="-X main.buildCommit=$BUILD_COMMIT" \
+  -o "$SCRIPT_DIR/promql-parser.wasm" .
 
 GOROOT="$(go env GOROOT)"
 cp "$GOROOT/lib/wasm/wasm_exec.js" "$SCRIPT_DIR/wasm_exec_go.js"
 
 rm -rf "$PROMQL_TMP"
-PROM_VER="$(grep 'prometheus/prometheus' "$PROMQL_TMP/go.mod" 2>/dev/null | awk '{print $2}' || echo 'unknown')"
 
 echo "  promql-parser.wasm: $(wc -c < "$SCRIPT_DIR/promql-parser.wasm" | tr -d ' ') bytes"
 
@@ -62,11 +79,13 @@ apl-parser.wasm:
   source: axiom1 pkg/kirby/apl/parser/ast/v2
   axiom1 commit: $AXIOM_COMMIT
   compiler: tinygo $TINYGO_VER
+  gilfoyle commit: $BUILD_COMMIT
   built: $(date -u +%Y-%m-%d)
 
 promql-parser.wasm:
-  source: github.com/prometheus/prometheus promql/parser
+  source: github.com/prometheus/prometheus $PROM_VER promql/parser
   compiler: $GO_VER
+  gilfoyle commit: $BUILD_COMMIT
   built: $(date -u +%Y-%m-%d)
 
 wasm_exec.js: tinygo $TINYGO_VER (for apl-parser.wasm)
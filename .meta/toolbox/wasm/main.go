@@ -3,33 +3,338 @@
 package main
 
 import (
+	"fmt"
 	"syscall/js"
 
-	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+	"toolbox/validate"
 )
 
-func jsValidateAPL(this js.Value, args []js.Value) any {
-	if len(args) != 1 || args[0].Type() != js.TypeString {
-		result := js.Global().Get("Object").New()
-		result.Set("valid", false)
-		result.Set("error", "expected 1 string argument")
-		return result
+// Set at build time with -ldflags "-X main.buildCommit=...", see build.sh.
+var (
+	buildCommit      = "unknown"
+	aplParserVersion = "unknown" // axiom1 commit the kirby parser came from
+)
+
+// errorPos is the location of a parse error, as reported to JS.
+type errorPos struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+// positionOf extracts the location kirby attaches to a parse error. It
+// returns false when the error carries no position.
+func positionOf(err error) (errorPos, bool) {
+	if err == nil {
+		return errorPos{}, false
 	}
+	e := validate.APLError(err)
+	return errorPos{Line: e.Line, Column: e.Column, Offset: e.Start}, e.HasPos
+}
+
+func setPosition(result js.Value, err error) {
+	pos, ok := positionOf(err)
+	if !ok {
+		result.Set("line", js.Null())
+		result.Set("column", js.Null())
+		result.Set("offset", js.Null())
+		return
+	}
+	result.Set("line", pos.Line)
+	result.Set("column", pos.Column)
+	result.Set("offset", pos.Offset)
+}
 
-	var doc ast.Doc
-	err := ast.Parse("query.apl", args[0].String(), &doc)
+// invalidArgs is the result for a call with the wrong arguments.
+func invalidArgs(msg string) js.Value {
 	result := js.Global().Get("Object").New()
-	if err != nil {
-		result.Set("valid", false)
-		result.Set("error", err.Error())
+	result.Set("valid", false)
+	result.Set("error", msg)
+	result.Set("code", validate.CodeInvalidArguments)
+	setPosition(result, nil)
+	return result
+}
+
+// internalError is the result for a call whose parser panicked with r.
+func internalError(r any) js.Value {
+	result := invalidArgs(fmt.Sprintf("internal parser error: %v", r))
+	result.Set("code", validate.CodeInternal)
+	return result
+}
+
+// invalidQuery is the result for a query that failed to parse. code is
+// the validate error code for err; error stays the parser's message.
+func invalidQuery(err error) js.Value {
+	result := js.Global().Get("Object").New()
+	result.Set("valid", false)
+	result.Set("error", err.Error())
+	result.Set("code", validate.APLError(err).Code)
+	setPosition(result, err)
+	return result
+}
+
+func jsStrings(values []string) js.Value {
+	arr := js.Global().Get("Array").New()
+	for i, v := range values {
+		arr.SetIndex(i, v)
+	}
+	return arr
+}
+
+// aplOutcome is what a ValidateAPL result is built from, kept apart from
+// the JS object so it can be cached and the caller still gets a fresh one.
+type aplOutcome struct {
+	err       error
+	code      string // overrides the code of err when set
+	warnings  []warning
+	unmatched *bracketPos // the bracket left open, nil if none is known
+}
+
+// Sources up to cacheMaxBytes are cached, so cacheSize entries stay small
+// even though the parser takes queries of up to validate.MaxAPLBytes.
+const (
+	cacheSize     = 256
+	cacheMaxBytes = 64 << 10
+)
+
+var aplCache = validate.NewCache[aplOutcome](cacheSize)
+
+// validateAPL runs p over src, rejecting sources over validate.MaxAPLBytes,
+// and adds the editor hints the validate package leaves out. Outcomes are
+// cached by source.
+func validateAPL(p *validate.APLParser, src string) js.Value {
+	if o, ok := aplCache.Get(src); ok {
+		return o.result()
+	}
+	o := checkAPL(p, src, validate.MaxAPLBytes)
+	if len(src) <= cacheMaxBytes {
+		aplCache.Add(src, o)
+	}
+	return o.result()
+}
+
+// validateAPLWithLimit is validateAPL for sources of at most limit bytes,
+// without the cache.
+func validateAPLWithLimit(p *validate.APLParser, src string, limit int) js.Value {
+	return checkAPL(p, src, limit).result()
+}
+
+func checkAPL(p *validate.APLParser, src string, limit int) aplOutcome {
+	if _, err := p.ValidateWithLimit(src, limit); err != nil {
+		return aplOutcome{err: err, unmatched: unmatchedOpen(src)}
+	}
+	return aplOutcome{warnings: deprecationWarnings(src)}
+}
+
+func (o aplOutcome) result() js.Value {
+	var result js.Value
+	if o.err != nil {
+		result = invalidQuery(o.err)
+		if o.code != "" {
+			result.Set("code", o.code)
+		}
+		if o.unmatched != nil {
+			result.Set("unmatchedOpen", jsBracketPos(o.unmatched))
+		}
 	} else {
+		result = js.Global().Get("Object").New()
 		result.Set("valid", true)
 		result.Set("error", js.Null())
+		result.Set("code", js.Null())
+		setPosition(result, nil)
 	}
+	result.Set("warnings", jsWarnings(o.warnings))
 	return result
 }
 
+// jsClearValidationCache empties the ValidateAPL cache, for when the editor
+// wants a fresh parse or a test wants a cold one.
+func jsClearValidationCache(this js.Value, args []js.Value) any {
+	aplCache.Clear()
+	return js.Undefined()
+}
+
+func jsValidateAPL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	var p validate.APLParser
+	return validateAPL(&p, args[0].String())
+}
+
+func jsValidateAPLWithLimit(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeNumber {
+		return invalidArgs("expected source and maxBytes")
+	}
+	limit := args[1].Float()
+	if limit < 0 || limit != float64(int(limit)) {
+		return invalidArgs("maxBytes must be a non-negative integer")
+	}
+
+	var p validate.APLParser
+	return validateAPLWithLimit(&p, args[0].String(), int(limit))
+}
+
+// jsValidateAPLAsync returns a Promise for the ValidateAPL result. The call
+// returns before parsing starts, but the parse still runs on the thread
+// that owns the module; only a Web Worker takes it off the UI thread. The
+// Promise rejects only if the parser panics. Each call parses with its own
+// state, but callers that interleave it with ValidateAPLIncremental or
+// anything else holding state between calls must order those themselves.
+func jsValidateAPLAsync(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return js.Global().Get("Promise").Call("resolve", invalidArgs("expected 1 string argument"))
+	}
+
+	src := args[0].String()
+	var executor js.Func
+	executor = js.FuncOf(func(this js.Value, pargs []js.Value) any {
+		resolve, reject := pargs[0], pargs[1]
+		go func() {
+			defer executor.Release()
+			defer func() {
+				if r := recover(); r != nil {
+					reject.Invoke(internalError(r))
+				}
+			}()
+			var p validate.APLParser
+			resolve.Invoke(validateAPL(&p, src))
+		}()
+		return nil
+	})
+	return js.Global().Get("Promise").New(executor)
+}
+
+func jsValidateAPLBatch(this js.Value, args []js.Value) any {
+	if len(args) != 1 || !js.Global().Get("Array").Call("isArray", args[0]).Bool() {
+		return invalidArgs("expected 1 array argument")
+	}
+
+	var p validate.APLParser
+	queries := args[0]
+	results := js.Global().Get("Array").New()
+	for i := 0; i < queries.Length(); i++ {
+		query := queries.Index(i)
+		if query.Type() != js.TypeString {
+			results.SetIndex(i, invalidArgs("expected string element"))
+			continue
+		}
+		results.SetIndex(i, validateAPL(&p, query.String()))
+	}
+	return results
+}
+
+// jsVersionInfo reports what this module was built from. It takes no
+// arguments and never fails. promqlParserVersion lives in the other module.
+func jsVersionInfo(this js.Value, args []js.Value) any {
+	result := js.Global().Get("Object").New()
+	result.Set("aplParserVersion", aplParserVersion)
+	result.Set("promqlParserVersion", js.Null())
+	result.Set("buildCommit", buildCommit)
+	return result
+}
+
+// jsCapabilities reports what this build offers: functions, the names of
+// everything it exports, and features, which languages it handles and
+// whether it converts between them. Like jsVersionInfo it takes no arguments
+// and never fails; a loader that loads both modules reads each one's.
+func jsCapabilities(this js.Value, args []js.Value) any {
+	features := js.Global().Get("Object").New()
+	features.Set("apl", true)
+	features.Set("promql", false)
+	features.Set("conversion", true)
+	result := js.Global().Get("Object").New()
+	result.Set("functions", jsStrings(exported))
+	result.Set("features", features)
+	return result
+}
+
+// exported lists, in order, the names export has installed.
+var exported []string
+
+// export installs fn on globalThis under name, guarded.
+func export(name string, fn func(js.Value, []js.Value) any) {
+	js.Global().Set(name, guarded(fn))
+	exported = append(exported, name)
+}
+
+// guarded wraps fn for JS so that a panic in a parser becomes an ordinary
+// invalid result instead of tearing down the whole module; stack
+// exhaustion is still fatal, as it is for any Go program.
+func guarded(fn func(js.Value, []js.Value) any) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) (result any) {
+		defer func() {
+			if r := recover(); r != nil {
+				result = internalError(r)
+			}
+		}()
+		return fn(this, args)
+	})
+}
+
 func main() {
-	js.Global().Set("ValidateAPL", js.FuncOf(jsValidateAPL))
+	exportAll()
 	select {}
 }
+
+// exportAll installs every export.
+func exportAll() {
+	export("ValidateAPL", jsValidateAPL)
+	export("ValidateAPLBatch", jsValidateAPLBatch)
+	export("ValidateAPLAll", jsValidateAPLAll)
+	export("CompleteAPL", jsCompleteAPL)
+	export("ExtractDatasetsAPL", jsExtractDatasetsAPL)
+	export("FormatAPL", jsFormatAPL)
+	export("TokenizeAPL", jsTokenizeAPL)
+	export("ParseAPLToJSON", jsParseAPLToJSON)
+	export("EstimateComplexityAPL", jsEstimateComplexityAPL)
+	export("ExtractTimeRangeAPL", jsExtractTimeRangeAPL)
+	export("APLVersionInfo", jsVersionInfo)
+	export("StripCommentsAPL", jsStripCommentsAPL)
+	export("FingerprintAPL", jsFingerprintAPL)
+	export("ExtractStringLiteralsAPL", jsExtractStringLiteralsAPL)
+	export("ValidateAPLIncremental", jsValidateAPLIncremental)
+	export("ValidateAPLWithLimit", jsValidateAPLWithLimit)
+	export("ListAPLBuiltins", jsListAPLBuiltins)
+	export("MinifyAPL", jsMinifyAPL)
+	export("HoverAPL", jsHoverAPL)
+	export("SignatureHelpAPL", jsSignatureHelpAPL)
+	export("ValidateAPLAsync", jsValidateAPLAsync)
+	export("ResultShapeAPL", jsResultShapeAPL)
+	export("ParseAPLPartial", jsParseAPLPartial)
+	export("ClearAPLValidationCache", jsClearValidationCache)
+	export("ExtractBinningAPL", jsExtractBinningAPL)
+	export("ConvertAPLToSQL", jsConvertAPLToSQL)
+	export("DiffAPL", jsDiffAPL)
+	export("ValidateAPLWithSchema", jsValidateAPLWithSchema)
+	export("ValidateAPLWithTimeout", jsValidateAPLWithTimeout)
+	export("ValidateAPLStatements", jsValidateAPLStatements)
+	export("HighlightAPLToHTML", jsHighlightAPLToHTML)
+	export("QueryMetricsAPL", jsQueryMetricsAPL)
+	export("SuggestNextStageAPL", jsSuggestNextStageAPL)
+	export("ValidateAPLWithPolicy", jsValidateAPLWithPolicy)
+	export("ValidateAPLWithFlags", jsValidateAPLWithFlags)
+	export("ExtractFiltersAPL", jsExtractFiltersAPL)
+	export("RoundTripCheckAPL", jsRoundTripCheckAPL)
+	export("CanonicalizeAPL", jsCanonicalizeAPL)
+	export("LintAPL", jsLintAPL)
+	export("ProjectedColumnsAPL", jsProjectedColumnsAPL)
+	export("ColumnDiffAPL", jsColumnDiffAPL)
+	export("ExplainAPL", jsExplainAPL)
+	export("ValidateAPLWithStageLimit", jsValidateAPLWithStageLimit)
+	export("IsCacheableAPL", jsIsCacheableAPL)
+	export("NodeAtOffsetAPL", jsNodeAtOffsetAPL)
+	export("AnalyzeAPL", jsAnalyzeAPL)
+	export("ValidateAPLAt", jsValidateAPLAt)
+	export("CreateAPLParser", jsCreateAPLParser)
+	export("QuoteAPLIdentifier", jsQuoteAPLIdentifier)
+	export("QuoteAPLString", jsQuoteAPLString)
+	export("UnboundedScanWarningAPL", jsUnboundedScanWarningAPL)
+	export("ExtractAggregationsAPL", jsExtractAggregationsAPL)
+	export("ClassifyAPL", jsClassifyAPL)
+	export("DeadStageCheckAPL", jsDeadStageCheckAPL)
+	export("ExtractSortLimitAPL", jsExtractSortLimitAPL)
+	export("ValidateAPLLSP", jsValidateAPLLSP)
+	export("APLCapabilities", jsCapabilities)
+}
@@ -0,0 +1,874 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall/js"
+	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+
+	"toolbox/validate"
+)
+
+// call invokes an export the way JS does, with each argument converted by
+// js.ValueOf. wasm_exec decodes Go strings with a TextDecoder, which drops
+// a leading BOM, so a string argument gets its BOM back on the JS side.
+func call(fn func(js.Value, []js.Value) any, args ...any) js.Value {
+	vals := make([]js.Value, len(args))
+	for i, arg := range args {
+		vals[i] = js.ValueOf(arg)
+		if s, ok := arg.(string); ok && strings.HasPrefix(s, "\ufeff") {
+			str := js.Global().Get("String")
+			vals[i] = str.Get("prototype").Get("concat").Call("call", str.Call("fromCharCode", 0xfeff), s[len("\ufeff"):])
+		}
+	}
+	return js.ValueOf(fn(js.Undefined(), vals))
+}
+
+// TestWindowsSources checks that the exports parsing on their own accept a
+// BOM and Windows line breaks, as ValidateAPL does.
+func TestWindowsSources(t *testing.T) {
+	exports := []struct {
+		name string
+		fn   func(js.Value, []js.Value) any
+	}{
+		{"ValidateAPL", jsValidateAPL},
+		{"ExtractDatasetsAPL", jsExtractDatasetsAPL},
+		{"ParseAPLToJSON", jsParseAPLToJSON},
+		{"ConvertAPLToSQL", jsConvertAPLToSQL},
+		{"ExplainAPL", jsExplainAPL},
+		{"FingerprintAPL", jsFingerprintAPL},
+		{"ClassifyAPL", jsClassifyAPL},
+		{"DeadStageCheckAPL", jsDeadStageCheckAPL},
+		{"ExtractSortLimitAPL", jsExtractSortLimitAPL},
+	}
+	for _, src := range []string{
+		"\ufeff['logs'] | where status == 500 | take 10",
+		"['logs']\r\n| where status == 500\r\n| take 10\r\n",
+		"['logs']\r| where status == 500\r| take 10",
+	} {
+		for _, e := range exports {
+			if result := call(e.fn, src); !result.Get("valid").Bool() {
+				t.Errorf("%s(%q) is invalid: %s", e.name, src, result.Get("error").String())
+			}
+		}
+	}
+}
+
+func TestWindowsSourcePositions(t *testing.T) {
+	src := "\ufeff['logs']\r\n| | take 10"
+	plain := "['logs']\n| | take 10"
+	got, want := call(jsValidateAPL, src), call(jsValidateAPL, plain)
+	if got.Get("valid").Bool() {
+		t.Fatalf("ValidateAPL(%q) is valid", src)
+	}
+	for _, field := range []string{"line", "column"} {
+		if g, w := got.Get(field).Int(), want.Get(field).Int(); g != w {
+			t.Errorf("ValidateAPL(%q) %s = %d, want %d", src, field, g, w)
+		}
+	}
+}
+
+func TestGuardedPanic(t *testing.T) {
+	fn := guarded(func(js.Value, []js.Value) any { panic("boom") })
+	defer fn.Release()
+	result := fn.Invoke()
+	if result.Get("valid").Bool() || result.Get("code").String() != validate.CodeInternal {
+		t.Errorf("guarded panic = valid %v, code %s", result.Get("valid").Bool(), result.Get("code").String())
+	}
+	if msg := result.Get("error").String(); !strings.Contains(msg, "boom") {
+		t.Errorf("guarded panic error %q doesn't carry the panic value", msg)
+	}
+}
+
+// TestExportErrorCodes checks the codes only the exports give, which
+// validate.ErrorCode never returns. CodeInternal is TestGuardedPanic's.
+func TestExportErrorCodes(t *testing.T) {
+	// ctx is done before the parser's goroutine gets to run.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name   string
+		result js.Value
+		code   string
+	}{
+		{"wrong arguments", call(jsValidateAPL, 42), validate.CodeInvalidArguments},
+		{"timeout", checkAPLContext(ctx, "['logs'] | take 10").result(), validate.CodeTimedOut},
+		{"disabled operator", call(jsValidateAPLWithFlags, "['logs'] | join kind=inner (['other']) on id", map[string]any{"experimentalJoins": false}), validate.CodeExperimentalDisabled},
+		{"stage limit", call(jsValidateAPLWithStageLimit, "['logs'] | take 10 | take 5", 1), validate.CodeTooManyStages},
+		{"policy", call(jsValidateAPLWithPolicy, "['logs'] | extend n = strlen(msg)", []any{"tolower"}).Get("policyErrors").Index(0), validate.CodeFunctionNotAllowed},
+	}
+	for _, tt := range tests {
+		if code := tt.result.Get("code").String(); code != tt.code {
+			t.Errorf("%s: code %s, want %s", tt.name, code, tt.code)
+		}
+	}
+}
+
+func TestExtractDatasets(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"['logs'] | where status == 500", []string{"logs"}},
+		{"logs | take 1", []string{"logs"}},
+		{"let t = ['a'] | take 1; t | join kind=inner (['b'] | where y == 1) on id", []string{"a", "b"}},
+		{"let recent = logs; recent | take 1", []string{"logs"}},
+		{"let since = now(); ['logs'] | where _time > since", []string{"logs"}},
+		{"let base = 5; let threshold = base + 1; ['logs'] | where n > threshold", []string{"logs"}},
+		{"let strict = true; ['logs'] | take 1", []string{"logs"}},
+		{"let n = 10; ['logs'] | take n", []string{"logs"}},
+		{"union ['x'], ['y']", []string{"x", "y"}},
+	}
+	for _, tt := range tests {
+		got, err := extractDatasets(tt.src)
+		if err != nil {
+			t.Errorf("extractDatasets(%q): %v", tt.src, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("extractDatasets(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+// The astNode schema only depends on how nodes are shaped, so it's pinned
+// here on a tree of stand-in types rather than on kirby's.
+type (
+	jsonDoc struct {
+		Pos    lexer.Position
+		EndPos lexer.Position
+		Stages []*jsonStage
+	}
+	jsonStage struct {
+		Pos      lexer.Position
+		Operator string
+		Limit    int
+		Negated  bool
+		Args     []any
+		Tokens   []lexer.Token
+	}
+	jsonIdent struct {
+		Pos  lexer.Position
+		Name string
+	}
+)
+
+func TestASTNodeSchema(t *testing.T) {
+	doc := jsonDoc{
+		EndPos: lexer.Position{Offset: 24, Line: 2, Column: 10},
+		Stages: []*jsonStage{
+			{Pos: lexer.Position{Offset: 0, Line: 1, Column: 1}, Operator: "take", Limit: 10, Tokens: []lexer.Token{{Value: "take"}, {Value: "10", Pos: lexer.Position{Offset: 5}}}},
+			nil,
+			{Pos: lexer.Position{Offset: 15, Line: 2, Column: 1}, Operator: "project", Args: []any{jsonIdent{Pos: lexer.Position{Offset: 23, Line: 2, Column: 9}, Name: "a"}}},
+		},
+	}
+	got, err := nodeToJSON(toASTNode(reflect.ValueOf(doc)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"jsonDoc","span":{"start":0,"end":24,"line":0,"column":0},"children":[` +
+		`{"type":"jsonStage","field":"Stages","span":{"start":0,"end":7,"line":1,"column":1},"attrs":{"Limit":10,"Operator":"take"}},` +
+		`{"type":"jsonStage","field":"Stages","span":{"start":15,"end":23,"line":2,"column":1},"attrs":{"Operator":"project"},"children":[` +
+		`{"type":"jsonIdent","field":"Args","span":{"start":23,"end":23,"line":2,"column":9},"attrs":{"Name":"a"}}]}]}`
+	if got != want {
+		t.Errorf("schema changed:\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestParseAPLToJSON checks the trees of real queries against the schema:
+// every span lies in the source, inside its parent's, and its line and
+// column agree with its offset.
+func TestParseAPLToJSON(t *testing.T) {
+	for _, src := range []string{
+		"['logs'] | where status == 500 | take 10",
+		"['logs']\n| summarize count() by bin(_time, 1m), ['service.name']\n| sort by count_ desc",
+		"let t = ['a'] | take 1; t | project x, y = x * 2",
+		"['é'] | where msg contains \"✓\"",
+	} {
+		result := call(jsParseAPLToJSON, src)
+		if !result.Get("valid").Bool() {
+			t.Errorf("ParseAPLToJSON(%q) is invalid: %s", src, result.Get("error").String())
+			continue
+		}
+		var root astNode
+		if err := json.Unmarshal([]byte(result.Get("ast").String()), &root); err != nil {
+			t.Fatalf("ParseAPLToJSON(%q): %v", src, err)
+		}
+		if root.Type != "Doc" {
+			t.Errorf("ParseAPLToJSON(%q) root is %s", src, root.Type)
+		}
+		checkSpans(t, src, &root, astSpan{End: len(src)})
+	}
+}
+
+func checkSpans(t *testing.T, src string, node *astNode, parent astSpan) {
+	t.Helper()
+	s := node.Span
+	if s.Start < parent.Start || s.End > parent.End || s.Start > s.End {
+		t.Errorf("%q: %s span %d-%d outside its parent's %d-%d", src, node.Type, s.Start, s.End, parent.Start, parent.End)
+		return
+	}
+	if s.Line > 0 {
+		lineStart := strings.LastIndexByte(src[:s.Start], '\n') + 1
+		line, column := strings.Count(src[:s.Start], "\n")+1, utf8.RuneCountInString(src[lineStart:s.Start])+1
+		if s.Line != line || s.Column != column {
+			t.Errorf("%q: %s at %d:%d, its offset %d is at %d:%d", src, node.Type, s.Line, s.Column, s.Start, line, column)
+		}
+	}
+	for _, c := range node.Children {
+		if c.Field == "" {
+			t.Errorf("%q: %s child %s has no field", src, node.Type, c.Type)
+		}
+		checkSpans(t, src, c, s)
+	}
+}
+
+func TestDiagnoseAPLLimit(t *testing.T) {
+	src := "['logs'] " + strings.Repeat("| | ", 2*maxDiagnostics)
+	if n := len(diagnoseAPL(src)); n != maxDiagnostics {
+		t.Errorf("diagnoseAPL reported %d errors, want %d", n, maxDiagnostics)
+	}
+}
+
+var exportOnce sync.Once
+
+// TestAdversarialInputs calls every export, as JS does, with inputs that
+// have made parsers panic or blow up elsewhere. A panic that escapes the
+// guard fails the whole test binary.
+func TestAdversarialInputs(t *testing.T) {
+	exportOnce.Do(exportAll)
+	const depth = 500
+	inputs := []string{
+		strings.Repeat("(", depth) + "x" + strings.Repeat(")", depth),
+		"['logs'] | where " + strings.Repeat("(", depth) + "x" + strings.Repeat(")", depth),
+		"['logs'] | where " + strings.Repeat("not(", depth) + "x" + strings.Repeat(")", depth),
+		"['logs'] | where " + strings.Repeat("(", depth),
+		"['logs'] | " + strings.Repeat("| ", depth),
+		strings.Repeat("a", 1<<16),
+		"['" + strings.Repeat("a", 1<<16) + "'] | take 1",
+		"['logs'] | extend " + strings.Repeat("x + ", depth) + "x",
+		"\"" + strings.Repeat(`\`, 1<<12),
+		"\x00\xff\ufeff",
+	}
+	for _, name := range exported {
+		fn := js.Global().Get(name)
+		for _, src := range inputs {
+			fn.Invoke(src)
+			fn.Invoke(src, src)
+		}
+	}
+}
+
+// withoutSpans drops the spans of node and its children, leaving what the
+// tree says rather than where.
+func withoutSpans(node *astNode) *astNode {
+	node.Span = astSpan{}
+	for _, c := range node.Children {
+		withoutSpans(c)
+	}
+	return node
+}
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"['logs'] // all of them\n| take 10", "['logs'] \n| take 10"},
+		{"// leading\n['logs'] | take 10", "\n['logs'] | take 10"},
+		{"['logs'] | where msg == \"// not a comment\" // but this is", "['logs'] | where msg == \"// not a comment\" "},
+		{"['logs']\r\n// who: alice@example.com\r\n| take 10\r\n", "['logs']\r\n\r\n| take 10\r\n"},
+		{"['logs'] | take 10 // trailing", "['logs'] | take 10 "},
+		{"\ufeff['logs'] // all\r\n| take 10", "\ufeff['logs'] \r\n| take 10"},
+	}
+	for _, tt := range tests {
+		got, err := stripComments(tt.src)
+		if err != nil {
+			t.Errorf("stripComments(%q): %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("stripComments(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+		var orig, stripped ast.Doc
+		if err := validate.ParseAPL(tt.src, &orig); err != nil {
+			t.Fatalf("ParseAPL(%q): %v", tt.src, err)
+		}
+		if err := validate.ParseAPL(got, &stripped); err != nil {
+			t.Errorf("stripComments(%q) doesn't parse: %v", tt.src, err)
+			continue
+		}
+		a, _ := nodeToJSON(withoutSpans(toASTNode(reflect.ValueOf(orig))))
+		b, _ := nodeToJSON(withoutSpans(toASTNode(reflect.ValueOf(stripped))))
+		if a != b {
+			t.Errorf("stripComments(%q) parses to\n%s\nwant\n%s", tt.src, b, a)
+		}
+	}
+}
+
+// TestValidateIncremental applies a run of edits and checks after each
+// that the incremental result is the one a cold cache gives.
+func TestValidateIncremental(t *testing.T) {
+	src := "['a'] | take 1; ['b'] | where x == 1; ['c'] | count"
+	reused := false
+	// edit applies an edit through the cache and checks the result against
+	// a cold validation of the edited source, leaving the cache as the
+	// edit left it.
+	edit := func(start, end int, text string) {
+		t.Helper()
+		got, incremental := validateIncremental(src, start, end, text)
+		reused = reused || incremental
+		prev := src
+		src = src[:start] + text + src[end:]
+
+		cache := statementCache
+		statementCache.source, statementCache.diags = "", nil
+		want, _ := validateIncremental(src, 0, 0, "")
+		statementCache = cache
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("replacing %d-%d of %q with %q: incremental %+v, full %+v", start, end, prev, text, got, want)
+		}
+	}
+
+	statementCache.source, statementCache.diags = "", nil
+	validateIncremental(src, 0, 0, "")
+	for _, e := range []struct {
+		old, new string
+	}{
+		{"take 1", "take"},
+		{"x == 1", "x =="},
+		{"take", "take 5"},
+		{"count", "count | |"},
+		{"; ['c']", "\n; ['c']"},
+		{"x ==", "x == 2"},
+	} {
+		start := strings.Index(src, e.old)
+		edit(start, start+len(e.old), e.new)
+	}
+
+	// Random edits, from sources with separators inside strings and
+	// comments, with replacements that open, close or split them.
+	seeds := []string{
+		"['a'] | take 1; ['b'] | where x == 1; ['c'] | count",
+		"['a'] | where msg == \"x;y\" | take 1; ['b'] | count",
+		"['a'] // first; not a separator\n| take 1; ['b'] | where s == 'q;' | count",
+		"['a'] | where x == 1;\n['b'] | summarize count() by y;\n['c'] | take 2",
+	}
+	pieces := []string{
+		"", ";", " ", "\n", "\"", "'", "//", "// c;\n", "\"a;b\"", "|", "| take 1",
+		"where x == 1", "x ==", "(", ")", "['d']", "count", "; ['e'] | take 3",
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		if i%50 == 0 || len(src) > 200 {
+			src = seeds[rng.Intn(len(seeds))]
+			statementCache.source, statementCache.diags = "", nil
+			validateIncremental(src, 0, 0, "")
+		}
+		start := rng.Intn(len(src) + 1)
+		end := min(len(src), start+rng.Intn(8))
+		text := pieces[rng.Intn(len(pieces))]
+		if rng.Intn(4) == 0 {
+			text += pieces[rng.Intn(len(pieces))]
+		}
+		edit(start, end, text)
+	}
+	if !reused {
+		t.Error("no edit reused the cache")
+	}
+}
+
+func TestValidateIncrementalLet(t *testing.T) {
+	prev := "let t = ['a'] | take 1; t | where x == 1"
+	validateIncremental(prev, 0, 0, "")
+	start := strings.Index(prev, "x == 1")
+	got, incremental := validateIncremental(prev, start, start+len("x == 1"), "x ==")
+	if incremental {
+		t.Error("a statement using a let was validated on its own")
+	}
+	src := strings.Replace(prev, "x == 1", "x ==", 1)
+	if want := diagnoseAPL(src); !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateAPLIncremental(%q) = %+v, want %+v", src, got, want)
+	}
+}
+
+func TestLetDependencies(t *testing.T) {
+	tests := []struct {
+		src  string
+		want [][]int
+	}{
+		{"['a'] | take 1; ['b'] | count", [][]int{nil, nil}},
+		{"let t = ['a']; t | take 1", [][]int{nil, {0}}},
+		{"let t = ['a']; ['t'] | take 1", [][]int{nil, {0}}},
+		{"let n = 1; let m = n + 1; ['a'] | take m", [][]int{nil, {0}, {1}}},
+		{"['a'] | extend t = 1; let t = 2", [][]int{nil, nil}},
+	}
+	for _, tt := range tests {
+		spans, _ := splitStatements(tt.src)
+		if got := letDependencies(tt.src, spans); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("letDependencies(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestValidateStatements(t *testing.T) {
+	src := "let t = ['a'] | take 1; t | where x ==; t | take 1; ['b'] | | ;"
+	got := validateStatements(src)
+	want := []string{"let t = ['a'] | take 1", "t | where x ==", "t | take 1", "['b'] | |"}
+	if len(got) != len(want) {
+		t.Fatalf("validateStatements(%q) returned %d statements, want %d", src, len(got), len(want))
+	}
+	for i, st := range got {
+		if text := src[st.Start:st.End]; text != want[i] {
+			t.Errorf("statement %d is %q, want %q", i, text, want[i])
+		}
+		if invalid := i == 1 || i == 3; (st.Err != nil) != invalid {
+			t.Errorf("statement %d (%q) has error %v", i, want[i], st.Err)
+		}
+	}
+}
+
+func TestDeadStages(t *testing.T) {
+	tests := []struct {
+		src  string
+		dead []int // lines of the stages flagged
+	}{
+		{"['a']\n| take 0\n| where x == 1\n| project x", []int{3, 4}},
+		{"['a']\n| where 1 > 2\n| extend y = 1", []int{3}},
+		{"['a']\n| where x == 1\n| take 10", nil},
+		{"['a']\n| take 0\n| count\n| extend y = 1", nil},
+		{"['a']\n| take 0\n| where x == 1\n| summarize count()\n| extend y = 1", []int{3}},
+		{"['a']\n| take 0\n| summarize count() by x\n| extend y = 1", []int{3, 4}},
+		{"['a']\n| take 0\n| union (['b'])\n| take 5", nil},
+		{"['a']\n| take 0\n| join kind=rightouter (['b']) on id\n| take 5", nil},
+		{"['a']\n| take 0\n| join kind=inner (['b']) on id\n| take 5", []int{3, 4}},
+		{"['a']\n| take 0\n| count\n| where false\n| take 5", []int{5}},
+	}
+	for _, tt := range tests {
+		findings, err := deadStages(tt.src)
+		if err != nil {
+			t.Errorf("deadStages(%q): %v", tt.src, err)
+			continue
+		}
+		var lines []int
+		for _, f := range findings {
+			lines = append(lines, f.Pos.Line)
+		}
+		if !slices.Equal(lines, tt.dead) {
+			t.Errorf("deadStages(%q) flags lines %v, want %v", tt.src, lines, tt.dead)
+		}
+	}
+}
+
+func TestListAPLBuiltins(t *testing.T) {
+	result := call(jsListAPLBuiltins)
+	if result.Get("functionsComplete").Bool() {
+		t.Error("ListAPLBuiltins claims its functions are complete")
+	}
+	if n := result.Get("functions").Length(); n != len(aplFunctions) {
+		t.Errorf("ListAPLBuiltins has %d functions, the catalog %d", n, len(aplFunctions))
+	}
+	has := func(list, name string) bool {
+		v := result.Get(list)
+		for i := 0; i < v.Length(); i++ {
+			if v.Index(i).String() == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, op := range []string{"|", "==", "(", ";"} {
+		if !has("operators", op) {
+			t.Errorf("ListAPLBuiltins operators lack %q", op)
+		}
+	}
+	for _, kw := range []string{"where", "project", "summarize", "by", "take"} {
+		if !has("keywords", kw) {
+			t.Errorf("ListAPLBuiltins keywords lack %q", kw)
+		}
+	}
+}
+
+func TestGrammarTag(t *testing.T) {
+	tests := []struct {
+		tag  reflect.StructTag
+		want string
+	}{
+		{`"where" @@`, `"where" @@`},
+		{`parser:"'by' @@" json:"by"`, `'by' @@`},
+		{`json:"name"`, ""},
+	}
+	for _, tt := range tests {
+		if got := grammarTag(tt.tag); got != tt.want {
+			t.Errorf("grammarTag(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+// settlement is how a fakePromise was settled.
+type settlement struct {
+	rejected bool
+	value    js.Value
+}
+
+// fakePromise stands in for the global Promise for the duration of the
+// test, sending what each promise settles with to the channel it returns.
+func fakePromise(t *testing.T) <-chan settlement {
+	settled := make(chan settlement, 8)
+	settle := func(rejected bool) js.Func {
+		return js.FuncOf(func(this js.Value, args []js.Value) any {
+			settled <- settlement{rejected, args[0]}
+			return nil
+		})
+	}
+	resolve, reject := settle(false), settle(true)
+	ctor := js.FuncOf(func(this js.Value, args []js.Value) any {
+		args[0].Invoke(resolve, reject)
+		return js.Global().Get("Object").New()
+	})
+	ctor.Set("resolve", js.FuncOf(func(this js.Value, args []js.Value) any {
+		resolve.Invoke(args[0])
+		return js.Global().Get("Object").New()
+	}))
+	orig := js.Global().Get("Promise")
+	js.Global().Set("Promise", ctor)
+	t.Cleanup(func() { js.Global().Set("Promise", orig) })
+	return settled
+}
+
+func TestValidateAPLAsync(t *testing.T) {
+	settled := fakePromise(t)
+	for _, src := range []string{"['logs'] | take 10", "['logs'] | | take 10"} {
+		call(jsValidateAPLAsync, src)
+		s := <-settled
+		want := call(jsValidateAPL, src)
+		if s.rejected || s.value.Get("valid").Bool() != want.Get("valid").Bool() || s.value.Get("code").String() != want.Get("code").String() {
+			t.Errorf("ValidateAPLAsync(%q) settled with %v (rejected %v), ValidateAPL gives %v", src, s.value, s.rejected, want)
+		}
+	}
+
+	call(jsValidateAPLWithTimeout, "['logs'] | take 10", 1000)
+	if s := <-settled; s.rejected || !s.value.Get("valid").Bool() {
+		t.Errorf("ValidateAPLWithTimeout settled with %v (rejected %v)", s.value, s.rejected)
+	}
+
+	call(jsValidateAPLAsync, 42)
+	if s := <-settled; s.rejected || s.value.Get("code").String() != validate.CodeInvalidArguments {
+		t.Errorf("ValidateAPLAsync(42) settled with %v (rejected %v)", s.value, s.rejected)
+	}
+}
+
+const benchAPL = "['logs']\n| where status >= 500 and ['service.name'] == \"api\"\n| summarize count(), avg(duration) by bin(_time, 1m), host\n| sort by count_ desc\n| take 20"
+
+// BenchmarkValidateAPL compares a cache hit with a cold parse of the same
+// query. A hit only pays for building the result object.
+func BenchmarkValidateAPL(b *testing.B) {
+	args := []js.Value{js.ValueOf(benchAPL)}
+	b.Run("cold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			jsClearValidationCache(js.Undefined(), nil)
+			jsValidateAPL(js.Undefined(), args)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		jsValidateAPL(js.Undefined(), args)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			jsValidateAPL(js.Undefined(), args)
+		}
+	})
+}
+
+func TestConvertAPLToSQL(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // the SQL, or the error
+	}{
+		{
+			`['logs'] | where status == 500 and method in ("GET", "POST") | project a, b = tolower(c)`,
+			"SELECT \"a\", LOWER(\"c\") AS \"b\"\nFROM \"logs\"\nWHERE (\"status\" = 500 AND \"method\" IN ('GET', 'POST'))",
+		},
+		{
+			`['logs'] | where _time > ago(1h) | summarize count(), avg(dur), dcount(user) by host | sort by count_ | take 10`,
+			"SELECT \"host\", COUNT(*) AS \"count_\", AVG(\"dur\") AS \"avg_dur\", COUNT(DISTINCT \"user\") AS \"dcount_user\"\nFROM \"logs\"\n" +
+				"WHERE (\"_time\" > (CURRENT_TIMESTAMP - INTERVAL '1' HOUR))\nGROUP BY \"host\"\nORDER BY \"count_\" DESC NULLS LAST\nFETCH FIRST 10 ROWS ONLY",
+		},
+		{
+			`['logs'] | where msg contains "50%_x" | count`,
+			"SELECT COUNT(*) AS \"Count\"\nFROM \"logs\"\nWHERE (LOWER(\"msg\") LIKE LOWER('%50\\%\\_x%') ESCAPE '\\')",
+		},
+		{
+			`['logs'] | take 5 | where x != 1`,
+			"SELECT *\nFROM (SELECT *\nFROM \"logs\"\nFETCH FIRST 5 ROWS ONLY) AS t1\nWHERE (\"x\" <> 1)",
+		},
+		{
+			`['logs'] | where x between (1 .. 5) | order by x asc`,
+			"SELECT *\nFROM \"logs\"\nWHERE (\"x\" BETWEEN 1 AND 5)\nORDER BY \"x\" ASC NULLS FIRST",
+		},
+		{
+			`['logs'] | extend y = x * 2 | where y > 3`,
+			"SELECT *\nFROM (SELECT *, \"x\" * 2 AS \"y\"\nFROM \"logs\") AS t1\nWHERE (\"y\" > 3)",
+		},
+		{
+			`['logs'] | where isempty(msg) or not(ok) | summarize countif(x > 1) by k`,
+			"SELECT \"k\", COUNT(CASE WHEN \"x\" > 1 THEN 1 END)\nFROM \"logs\"\nWHERE ((\"msg\" IS NULL OR \"msg\" = '') OR (NOT \"ok\"))\nGROUP BY \"k\"",
+		},
+		{
+			`['logs'] | where isnotnull(a) and strlen(b) >= 3 | extend c = round(coalesce(d, 0) / 2) | sort by c asc nulls last`,
+			"SELECT *, ROUND(COALESCE(\"d\", 0) / 2) AS \"c\"\nFROM \"logs\"\nWHERE ((\"a\" IS NOT NULL) AND CHAR_LENGTH(\"b\") >= 3)\nORDER BY \"c\" ASC NULLS LAST",
+		},
+		{`['logs'] | summarize count() by bin(_time, 1h)`, "unsupported: function bin"},
+		{`['logs'] | join (other) on id`, "unsupported: operator join"},
+	}
+	for _, tt := range tests {
+		got, err := convertAPLToSQL(tt.src)
+		if err != nil {
+			got = err.Error()
+		} else if _, err := sqlGrammar.ParseString("", got); err != nil {
+			t.Errorf("convertAPLToSQL(%q) is malformed: %v\n%s", tt.src, err, got)
+		}
+		if got != tt.want {
+			t.Errorf("convertAPLToSQL(%q) =\n%s\nwant\n%s", tt.src, got, tt.want)
+		}
+	}
+}
+
+// sqlGrammar parses the dialect documented at the top of apl_sql.go, one
+// node type per production.
+var sqlGrammar = participle.MustBuild[sqlQueryNode](
+	participle.Lexer(lexer.MustSimple([]lexer.SimpleRule{
+		{Name: "Ident", Pattern: `"(?:[^"]|"")*"`},
+		{Name: "String", Pattern: `'(?:[^']|'')*'`},
+		{Name: "Number", Pattern: `\d+(?:\.\d+)?(?:[eE][+-]?\d+)?`},
+		{Name: "Word", Pattern: `[A-Za-z_][A-Za-z0-9_]*`},
+		{Name: "Operator", Pattern: `<>|<=|>=|[-+*/%=<>(),]`},
+		{Name: "Whitespace", Pattern: `\s+`},
+	})),
+	participle.Elide("Whitespace"),
+	participle.UseLookahead(4),
+)
+
+type sqlQueryNode struct {
+	Columns []*sqlColumnNode `parser:"'SELECT' @@ (',' @@)*"`
+	From    *sqlSourceNode   `parser:"'FROM' @@"`
+	Where   *sqlOrNode       `parser:"('WHERE' @@)?"`
+	GroupBy []*sqlOrNode     `parser:"('GROUP' 'BY' @@ (',' @@)*)?"`
+	OrderBy []*sqlKeyNode    `parser:"('ORDER' 'BY' @@ (',' @@)*)?"`
+	Fetch   string           `parser:"('FETCH' 'FIRST' @Number 'ROWS' 'ONLY')?"`
+}
+
+type sqlColumnNode struct {
+	Star  bool       `parser:"@'*'"`
+	Expr  *sqlOrNode `parser:"| @@"`
+	Alias string     `parser:"('AS' @Ident)?"`
+}
+
+type sqlSourceNode struct {
+	Table    string        `parser:"@Ident"`
+	Subquery *sqlQueryNode `parser:"| '(' @@ ')'"`
+	Alias    string        `parser:"'AS' @Word"`
+}
+
+type sqlKeyNode struct {
+	Expr  *sqlOrNode `parser:"@@"`
+	Dir   string     `parser:"@('ASC' | 'DESC')"`
+	Nulls string     `parser:"'NULLS' @('FIRST' | 'LAST')"`
+}
+
+type sqlOrNode struct {
+	And []*sqlAndNode `parser:"@@ ('OR' @@)*"`
+}
+
+type sqlAndNode struct {
+	Not []*sqlNotNode `parser:"@@ ('AND' @@)*"`
+}
+
+type sqlNotNode struct {
+	Not     *sqlNotNode `parser:"'NOT' @@"`
+	Operand *sqlSumNode `parser:"| @@"`
+	RHS     *sqlRHSNode `parser:"@@?"`
+}
+
+type sqlRHSNode struct {
+	Op      string        `parser:"@('=' | '<>' | '<=' | '>=' | '<' | '>')"`
+	Right   *sqlSumNode   `parser:"@@"`
+	In      []*sqlOrNode  `parser:"| 'IN' '(' @@ (',' @@)* ')'"`
+	Between []*sqlSumNode `parser:"| 'BETWEEN' @@ 'AND' @@"`
+	Like    *sqlSumNode   `parser:"| 'LIKE' @@ 'ESCAPE' String"`
+	IsNull  string        `parser:"| 'IS' @'NOT'? 'NULL'"`
+}
+
+type sqlSumNode struct {
+	Terms []*sqlProductNode `parser:"@@ (('+' | '-') @@)*"`
+}
+
+type sqlProductNode struct {
+	Factors []*sqlUnaryNode `parser:"@@ (('*' | '/' | '%') @@)*"`
+}
+
+type sqlUnaryNode struct {
+	Minus   bool            `parser:"@'-'?"`
+	Primary *sqlPrimaryNode `parser:"@@"`
+}
+
+type sqlPrimaryNode struct {
+	Literal  string       `parser:"@(Number | String | Ident | 'TRUE' | 'FALSE' | 'NULL' | 'CURRENT_TIMESTAMP')"`
+	Interval string       `parser:"| 'INTERVAL' @String @('DAY' | 'HOUR' | 'MINUTE' | 'SECOND')"`
+	Case     []*sqlOrNode `parser:"| 'CASE' 'WHEN' @@ 'THEN' @@ 'END'"`
+	Call     *sqlCallNode `parser:"| @@"`
+	Group    *sqlOrNode   `parser:"| '(' @@ ')'"`
+}
+
+type sqlCallNode struct {
+	CountAll bool         `parser:"'COUNT' '(' @'*' ')'"`
+	Name     string       `parser:"| @('COUNT' | 'AVG' | 'MAX' | 'MIN' | 'SUM' | 'COALESCE' | 'ROUND' | 'CHAR_LENGTH' | 'LOWER' | 'UPPER') '('"`
+	Distinct bool         `parser:"@'DISTINCT'?"`
+	Args     []*sqlOrNode `parser:"@@ (',' @@)* ')'"`
+}
+
+func TestSQLGrammar(t *testing.T) {
+	for _, sql := range []string{
+		`SELECT * FROM "logs" WHERE`,
+		`SELECT * FROM "logs" FETCH FIRST 1 ROWS ONLY WHERE ("x" = 1)`,
+		`SELECT * FROM "logs" WHERE "a" = "b" = "c"`,
+		`SELECT * FROM "logs" WHERE "x" LIKE '%a%'`,
+		`SELECT * FROM "logs" ORDER BY "x"`,
+		`SELECT * FROM (SELECT * FROM "logs")`,
+		`SELECT LEN("x") FROM "logs"`,
+		`select * from "logs"`,
+	} {
+		if _, err := sqlGrammar.ParseString("", sql); err == nil {
+			t.Errorf("sqlGrammar accepts %q", sql)
+		}
+	}
+}
+
+func TestCanonicalNumber(t *testing.T) {
+	tests := []struct {
+		lit, want string
+	}{
+		{"1000", "1000"},
+		{"0x3E8", "1000"},
+		{"1e3", "1000.0"},
+		{"1000.0", "1000.0"},
+		{"1.5e-7", "1.5e-07"},
+		{"60s", "1m"},
+		{"0.5m", "30s"},
+		{"1440m", "1d"},
+		{"1500ms", "1500ms"},
+		{"2000microseconds", "2ms"},
+		{"7ticks", "7ticks"},
+	}
+	for _, tt := range tests {
+		if got, ok := canonicalNumber(tt.lit); !ok || got != tt.want {
+			t.Errorf("canonicalNumber(%q) = %q, %v, want %q", tt.lit, got, ok, tt.want)
+		}
+	}
+}
+
+func TestCanonicalAPL(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"['logs'] | where _time > ago(60s)", "['logs']\n| where _time > ago(1m)", true},
+		{"['logs'] | summarize count() by bin(_time, 0.5m)", "['logs'] | summarize count() by bin(_time, 30s)", true},
+		{"['logs'] | where status == 0x1F4", "['logs'] | where status == 500", true},
+		{"['logs'] | where dur > 1e3", "['logs'] | where dur > 1000.0", true},
+		{"['logs'] | where dur > 1e3", "['logs'] | where dur > 1000", false},
+		{"['logs'] | take 10", "['logs'] | take 100", false},
+	}
+	for _, tt := range tests {
+		a, err := canonicalAPL(tt.a)
+		if err != nil {
+			t.Fatalf("canonicalAPL(%q): %v", tt.a, err)
+		}
+		b, err := canonicalAPL(tt.b)
+		if err != nil {
+			t.Fatalf("canonicalAPL(%q): %v", tt.b, err)
+		}
+		if (a == b) != tt.same {
+			t.Errorf("canonicalAPL(%q) = %q, canonicalAPL(%q) = %q, want same %v", tt.a, a, tt.b, b, tt.same)
+		}
+	}
+}
+
+// TestQuoteAPL checks that a quoted string or identifier lexes back to
+// the value it was made from, and that it can stand in a query.
+func TestQuoteAPL(t *testing.T) {
+	values := []string{"", "status", "service.name", "with space", `say "hi"`, `C:\logs\`, `\"`, "tab\tand\r\nbreak", "é😀", "where"}
+	for _, v := range values {
+		lit := quoteAPLString(v)
+		toks, err := lexAPL(lit)
+		if err != nil || len(toks) != 1 || symbolOf(toks[0]) != symString {
+			t.Errorf("quoteAPLString(%q) = %s, which lexes to %v, %v", v, lit, toks, err)
+			continue
+		}
+		if got := unquote(toks[0].Value); got != v {
+			t.Errorf("quoteAPLString(%q) = %s, which reads back as %q", v, lit, got)
+		}
+		src := "['logs'] | where msg == " + lit
+		if r, _ := validate.APL(src); !r.Valid {
+			t.Errorf("%s is invalid: %+v", src, r)
+		}
+
+		ident := quoteAPLIdentifier(v)
+		if ident == v {
+			if v == "" || v == "where" || strings.ContainsAny(v, " .\"\\") {
+				t.Errorf("quoteAPLIdentifier(%q) left it bare", v)
+			}
+		} else if inner, ok := strings.CutPrefix(ident, "["); !ok || unquote(strings.TrimSuffix(inner, "]")) != v {
+			t.Errorf("quoteAPLIdentifier(%q) = %s", v, ident)
+		}
+		src = "['logs'] | project " + ident
+		if r, _ := validate.APL(src); v != "" && !r.Valid {
+			t.Errorf("%s is invalid: %+v", src, r)
+		}
+	}
+	if got := quoteAPLIdentifier("status"); got != "status" {
+		t.Errorf(`quoteAPLIdentifier("status") = %s`, got)
+	}
+}
+
+// TestValidateAPLLSP checks the error position ValidateAPLLSP gives
+// against the UTF-16 index JS has for it, on lines holding characters
+// outside the BMP, accented ones, a BOM and Windows line breaks.
+func TestValidateAPLLSP(t *testing.T) {
+	for _, src := range []string{
+		`['logs'] | where msg == "😀é" | | take 1`,
+		"\ufeff['logs'] | where msg == \"é\" | | take 1",
+		"['logs']\r\n| where msg == \"a😀\"\r\n| where x == \"é\" | | take 1",
+		"\ufeff['logs'] | where msg == \"😀\"\r\n| where x == \"é\" | | take 1",
+	} {
+		at := strings.Index(src, "| | take") + 2
+		lineStart := strings.LastIndexByte(src[:at], '\n') + 1
+		units := func(s string) int { return len(utf16.Encode([]rune(s))) }
+		result := call(jsValidateAPLLSP, src)
+		if result.Get("valid").Bool() {
+			t.Errorf("ValidateAPLLSP(%q) is valid", src)
+			continue
+		}
+		line, column, offset := result.Get("line").Int(), result.Get("column").Int(), result.Get("offset").Int()
+		if want := strings.Count(src[:at], "\n") + 1; line != want {
+			t.Errorf("ValidateAPLLSP(%q) line %d, want %d", src, line, want)
+		}
+		if want := units(src[lineStart:at]) + 1; column != want {
+			t.Errorf("ValidateAPLLSP(%q) column %d, want %d", src, column, want)
+		}
+		if want := units(src[:at]); offset != want {
+			t.Errorf("ValidateAPLLSP(%q) offset %d, want %d", src, offset, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+//go:build ignore
+
+package main
+
+import (
+	"strings"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+type aggregation struct {
+	Op      string
+	By      []string
+	Without []string
+}
+
+// extractAggregations returns each distinct aggregation in expr, outermost
+// first. Two uses only collapse when both the operator and the grouping
+// match.
+func extractAggregations(expr parser.Expr) []aggregation {
+	var aggs []aggregation
+	seen := map[string]bool{}
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		ae, ok := node.(*parser.AggregateExpr)
+		if !ok {
+			return nil
+		}
+		agg := aggregation{Op: ae.Op.String(), By: []string{}, Without: []string{}}
+		if ae.Without {
+			agg.Without = ae.Grouping
+		} else {
+			agg.By = ae.Grouping
+		}
+		key := agg.Op + "|" + strings.Join(agg.By, ",") + "|" + strings.Join(agg.Without, ",")
+		if !seen[key] {
+			seen[key] = true
+			aggs = append(aggs, agg)
+		}
+		return nil
+	})
+	return aggs
+}
+
+func jsAggregationsPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	aggs := js.Global().Get("Array").New()
+	for i, agg := range extractAggregations(expr) {
+		obj := js.Global().Get("Object").New()
+		obj.Set("op", agg.Op)
+		obj.Set("by", jsStrings(agg.By))
+		obj.Set("without", jsStrings(agg.Without))
+		aggs.SetIndex(i, obj)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("aggregations", aggs)
+	return result
+}
@@ -0,0 +1,104 @@
+//go:build ignore
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"syscall/js"
+	"unicode/utf8"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// bracketPos is where an opening bracket sits. Column counts runes.
+type bracketPos struct {
+	Char         string
+	Line, Column int
+}
+
+// unclosedErrors are the lexer's messages for input that ends with a
+// bracket open.
+var unclosedErrors = []string{
+	"unclosed left parenthesis",
+	"unclosed left bracket",
+	"unexpected end of input inside braces",
+}
+
+// unmatchedOpen finds the innermost bracket in src still open when the
+// input ends. The Prometheus lexer tracks bracket depth itself and stops
+// at the first closer without an opener, so only its unclosed-bracket
+// errors are localized; it returns nil for anything else.
+func unmatchedOpen(src string) *bracketPos {
+	var open []parser.Item
+	n := validate.Normalize(src)
+	lx := parser.Lex(n.Text)
+	for {
+		var item parser.Item
+		lx.NextItem(&item)
+		switch item.Typ {
+		case parser.EOF:
+			return nil
+		case parser.ERROR:
+			if len(open) == 0 || !slices.Contains(unclosedErrors, item.Val) {
+				return nil
+			}
+			top := open[len(open)-1]
+			// Normalizing keeps lines and columns, so they're counted in
+			// the text the lexer saw.
+			text, off := n.Text, int(top.Pos)
+			lineStart := strings.LastIndexByte(text[:off], '\n') + 1
+			return &bracketPos{
+				Char:   top.Val,
+				Line:   strings.Count(text[:off], "\n") + 1,
+				Column: utf8.RuneCountInString(text[lineStart:off]) + 1,
+			}
+		case parser.LEFT_PAREN, parser.LEFT_BRACE, parser.LEFT_BRACKET:
+			open = append(open, item)
+		case parser.RIGHT_PAREN, parser.RIGHT_BRACE, parser.RIGHT_BRACKET:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		}
+	}
+}
+
+func jsBracketPos(pos *bracketPos) js.Value {
+	obj := js.Global().Get("Object").New()
+	obj.Set("char", pos.Char)
+	obj.Set("line", pos.Line)
+	obj.Set("column", pos.Column)
+	return obj
+}
+
+// maxNestingDepth is the deepest src nests parentheses, braces and square
+// brackets, read from the lexer alone. Input the lexer rejects gives the
+// depth reached before the error.
+func maxNestingDepth(src string) int {
+	depth, deepest := 0, 0
+	lx := parser.Lex(validate.Normalize(src).Text)
+	for {
+		var item parser.Item
+		lx.NextItem(&item)
+		switch item.Typ {
+		case parser.EOF, parser.ERROR:
+			return deepest
+		case parser.LEFT_PAREN, parser.LEFT_BRACE, parser.LEFT_BRACKET:
+			depth++
+			deepest = max(deepest, depth)
+		case parser.RIGHT_PAREN, parser.RIGHT_BRACE, parser.RIGHT_BRACKET:
+			depth = max(depth-1, 0)
+		}
+	}
+}
+
+// jsMaxNestingDepthPromQL returns maxNestingDepth as a plain number, valid
+// query or not.
+func jsMaxNestingDepthPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+	return maxNestingDepth(args[0].String())
+}
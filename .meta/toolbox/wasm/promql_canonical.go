@@ -0,0 +1,229 @@
+//go:build ignore
+
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// canonicalPromQL is the text of expr after canonicalize, so two
+// expressions that only differ in spelling come out the same. The
+// Prometheus printer already fixes whitespace, quoting, modifier placement
+// (sum by (a) (x), not sum(x) by (a)) and literals: numbers print in
+// decimal, so 1e3, 0x3e8 and 1000 are all 1000, and ranges, steps and
+// offsets in their most compact units, so [60s] and [1m] are both [1m].
+func canonicalPromQL(expr parser.Expr) string {
+	return canonicalize(expr).String()
+}
+
+// canonicalize rewrites expr in place where the spelling has no effect on
+// the result:
+//   - label matchers, grouping labels and on/ignoring/group_x labels are
+//     sorted;
+//   - {__name__="x"} becomes x;
+//   - numbers lose their duration form, so 5m and 300 print the same;
+//   - unary plus goes;
+//   - the operands of a chain of + or * are sorted, when nothing modifies
+//     the matching: with on, ignoring or group_x the result takes its
+//     labels from one side, so b + on(job) a isn't a + on(job) b;
+//   - parentheses are dropped and put back only where precedence needs
+//     them, so (a * b) + c and a * b + c print the same.
+func canonicalize(expr parser.Expr) parser.Expr {
+	switch e := expr.(type) {
+	case *parser.ParenExpr:
+		return canonicalize(e.Expr)
+
+	case *parser.NumberLiteral:
+		e.Duration = false
+		return e
+
+	case *parser.UnaryExpr:
+		inner := canonicalize(e.Expr)
+		if e.Op == parser.ADD {
+			return inner
+		}
+		if precedence(inner) < precPow {
+			inner = parenthesize(inner)
+		}
+		e.Expr = inner
+		return e
+
+	case *parser.VectorSelector:
+		if e.Name == "" {
+			for _, m := range e.LabelMatchers {
+				if m.Name == labels.MetricName && m.Type == labels.MatchEqual && m.Value != "" {
+					e.Name = m.Value
+					break
+				}
+			}
+		}
+		slices.SortStableFunc(e.LabelMatchers, func(a, b *labels.Matcher) int {
+			return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Type, b.Type), cmp.Compare(a.Value, b.Value))
+		})
+		return e
+
+	case *parser.MatrixSelector:
+		e.VectorSelector = canonicalize(e.VectorSelector)
+		return e
+
+	case *parser.SubqueryExpr:
+		e.Expr = canonicalize(e.Expr)
+		if precedence(e.Expr) < precPrimary {
+			e.Expr = parenthesize(e.Expr)
+		}
+		return e
+
+	case *parser.Call:
+		for i, arg := range e.Args {
+			e.Args[i] = canonicalize(arg)
+		}
+		return e
+
+	case *parser.AggregateExpr:
+		slices.Sort(e.Grouping)
+		if e.Param != nil {
+			e.Param = canonicalize(e.Param)
+		}
+		e.Expr = canonicalize(e.Expr)
+		return e
+
+	case *parser.BinaryExpr:
+		if vm := e.VectorMatching; vm != nil {
+			slices.Sort(vm.MatchingLabels)
+			slices.Sort(vm.Include)
+		}
+		if symmetric(e) {
+			return sortOperands(e)
+		}
+		e.LHS = canonicalize(e.LHS)
+		e.RHS = canonicalize(e.RHS)
+		return placeParens(e)
+	}
+	return expr
+}
+
+// symmetric reports whether the operands of e can be swapped without
+// changing either its value or its labels.
+func symmetric(e *parser.BinaryExpr) bool {
+	if !commutative(e) {
+		return false
+	}
+	vm := e.VectorMatching
+	return vm == nil || (len(vm.MatchingLabels) == 0 && !vm.On && len(vm.Include) == 0)
+}
+
+// sortOperands canonicalizes the operands of the chain of e's operation
+// that e heads, sorts them by their text and rebuilds the chain
+// left-associatively, so c + (b + a) becomes a + b + c.
+func sortOperands(e *parser.BinaryExpr) parser.Expr {
+	head := binaryHead(e)
+	var operands []parser.Expr
+	var collect func(parser.Expr)
+	collect = func(expr parser.Expr) {
+		expr = unparen(expr)
+		if b, ok := expr.(*parser.BinaryExpr); ok && symmetric(b) && binaryHead(b) == head {
+			collect(b.LHS)
+			collect(b.RHS)
+			return
+		}
+		operands = append(operands, canonicalize(expr))
+	}
+	collect(e)
+	slices.SortStableFunc(operands, func(a, b parser.Expr) int {
+		return cmp.Compare(a.String(), b.String())
+	})
+	chain := operands[0]
+	for i, operand := range operands[1:] {
+		link := e
+		if i < len(operands)-2 {
+			link = &parser.BinaryExpr{Op: e.Op, VectorMatching: e.VectorMatching, ReturnBool: e.ReturnBool}
+		}
+		link.LHS, link.RHS = chain, operand
+		chain = placeParens(link)
+	}
+	return chain
+}
+
+// placeParens parenthesizes the canonical operands of e where precedence
+// needs it. Everything is left-associative except ^. A unary operand on
+// the right never needs parentheses, since nothing can bind it tighter.
+func placeParens(e *parser.BinaryExpr) parser.Expr {
+	p, lp, rp := precedence(e), precedence(e.LHS), precedence(e.RHS)
+	if lp < p || (lp == p && e.Op == parser.POW) {
+		e.LHS = parenthesize(e.LHS)
+	}
+	if (rp < p && rp != precUnary) || (rp == p && e.Op != parser.POW) {
+		e.RHS = parenthesize(e.RHS)
+	}
+	return e
+}
+
+// Binding strength of each kind of expression, loosest first, following
+// the %left/%right declarations of the Prometheus grammar. Unary minus
+// binds like * in the grammar but is applied to what follows it only after
+// ^, so it sits between the two.
+const (
+	precOr = iota
+	precAnd
+	precComparison
+	precAdd
+	precMul
+	precUnary
+	precPow
+	precPrimary
+)
+
+func precedence(expr parser.Expr) int {
+	switch e := expr.(type) {
+	case *parser.BinaryExpr:
+		switch {
+		case e.Op == parser.LOR:
+			return precOr
+		case e.Op == parser.LAND || e.Op == parser.LUNLESS:
+			return precAnd
+		case e.Op.IsComparisonOperator():
+			return precComparison
+		case e.Op == parser.ADD || e.Op == parser.SUB:
+			return precAdd
+		case e.Op == parser.POW:
+			return precPow
+		}
+		return precMul
+	case *parser.UnaryExpr:
+		return precUnary
+	case *parser.NumberLiteral:
+		// The parser folds -2 into the literal, which still prints as a
+		// unary minus.
+		if math.Signbit(e.Val) {
+			return precUnary
+		}
+	}
+	return precPrimary
+}
+
+func parenthesize(expr parser.Expr) parser.Expr {
+	return &parser.ParenExpr{Expr: expr, PosRange: expr.PositionRange()}
+}
+
+func jsCanonicalizePromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	result := validResult()
+	result.Set("canonical", canonicalPromQL(expr))
+	return result
+}
@@ -0,0 +1,132 @@
+//go:build ignore
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// maxGroupingLabels is how many by() labels an aggregation can have before
+// it's likely to keep most of its input series apart.
+const maxGroupingLabels = 4
+
+// highCardinalityLabels are labels that usually take a value per process,
+// request or user. Grouping by them rarely reduces anything.
+var highCardinalityLabels = map[string]bool{
+	"container":  true,
+	"id":         true,
+	"instance":   true,
+	"ip":         true,
+	"path":       true,
+	"pod":        true,
+	"request_id": true,
+	"session_id": true,
+	"trace_id":   true,
+	"uid":        true,
+	"url":        true,
+	"user_id":    true,
+}
+
+const (
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+type cardinalityWarning struct {
+	Message  string
+	Severity string
+	Span     errorSpan
+}
+
+// cardinalityWarnings flags the parts of expr that tend to touch or return
+// many series. It's a heuristic over the query text alone: nothing here
+// knows the actual series counts.
+func cardinalityWarnings(src string, expr parser.Expr) []cardinalityWarning {
+	var warnings []cardinalityWarning
+	add := func(node parser.Node, severity, format string, args ...any) {
+		pr := node.PositionRange()
+		warnings = append(warnings, cardinalityWarning{
+			Message:  fmt.Sprintf(format, args...),
+			Severity: severity,
+			Span:     errorSpan{Start: runeOffset(src, int(pr.Start)), End: runeOffset(src, int(pr.End))},
+		})
+	}
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.AggregateExpr:
+			if n.Without {
+				return nil
+			}
+			if len(n.Grouping) > maxGroupingLabels {
+				add(n, severityWarning, "%s groups by %d labels, which may keep most series apart", n.Op, len(n.Grouping))
+			}
+			var risky []string
+			for _, name := range n.Grouping {
+				if highCardinalityLabels[name] {
+					risky = append(risky, name)
+				}
+			}
+			switch len(risky) {
+			case 0:
+			case 1:
+				add(n, severityWarning, "%s groups by high-cardinality label %s", n.Op, risky[0])
+			default:
+				add(n, severityWarning, "%s groups by high-cardinality labels %s", n.Op, strings.Join(risky, ", "))
+			}
+
+		case *parser.VectorSelector:
+			constrained := false
+			for _, m := range n.LabelMatchers {
+				if m.Name == labels.MetricName {
+					continue
+				}
+				constrained = true
+				if (m.Type == labels.MatchRegexp || m.Type == labels.MatchNotRegexp) &&
+					(strings.HasPrefix(m.Value, ".*") || strings.HasPrefix(m.Value, ".+")) {
+					add(n, severityWarning, "regex matcher on %s starts with a wildcard and has to scan every value", m.Name)
+				}
+			}
+			if !constrained {
+				add(n, severityInfo, "selector %s has no label matchers and selects every series of the metric", n.Name)
+			}
+		}
+		return nil
+	})
+	return warnings
+}
+
+// jsCardinalityWarningsPromQL annotates a valid query with cardinality
+// warnings. The warnings never make a query invalid; an invalid query gets
+// the same result as from ValidatePromQL.
+func jsCardinalityWarningsPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	warnings := js.Global().Get("Array").New()
+	for i, w := range cardinalityWarnings(src, expr) {
+		pos := js.Global().Get("Object").New()
+		pos.Set("start", w.Span.Start)
+		pos.Set("end", w.Span.End)
+		obj := js.Global().Get("Object").New()
+		obj.Set("message", w.Message)
+		obj.Set("position", pos)
+		obj.Set("severity", w.Severity)
+		warnings.SetIndex(i, obj)
+	}
+	result := validResult()
+	result.Set("warnings", warnings)
+	return result
+}
@@ -0,0 +1,330 @@
+//go:build ignore
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// unsupportedError names a PromQL construct with no APL translation.
+type unsupportedError struct {
+	what string
+}
+
+func (e unsupportedError) Error() string {
+	return "unsupported: " + e.what
+}
+
+// nodeName is the parser type name of node, e.g. "SubqueryExpr".
+func nodeName(node parser.Node) string {
+	name := fmt.Sprintf("%T", node)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// aplPipeline is an APL query under construction. Every stage keeps the
+// sample in a column called value so the next stage can build on it.
+type aplPipeline struct {
+	stages []string
+
+	// A range function whose summarize is deferred until the grouping keys
+	// are known, so sum by (job) (rate(x[5m])) can sum the per-series rates
+	// by job.
+	rangeFn  string
+	rangeDur time.Duration
+
+	// series are the labels that tell one series of the metric from
+	// another. A range function runs per series, so they're grouping keys
+	// of its summarize.
+	series []string
+
+	// binned is set once a summarize has grouped rows into _time buckets.
+	binned bool
+}
+
+func (p *aplPipeline) flush(by []string) {
+	if p.rangeFn == "" {
+		return
+	}
+	keys := append([]string{"bin(_time, " + aplTimespan(p.rangeDur) + ")"}, by...)
+	for _, label := range p.series {
+		if key := aplIdent(label); !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	p.stages = append(p.stages, "summarize value = "+p.rangeFn+" by "+strings.Join(keys, ", "))
+	p.rangeFn = ""
+	p.binned = true
+}
+
+func (p *aplPipeline) String() string {
+	return strings.Join(p.stages, "\n| ")
+}
+
+// rangeFunctions maps PromQL range functions to the APL aggregation over the
+// window.
+var rangeFunctions = map[string]string{
+	"rate":     "rate(value)",
+	"increase": "max(value) - min(value)",
+}
+
+var aggregations = map[parser.ItemType]string{
+	parser.SUM: "sum",
+	parser.AVG: "avg",
+	parser.MAX: "max",
+	parser.MIN: "min",
+}
+
+var arithmetic = map[parser.ItemType]string{
+	parser.ADD: "+",
+	parser.SUB: "-",
+	parser.MUL: "*",
+	parser.DIV: "/",
+	parser.MOD: "%",
+}
+
+// convertPromQL translates expr into APL for the subset both languages
+// share: selectors, rate/increase, sum/avg/max/min by, and arithmetic with
+// a scalar. Each metric is read from the dataset of the same name.
+//
+// series are the labels identifying a series of the metric. An APL
+// dataset has no notion of series, so rate and increase convert only when
+// they're given.
+func convertPromQL(expr parser.Expr, series []string) (string, error) {
+	if lit, ok := expr.(*parser.NumberLiteral); ok {
+		return "print value = " + aplNumber(lit.Val), nil
+	}
+	p, err := convertExpr(expr, series)
+	if err != nil {
+		return "", err
+	}
+	p.flush(nil)
+	return p.String(), nil
+}
+
+func convertExpr(expr parser.Expr, series []string) (*aplPipeline, error) {
+	switch e := expr.(type) {
+	case *parser.ParenExpr:
+		return convertExpr(e.Expr, series)
+
+	case *parser.VectorSelector:
+		return convertSelector(e)
+
+	case *parser.Call:
+		fn, ok := rangeFunctions[e.Func.Name]
+		if !ok {
+			return nil, unsupportedError{"function " + e.Func.Name}
+		}
+		ms, ok := e.Args[0].(*parser.MatrixSelector)
+		if !ok {
+			return nil, unsupportedError{e.Func.Name + " over " + nodeName(e.Args[0])}
+		}
+		if len(series) == 0 {
+			return nil, unsupportedError{e.Func.Name + " without the series labels"}
+		}
+		p, err := convertSelector(ms.VectorSelector.(*parser.VectorSelector))
+		if err != nil {
+			return nil, err
+		}
+		p.rangeFn, p.rangeDur, p.series = fn, ms.Range, series
+		return p, nil
+
+	case *parser.AggregateExpr:
+		op, ok := aggregations[e.Op]
+		if !ok {
+			return nil, unsupportedError{"aggregation " + e.Op.String()}
+		}
+		if e.Without {
+			return nil, unsupportedError{"aggregation without(), summarize needs explicit group keys"}
+		}
+		p, err := convertExpr(e.Expr, series)
+		if err != nil {
+			return nil, err
+		}
+		by := make([]string, len(e.Grouping))
+		for i, label := range e.Grouping {
+			by[i] = aplIdent(label)
+		}
+		p.flush(by)
+		timeKey := "bin_auto(_time)"
+		if p.binned {
+			timeKey = "_time"
+		}
+		p.binned = true
+		keys := append([]string{timeKey}, by...)
+		p.stages = append(p.stages, "summarize value = "+op+"(value) by "+strings.Join(keys, ", "))
+		return p, nil
+
+	case *parser.BinaryExpr:
+		op, ok := arithmetic[e.Op]
+		if !ok && e.Op != parser.POW {
+			return nil, unsupportedError{"binary operator " + e.Op.String()}
+		}
+		lhs, lhsScalar := e.LHS.(*parser.NumberLiteral)
+		rhs, rhsScalar := e.RHS.(*parser.NumberLiteral)
+		switch {
+		case lhsScalar && rhsScalar:
+			return &aplPipeline{stages: []string{"print value = " + aplArithmetic(aplNumber(lhs.Val), e.Op, op, aplNumber(rhs.Val))}}, nil
+		case rhsScalar:
+			p, err := convertExpr(e.LHS, series)
+			if err != nil {
+				return nil, err
+			}
+			p.flush(nil)
+			p.stages = append(p.stages, "extend value = "+aplArithmetic("value", e.Op, op, aplNumber(rhs.Val)))
+			return p, nil
+		case lhsScalar:
+			p, err := convertExpr(e.RHS, series)
+			if err != nil {
+				return nil, err
+			}
+			p.flush(nil)
+			p.stages = append(p.stages, "extend value = "+aplArithmetic(aplNumber(lhs.Val), e.Op, op, "value"))
+			return p, nil
+		}
+		return nil, unsupportedError{"binary operation between two vectors"}
+	}
+	return nil, unsupportedError{nodeName(expr)}
+}
+
+func convertSelector(vs *parser.VectorSelector) (*aplPipeline, error) {
+	switch {
+	case vs.OriginalOffset != 0:
+		return nil, unsupportedError{"offset modifier"}
+	case vs.Timestamp != nil || vs.StartOrEnd != 0:
+		return nil, unsupportedError{"@ modifier"}
+	case vs.Name == "":
+		return nil, unsupportedError{"selector without a metric name"}
+	}
+
+	p := &aplPipeline{stages: []string{"['" + vs.Name + "']"}}
+	var preds []string
+	for _, m := range vs.LabelMatchers {
+		if m.Name == labels.MetricName {
+			continue
+		}
+		preds = append(preds, aplMatcher(m))
+	}
+	if len(preds) > 0 {
+		p.stages = append(p.stages, "where "+strings.Join(preds, " and "))
+	}
+	return p, nil
+}
+
+func aplMatcher(m *labels.Matcher) string {
+	field := aplIdent(m.Name)
+	value := aplString(m.Value)
+	// PromQL regexes are fully anchored, APL's aren't.
+	re := aplString("^(?:" + m.Value + ")$")
+	switch m.Type {
+	case labels.MatchNotEqual:
+		return field + " != " + value
+	case labels.MatchRegexp:
+		return field + " matches regex " + re
+	case labels.MatchNotRegexp:
+		return "not(" + field + " matches regex " + re + ")"
+	default:
+		return field + " == " + value
+	}
+}
+
+func aplArithmetic(lhs string, typ parser.ItemType, op, rhs string) string {
+	if typ == parser.POW {
+		return "pow(" + lhs + ", " + rhs + ")"
+	}
+	return lhs + " " + op + " " + rhs
+}
+
+var plainIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// aplIdent quotes a label name that isn't a plain APL identifier.
+func aplIdent(name string) string {
+	if plainIdent.MatchString(name) {
+		return name
+	}
+	return "[" + aplString(name) + "]"
+}
+
+// aplStringEscaper escapes the characters an APL string literal can't hold
+// as they are. strconv.Quote won't do: APL reads none of Go's \x, \u or
+// \a escapes.
+var aplStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// aplString writes v as a double-quoted APL string literal.
+func aplString(v string) string {
+	return `"` + aplStringEscaper.Replace(v) + `"`
+}
+
+func aplNumber(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// aplTimespan renders d in the largest APL timespan unit that divides it.
+// APL has no compound literals like 1h30m.
+func aplTimespan(d time.Duration) string {
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+		{"ms", time.Millisecond},
+	}
+	for _, u := range units {
+		if d%u.size == 0 {
+			return strconv.FormatInt(int64(d/u.size), 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+}
+
+// jsConvertPromQLToAPL(source, seriesLabels?) translates source into APL.
+// seriesLabels are the labels identifying a series of the metric, such as
+// ["instance", "job"]; without them rate and increase don't convert.
+func jsConvertPromQLToAPL(this js.Value, args []js.Value) any {
+	if len(args) < 1 || len(args) > 2 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected source and an optional array of series labels")
+	}
+	var series []string
+	if len(args) == 2 && !args[1].IsUndefined() && !args[1].IsNull() {
+		list := args[1]
+		if !js.Global().Get("Array").Call("isArray", list).Bool() {
+			return invalidArgs("expected source and an optional array of series labels")
+		}
+		for i := 0; i < list.Length(); i++ {
+			if list.Index(i).Type() != js.TypeString {
+				return invalidArgs("series labels must be strings")
+			}
+			series = append(series, list.Index(i).String())
+		}
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	apl, err := convertPromQL(expr, series)
+	if err != nil {
+		result.Set("ok", false)
+		result.Set("reason", err.Error())
+		return result
+	}
+	result.Set("ok", true)
+	result.Set("apl", apl)
+	return result
+}
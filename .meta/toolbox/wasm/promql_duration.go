@@ -0,0 +1,62 @@
+//go:build ignore
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"toolbox/validate"
+)
+
+var (
+	errNegativeDuration = errors.New("duration must not be negative")
+	errZeroDuration     = errors.New("duration must be greater than zero")
+)
+
+// parseStepDuration parses a duration the way PromQL does in ranges and
+// steps, e.g. 30s or 1h30m. Surrounding whitespace is ignored. The grammar
+// has no sign, so a leading - is only recognized to give a better message.
+func parseStepDuration(src string) (time.Duration, error) {
+	src = strings.TrimSpace(src)
+	if rest, ok := strings.CutPrefix(src, "-"); ok {
+		if _, err := model.ParseDuration(rest); err == nil {
+			return 0, errNegativeDuration
+		}
+	}
+	d, err := model.ParseDuration(src)
+	if err != nil {
+		return 0, err
+	}
+	if d == 0 {
+		return 0, errZeroDuration
+	}
+	return time.Duration(d), nil
+}
+
+// jsValidateDuration returns {valid, error, code, millis}, with millis null
+// unless the duration is valid.
+func jsValidateDuration(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	result := js.Global().Get("Object").New()
+	d, err := parseStepDuration(args[0].String())
+	if err != nil {
+		result.Set("valid", false)
+		result.Set("error", err.Error())
+		result.Set("code", validate.CodeInvalidNumber)
+		result.Set("millis", js.Null())
+		return result
+	}
+	result.Set("valid", true)
+	result.Set("error", js.Null())
+	result.Set("code", js.Null())
+	result.Set("millis", d.Milliseconds())
+	return result
+}
@@ -0,0 +1,54 @@
+//go:build ignore
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// enforceLabel makes every selector in expr match name=value exactly,
+// dropping whatever matchers the query had for name. Dropping rather than
+// keeping them is the point: a user's own tenant="other" must not survive.
+func enforceLabel(expr parser.Expr, name, value string) {
+	enforced := labels.MustNewMatcher(labels.MatchEqual, name, value)
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		matchers := make([]*labels.Matcher, 0, len(vs.LabelMatchers)+1)
+		for _, m := range vs.LabelMatchers {
+			if m.Name != name {
+				matchers = append(matchers, m)
+			}
+		}
+		vs.LabelMatchers = append(matchers, enforced)
+		return nil
+	})
+}
+
+func jsEnforceLabelPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 3 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeString || args[2].Type() != js.TypeString {
+		return invalidArgs("expected source, label name and value")
+	}
+	name, value := args[1].String(), args[2].String()
+	if !model.LabelName(name).IsValid() || name == labels.MetricName {
+		return invalidArgs("invalid label name " + name)
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	enforceLabel(expr, name, value)
+	result := validResult()
+	result.Set("query", expr.String())
+	return result
+}
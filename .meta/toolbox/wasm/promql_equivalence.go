@@ -0,0 +1,150 @@
+//go:build ignore
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// structuralKey serializes expr as an S-expression in which operand order
+// of commutative operators and matcher order inside selectors no longer
+// matter. Parentheses disappear but grouping is kept by the nesting, so
+// (a + b) * c and a + b * c still differ.
+func structuralKey(expr parser.Expr) string {
+	switch e := expr.(type) {
+	case *parser.ParenExpr:
+		return structuralKey(e.Expr)
+
+	case *parser.NumberLiteral:
+		return strconv.FormatFloat(e.Val, 'g', -1, 64)
+
+	case *parser.StringLiteral:
+		return strconv.Quote(e.Val)
+
+	case *parser.UnaryExpr:
+		return "(" + e.Op.String() + " " + structuralKey(e.Expr) + ")"
+
+	case *parser.VectorSelector:
+		matchers := make([]string, 0, len(e.LabelMatchers))
+		for _, m := range e.LabelMatchers {
+			matchers = append(matchers, m.String())
+		}
+		slices.Sort(matchers)
+		return "{" + strings.Join(matchers, ",") + "}" + modifierKey(e.OriginalOffset.String(), e.Timestamp, e.StartOrEnd)
+
+	case *parser.MatrixSelector:
+		return structuralKey(e.VectorSelector) + "[" + e.Range.String() + "]"
+
+	case *parser.SubqueryExpr:
+		return "(subquery " + structuralKey(e.Expr) + " " + e.Range.String() + ":" + e.Step.String() + ")" +
+			modifierKey(e.OriginalOffset.String(), e.Timestamp, e.StartOrEnd)
+
+	case *parser.Call:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = structuralKey(arg)
+		}
+		return "(" + e.Func.Name + " " + strings.Join(args, " ") + ")"
+
+	case *parser.AggregateExpr:
+		grouping := slices.Clone(e.Grouping)
+		slices.Sort(grouping)
+		mode := "by"
+		if e.Without {
+			mode = "without"
+		}
+		key := "(" + e.Op.String() + " " + mode + "(" + strings.Join(grouping, ",") + ")"
+		if e.Param != nil {
+			key += " " + structuralKey(e.Param)
+		}
+		return key + " " + structuralKey(e.Expr) + ")"
+
+	case *parser.BinaryExpr:
+		head := binaryHead(e)
+		if !commutative(e) {
+			return "(" + head + " " + structuralKey(e.LHS) + " " + structuralKey(e.RHS) + ")"
+		}
+		operands := flattenCommutative(e.LHS, head, nil)
+		operands = flattenCommutative(e.RHS, head, operands)
+		slices.Sort(operands)
+		return "(" + head + " " + strings.Join(operands, " ") + ")"
+	}
+	return expr.String()
+}
+
+// binaryHead is the operator of e together with everything that modifies
+// it, so only operations that behave identically share a head.
+func binaryHead(e *parser.BinaryExpr) string {
+	head := e.Op.String()
+	if e.ReturnBool {
+		head += " bool"
+	}
+	if vm := e.VectorMatching; vm != nil {
+		labels := slices.Clone(vm.MatchingLabels)
+		slices.Sort(labels)
+		include := slices.Clone(vm.Include)
+		slices.Sort(include)
+		head += fmt.Sprintf(" %v %v(%s) include(%s)", vm.Card, vm.On, strings.Join(labels, ","), strings.Join(include, ","))
+	}
+	return head
+}
+
+// commutative reports whether swapping the operands of e can't change its
+// value. Only + and * qualify, and only when no group_left/group_right
+// makes the sides asymmetric.
+func commutative(e *parser.BinaryExpr) bool {
+	if e.Op != parser.ADD && e.Op != parser.MUL {
+		return false
+	}
+	vm := e.VectorMatching
+	return vm == nil || vm.Card == parser.CardOneToOne || vm.Card == parser.CardManyToMany
+}
+
+// flattenCommutative collects the operands of a chain of the same
+// commutative operation, so a + b + c and c + (b + a) get the same key.
+func flattenCommutative(expr parser.Expr, head string, out []string) []string {
+	expr = unparen(expr)
+	if b, ok := expr.(*parser.BinaryExpr); ok && commutative(b) && binaryHead(b) == head {
+		out = flattenCommutative(b.LHS, head, out)
+		return flattenCommutative(b.RHS, head, out)
+	}
+	return append(out, structuralKey(expr))
+}
+
+func modifierKey(offset string, ts *int64, startOrEnd parser.ItemType) string {
+	key := " offset " + offset
+	switch {
+	case ts != nil:
+		key += " @" + strconv.FormatInt(*ts, 10)
+	case startOrEnd != 0:
+		key += " @" + startOrEnd.String()
+	}
+	return key
+}
+
+func jsEquivalentPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeString {
+		return invalidArgs("expected 2 string arguments")
+	}
+
+	a, b := args[0].String(), args[1].String()
+	exprA, err := validate.ParsePromQL(a)
+	if err != nil {
+		return invalidQuery(a, err)
+	}
+	exprB, err := validate.ParsePromQL(b)
+	if err != nil {
+		return invalidQuery(b, err)
+	}
+	result := validResult()
+	result.Set("equivalent", structuralKey(exprA) == structuralKey(exprB))
+	return result
+}
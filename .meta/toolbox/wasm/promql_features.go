@@ -0,0 +1,92 @@
+//go:build ignore
+
+package main
+
+import (
+	"errors"
+	"syscall/js"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// promFeatures are language features older Prometheus servers lack. The
+// parser always accepts them, so they're rejected after parsing.
+type promFeatures struct {
+	AtModifier     bool
+	NegativeOffset bool
+}
+
+var allPromFeatures = promFeatures{AtModifier: true, NegativeOffset: true}
+
+// featuresFromJS reads a features object; absent or non-boolean flags keep
+// the feature enabled.
+func featuresFromJS(v js.Value) promFeatures {
+	f := allPromFeatures
+	if v.Type() != js.TypeObject {
+		return f
+	}
+	flag := func(name string, def bool) bool {
+		if fv := v.Get(name); fv.Type() == js.TypeBoolean {
+			return fv.Bool()
+		}
+		return def
+	}
+	f.AtModifier = flag("atModifier", f.AtModifier)
+	f.NegativeOffset = flag("negativeOffset", f.NegativeOffset)
+	return f
+}
+
+// checkFeatures returns a ParseErr for the first use of a disabled feature.
+func checkFeatures(src string, expr parser.Expr, f promFeatures) error {
+	var failure error
+	fail := func(node parser.Node, msg string) {
+		if failure == nil {
+			failure = parser.ParseErrors{{
+				PositionRange: node.PositionRange(),
+				Err:           errors.New(msg),
+				Query:         src,
+			}}
+		}
+	}
+	check := func(node parser.Node, offset time.Duration, ts *int64, startOrEnd parser.ItemType) {
+		if !f.AtModifier && (ts != nil || startOrEnd != 0) {
+			fail(node, "@ modifier is not supported by the target server")
+		}
+		if !f.NegativeOffset && offset < 0 {
+			fail(node, "negative offset is not supported by the target server")
+		}
+	}
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			check(n, n.OriginalOffset, n.Timestamp, n.StartOrEnd)
+		case *parser.SubqueryExpr:
+			check(n, n.OriginalOffset, n.Timestamp, n.StartOrEnd)
+		}
+		return nil
+	})
+	return failure
+}
+
+func jsValidatePromQLWithFeatures(this js.Value, args []js.Value) any {
+	if len(args) < 1 || len(args) > 2 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected a string and an optional features object")
+	}
+
+	features := allPromFeatures
+	if len(args) == 2 {
+		features = featuresFromJS(args[1])
+	}
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	if err := checkFeatures(src, expr, features); err != nil {
+		return invalidQuery(src, err)
+	}
+	return validResult()
+}
@@ -0,0 +1,96 @@
+//go:build ignore
+
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// selectorFilter translates the one selector expr reads into an APL where
+// stage, returning it with the metric name, which names the dataset rather
+// than filtering it. A selector repeated with other modifiers, as in
+// x - x offset 1h, counts once, since the filter has no notion of time.
+func selectorFilter(expr parser.Expr) (filter, metric string, err error) {
+	var vs *parser.VectorSelector
+	var seen string
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		v, ok := node.(*parser.VectorSelector)
+		if !ok || err != nil {
+			return nil
+		}
+		key := matcherKey(v.LabelMatchers)
+		switch {
+		case vs == nil:
+			vs, seen = v, key
+		case key != seen:
+			err = errors.New("multiple selectors")
+		}
+		return nil
+	})
+	switch {
+	case err != nil:
+		return "", "", err
+	case vs == nil:
+		return "", "", errors.New("no selector")
+	}
+
+	var preds []string
+	for _, m := range vs.LabelMatchers {
+		if m.Name == labels.MetricName && m.Type == labels.MatchEqual && m.Value == vs.Name {
+			continue
+		}
+		preds = append(preds, aplMatcher(m))
+	}
+	if len(preds) == 0 {
+		return "", "", errors.New("no label matchers")
+	}
+	return "where " + strings.Join(preds, " and "), vs.Name, nil
+}
+
+// matcherKey identifies a selector by its matchers in any order.
+func matcherKey(ms []*labels.Matcher) string {
+	keys := make([]string, len(ms))
+	for i, m := range ms {
+		keys[i] = m.String()
+	}
+	slices.Sort(keys)
+	return strings.Join(keys, ",")
+}
+
+// jsPromQLSelectorToAPLFilter returns {valid, ok} and, as ConvertPromQLToAPL
+// does, either apl, here a where stage to put after the dataset, with
+// metric, the metric name or null, or reason, e.g. "multiple selectors".
+func jsPromQLSelectorToAPLFilter(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	filter, metric, err := selectorFilter(expr)
+	if err != nil {
+		result.Set("ok", false)
+		result.Set("reason", err.Error())
+		return result
+	}
+	result.Set("ok", true)
+	result.Set("apl", filter)
+	result.Set("metric", js.Null())
+	if metric != "" {
+		result.Set("metric", metric)
+	}
+	return result
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// promASTJSON and its helpers are translateAST from web/api/v1/translate_ast.go
+// in github.com/prometheus/prometheus v0.304.1. Changed from the original:
+// the functions are renamed, interface{} is any, and a nil or unknown node
+// translates to null instead of panicking. jsParsePromQLToJSON is new.
+
+//go:build ignore
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// promASTJSON translates node into the tree /api/v1/parse_query returns,
+// node for node: each node is an object with its type and fields as
+// Prometheus names them, durations in milliseconds. The API's own
+// translation is unexported, and its package is the whole web server, so
+// it's copied here.
+func promASTJSON(node parser.Expr) any {
+	switch n := node.(type) {
+	case *parser.AggregateExpr:
+		return map[string]any{
+			"type":     "aggregation",
+			"op":       n.Op.String(),
+			"expr":     promASTJSON(n.Expr),
+			"param":    promASTJSON(n.Param),
+			"grouping": nonNil(n.Grouping),
+			"without":  n.Without,
+		}
+	case *parser.BinaryExpr:
+		var matching any
+		if m := n.VectorMatching; m != nil {
+			matching = map[string]any{
+				"card":    m.Card.String(),
+				"labels":  nonNil(m.MatchingLabels),
+				"on":      m.On,
+				"include": nonNil(m.Include),
+			}
+		}
+		return map[string]any{
+			"type":     "binaryExpr",
+			"op":       n.Op.String(),
+			"lhs":      promASTJSON(n.LHS),
+			"rhs":      promASTJSON(n.RHS),
+			"matching": matching,
+			"bool":     n.ReturnBool,
+		}
+	case *parser.Call:
+		args := []any{}
+		for _, arg := range n.Args {
+			args = append(args, promASTJSON(arg))
+		}
+		return map[string]any{
+			"type": "call",
+			"func": map[string]any{
+				"name":       n.Func.Name,
+				"argTypes":   n.Func.ArgTypes,
+				"variadic":   n.Func.Variadic,
+				"returnType": n.Func.ReturnType,
+			},
+			"args": args,
+		}
+	case *parser.MatrixSelector:
+		vs := n.VectorSelector.(*parser.VectorSelector)
+		return map[string]any{
+			"type":       "matrixSelector",
+			"name":       vs.Name,
+			"range":      n.Range.Milliseconds(),
+			"offset":     vs.OriginalOffset.Milliseconds(),
+			"matchers":   promMatchersJSON(vs.LabelMatchers),
+			"timestamp":  vs.Timestamp,
+			"startOrEnd": startOrEndJSON(vs.StartOrEnd),
+		}
+	case *parser.SubqueryExpr:
+		return map[string]any{
+			"type":       "subquery",
+			"expr":       promASTJSON(n.Expr),
+			"range":      n.Range.Milliseconds(),
+			"offset":     n.OriginalOffset.Milliseconds(),
+			"step":       n.Step.Milliseconds(),
+			"timestamp":  n.Timestamp,
+			"startOrEnd": startOrEndJSON(n.StartOrEnd),
+		}
+	case *parser.NumberLiteral:
+		return map[string]any{
+			"type": "numberLiteral",
+			"val":  strconv.FormatFloat(n.Val, 'f', -1, 64),
+		}
+	case *parser.ParenExpr:
+		return map[string]any{
+			"type": "parenExpr",
+			"expr": promASTJSON(n.Expr),
+		}
+	case *parser.StringLiteral:
+		return map[string]any{
+			"type": "stringLiteral",
+			"val":  n.Val,
+		}
+	case *parser.UnaryExpr:
+		return map[string]any{
+			"type": "unaryExpr",
+			"op":   n.Op.String(),
+			"expr": promASTJSON(n.Expr),
+		}
+	case *parser.VectorSelector:
+		return map[string]any{
+			"type":       "vectorSelector",
+			"name":       n.Name,
+			"offset":     n.OriginalOffset.Milliseconds(),
+			"matchers":   promMatchersJSON(n.LabelMatchers),
+			"timestamp":  n.Timestamp,
+			"startOrEnd": startOrEndJSON(n.StartOrEnd),
+		}
+	}
+	// nil, as for an aggregation without a param.
+	return nil
+}
+
+// nonNil keeps empty label lists [] rather than null, as the API does.
+func nonNil(l []string) []string {
+	if l == nil {
+		return []string{}
+	}
+	return l
+}
+
+func promMatchersJSON(matchers []*labels.Matcher) []map[string]any {
+	out := []map[string]any{}
+	for _, m := range matchers {
+		out = append(out, map[string]any{
+			"name":  m.Name,
+			"value": m.Value,
+			"type":  m.Type.String(),
+		})
+	}
+	return out
+}
+
+func startOrEndJSON(t parser.ItemType) any {
+	if t == 0 {
+		return nil
+	}
+	return t.String()
+}
+
+// jsParsePromQLToJSON returns {valid, ast}, ast being the tree as a JSON
+// string, as ParseAPLToJSON does for APL.
+func jsParsePromQLToJSON(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	out, err := json.Marshal(promASTJSON(expr))
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("ast", string(out))
+	return result
+}
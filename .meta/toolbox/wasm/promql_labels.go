@@ -0,0 +1,107 @@
+//go:build ignore
+
+package main
+
+import (
+	"slices"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// referencedLabels returns every label name expr touches, sorted: in
+// matchers, by/without and on/ignoring/group_x lists, the label count_values
+// writes, and the label arguments of label_replace, label_join and
+// sort_by_label. The __name__ matcher a metric name implies doesn't count.
+func referencedLabels(expr parser.Expr) []string {
+	names := []string{}
+	add := func(name string) {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	addString := func(arg parser.Expr) {
+		if s, ok := unparen(arg).(*parser.StringLiteral); ok {
+			add(s.Val)
+		}
+	}
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			for _, m := range n.LabelMatchers {
+				if m.Name == labels.MetricName && m.Type == labels.MatchEqual && m.Value == n.Name {
+					continue
+				}
+				add(m.Name)
+			}
+		case *parser.AggregateExpr:
+			for _, name := range n.Grouping {
+				add(name)
+			}
+			if n.Op == parser.COUNT_VALUES {
+				addString(n.Param)
+			}
+		case *parser.BinaryExpr:
+			if vm := n.VectorMatching; vm != nil {
+				for _, name := range vm.MatchingLabels {
+					add(name)
+				}
+				for _, name := range vm.Include {
+					add(name)
+				}
+			}
+		case *parser.Call:
+			var labelArgs []parser.Expr
+			switch n.Func.Name {
+			case "label_replace":
+				// label_replace(v, dst, replacement, src, regex)
+				if len(n.Args) == 5 {
+					labelArgs = []parser.Expr{n.Args[1], n.Args[3]}
+				}
+			case "label_join":
+				// label_join(v, dst, separator, src...)
+				if len(n.Args) >= 3 {
+					labelArgs = append([]parser.Expr{n.Args[1]}, n.Args[3:]...)
+				}
+			case "sort_by_label", "sort_by_label_desc":
+				if len(n.Args) > 1 {
+					labelArgs = n.Args[1:]
+				}
+			}
+			for _, arg := range labelArgs {
+				addString(arg)
+			}
+		}
+		return nil
+	})
+	slices.Sort(names)
+	return names
+}
+
+func unparen(expr parser.Expr) parser.Expr {
+	for {
+		p, ok := expr.(*parser.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = p.Expr
+	}
+}
+
+// jsReferencedLabelsPromQL returns the label names as a plain array, or the
+// ValidatePromQL result for an invalid query.
+func jsReferencedLabelsPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	return jsStrings(referencedLabels(expr))
+}
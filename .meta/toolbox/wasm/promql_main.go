@@ -5,37 +5,296 @@
 // TinyGo doesn't support.
 //
 // Build: cd /tmp/promql-validate-wasm && GOOS=js GOARCH=wasm go build -o promql-parser.wasm .
-// Requires its own go.mod with github.com/prometheus/prometheus dependency.
+// Requires its own go.mod, named toolbox, with github.com/prometheus/prometheus
+// dependency and validate/ staged next to it; build.sh does both.
 
 package main
 
 import (
+	"fmt"
+	"runtime/debug"
 	"syscall/js"
+	"unicode/utf8"
 
-	"github.com/prometheus/prometheus/promql/parser"
+	"toolbox/validate"
 )
 
-func jsValidatePromQL(this js.Value, args []js.Value) any {
-	if len(args) != 1 || args[0].Type() != js.TypeString {
-		result := js.Global().Get("Object").New()
-		result.Set("valid", false)
-		result.Set("error", "expected 1 string argument")
-		return result
+// Set at build time with -ldflags "-X main.buildCommit=...", see build.sh.
+var buildCommit = "unknown"
+
+const prometheusModule = "github.com/prometheus/prometheus"
+
+// errorSpan is the range of a single parse error in rune offsets, so the JS
+// side can index the query string without re-encoding it.
+type errorSpan struct {
+	Start   int
+	End     int
+	Message string
+	Code    string
+}
+
+// runeOffset converts a byte offset into src to a rune offset, clamping
+// out-of-range positions to the ends of the string.
+func runeOffset(src string, off int) int {
+	if off < 0 {
+		off = 0
+	}
+	if off > len(src) {
+		off = len(src)
+	}
+	return utf8.RuneCountInString(src[:off])
+}
+
+// errorSpans collects every position the Prometheus parser reported. It
+// returns nil when err carries no positions.
+func errorSpans(src string, err error) []errorSpan {
+	if err == nil {
+		return nil
+	}
+	var spans []errorSpan
+	for _, e := range validate.PromQLErrors(src, err) {
+		if e.HasPos {
+			spans = append(spans, errorSpan{
+				Start:   runeOffset(src, e.Start),
+				End:     runeOffset(src, e.End),
+				Message: e.Message,
+				Code:    e.Code,
+			})
+		}
+	}
+	return spans
+}
+
+func setPositions(result js.Value, src string, err error) {
+	spans := errorSpans(src, err)
+	positions := js.Global().Get("Array").New()
+	for i, span := range spans {
+		pos := js.Global().Get("Object").New()
+		pos.Set("start", span.Start)
+		pos.Set("end", span.End)
+		pos.Set("message", span.Message)
+		pos.Set("code", span.Code)
+		positions.SetIndex(i, pos)
+	}
+	result.Set("positions", positions)
+	if len(spans) == 0 {
+		result.Set("start", js.Null())
+		result.Set("end", js.Null())
+		return
+	}
+	result.Set("start", spans[0].Start)
+	result.Set("end", spans[0].End)
+}
+
+// invalidArgs is the result for a call with the wrong arguments.
+func invalidArgs(msg string) js.Value {
+	result := js.Global().Get("Object").New()
+	result.Set("valid", false)
+	result.Set("error", msg)
+	result.Set("code", validate.CodeInvalidArguments)
+	setPositions(result, "", nil)
+	return result
+}
+
+// internalError is the result for a call whose parser panicked with r.
+func internalError(r any) js.Value {
+	result := invalidArgs(fmt.Sprintf("internal parser error: %v", r))
+	result.Set("code", validate.CodeInternal)
+	return result
+}
+
+// invalidQuery is the result for a query that failed to parse. code,
+// unexpected and expected describe the first error; the last two are null
+// and empty when its message doesn't name them. unmatchedOpen is only set
+// when the query ends with a bracket open.
+func invalidQuery(src string, err error) js.Value {
+	result := js.Global().Get("Object").New()
+	result.Set("valid", false)
+	result.Set("error", err.Error())
+	setPositions(result, src, err)
+	result.Set("unexpected", js.Null())
+	result.Set("expected", jsStrings(nil))
+	result.Set("code", validate.CodeSyntaxError)
+	if errs := validate.PromQLErrors(src, err); len(errs) > 0 {
+		result.Set("code", errs[0].Code)
+		if errs[0].Unexpected != "" {
+			result.Set("unexpected", errs[0].Unexpected)
+		}
+		result.Set("expected", jsStrings(errs[0].Expected))
 	}
+	if pos := unmatchedOpen(src); pos != nil {
+		result.Set("unmatchedOpen", jsBracketPos(pos))
+	}
+	return result
+}
+
+func jsStrings(values []string) js.Value {
+	arr := js.Global().Get("Array").New()
+	for i, v := range values {
+		arr.SetIndex(i, v)
+	}
+	return arr
+}
 
-	_, err := parser.ParseExpr(args[0].String())
+// validResult is the result for a query that passed every check.
+func validResult() js.Value {
 	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("error", js.Null())
+	result.Set("code", js.Null())
+	setPositions(result, "", nil)
+	return result
+}
+
+// Sources up to cacheMaxBytes are cached, so cacheSize entries stay small.
+const (
+	cacheSize     = 256
+	cacheMaxBytes = 64 << 10
+)
+
+// promCache holds the parse error for each recently validated source, nil
+// for the valid ones. Results are rebuilt from it so no caller shares one.
+var promCache = validate.NewCache[error](cacheSize)
+
+func validatePromQL(src string) js.Value {
+	err, ok := promCache.Get(src)
+	if !ok {
+		_, err = validate.PromQL(src)
+		if len(src) <= cacheMaxBytes {
+			promCache.Add(src, err)
+		}
+	}
 	if err != nil {
-		result.Set("valid", false)
-		result.Set("error", err.Error())
-	} else {
-		result.Set("valid", true)
-		result.Set("error", js.Null())
+		return invalidQuery(src, err)
+	}
+	return validResult()
+}
+
+// jsClearValidationCache empties the ValidatePromQL cache, for when the
+// editor wants a fresh parse or a test wants a cold one.
+func jsClearValidationCache(this js.Value, args []js.Value) any {
+	promCache.Clear()
+	return js.Undefined()
+}
+
+func jsValidatePromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	return validatePromQL(args[0].String())
+}
+
+func jsValidatePromQLBatch(this js.Value, args []js.Value) any {
+	if len(args) != 1 || !js.Global().Get("Array").Call("isArray", args[0]).Bool() {
+		return invalidArgs("expected 1 array argument")
+	}
+
+	queries := args[0]
+	results := js.Global().Get("Array").New()
+	for i := 0; i < queries.Length(); i++ {
+		query := queries.Index(i)
+		if query.Type() != js.TypeString {
+			results.SetIndex(i, invalidArgs("expected string element"))
+			continue
+		}
+		results.SetIndex(i, validatePromQL(query.String()))
 	}
+	return results
+}
+
+// jsVersionInfo reports what this module was built from. It takes no
+// arguments and never fails. aplParserVersion lives in the other module.
+func jsVersionInfo(this js.Value, args []js.Value) any {
+	version := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == prometheusModule {
+				version = dep.Version
+			}
+		}
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("aplParserVersion", js.Null())
+	result.Set("promqlParserVersion", version)
+	result.Set("buildCommit", buildCommit)
+	return result
+}
+
+// jsCapabilities reports what this build offers: functions, the names of
+// everything it exports, and features, which languages it handles and
+// whether it converts between them. It takes no arguments and never fails.
+func jsCapabilities(this js.Value, args []js.Value) any {
+	features := js.Global().Get("Object").New()
+	features.Set("apl", false)
+	features.Set("promql", true)
+	features.Set("conversion", true)
+	result := js.Global().Get("Object").New()
+	result.Set("functions", jsStrings(exported))
+	result.Set("features", features)
 	return result
 }
 
+// exported lists, in order, the names export has installed.
+var exported []string
+
+// export installs fn on globalThis under name, guarded.
+func export(name string, fn func(js.Value, []js.Value) any) {
+	js.Global().Set(name, js.FuncOf(guarded(fn)))
+	exported = append(exported, name)
+}
+
+// guarded wraps fn so that a panic in a parser becomes an ordinary invalid
+// result instead of tearing down the whole module; stack exhaustion is
+// still fatal, as it is for any Go program.
+func guarded(fn func(js.Value, []js.Value) any) func(js.Value, []js.Value) any {
+	return func(this js.Value, args []js.Value) (result any) {
+		defer func() {
+			if r := recover(); r != nil {
+				result = internalError(r)
+			}
+		}()
+		return fn(this, args)
+	}
+}
+
 func main() {
-	js.Global().Set("ValidatePromQL", js.FuncOf(jsValidatePromQL))
+	exportAll()
 	select {}
 }
+
+// exportAll installs every export.
+func exportAll() {
+	export("ValidatePromQL", jsValidatePromQL)
+	export("ValidatePromQLBatch", jsValidatePromQLBatch)
+	export("ExtractSelectorsPromQL", jsExtractSelectorsPromQL)
+	export("ConvertPromQLToAPL", jsConvertPromQLToAPL)
+	export("ValidatePromQLTyped", jsValidatePromQLTyped)
+	export("ValidatePromQLStrict", jsValidatePromQLStrict)
+	export("ExtractTimeRangePromQL", jsExtractTimeRangePromQL)
+	export("AggregationsPromQL", jsAggregationsPromQL)
+	export("ValidatePromQLWithFeatures", jsValidatePromQLWithFeatures)
+	export("PromQLVersionInfo", jsVersionInfo)
+	export("EquivalentPromQL", jsEquivalentPromQL)
+	export("ValidateRulesPromQL", jsValidateRulesPromQL)
+	export("HasSubqueryPromQL", jsHasSubqueryPromQL)
+	export("ValidatePromQLTemplate", jsValidatePromQLTemplate)
+	export("EnforceLabelPromQL", jsEnforceLabelPromQL)
+	export("ClearPromQLValidationCache", jsClearValidationCache)
+	export("CardinalityWarningsPromQL", jsCardinalityWarningsPromQL)
+	export("CanonicalizePromQL", jsCanonicalizePromQL)
+	export("TokenizePromQL", jsTokenizePromQL)
+	export("AggregatesOverTimePromQL", jsAggregatesOverTimePromQL)
+	export("ReferencedLabelsPromQL", jsReferencedLabelsPromQL)
+	export("ValidateDuration", jsValidateDuration)
+	export("OutputLabelsPromQL", jsOutputLabelsPromQL)
+	export("ValidateSeriesSelectorPromQL", jsValidateSeriesSelectorPromQL)
+	export("ValidateRulesStream", jsValidateRulesStream)
+	export("MaxNestingDepthPromQL", jsMaxNestingDepthPromQL)
+	export("ParsePromQLToJSON", jsParsePromQLToJSON)
+	export("ResultTypePromQL", jsResultTypePromQL)
+	export("SelectorsOverlapPromQL", jsSelectorsOverlapPromQL)
+	export("PromQLSelectorToAPLFilter", jsPromQLSelectorToAPLFilter)
+	export("ValidatePromQLNoTrailing", jsValidatePromQLNoTrailing)
+	export("PromQLCapabilities", jsCapabilities)
+}
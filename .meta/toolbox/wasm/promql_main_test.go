@@ -0,0 +1,352 @@
+//go:build ignore
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"syscall/js"
+	"testing"
+	"unicode/utf8"
+
+	"toolbox/validate"
+)
+
+// call invokes an export the way JS does, with each argument converted by
+// js.ValueOf. wasm_exec decodes Go strings with a TextDecoder, which drops
+// a leading BOM, so a string argument gets its BOM back on the JS side.
+func call(fn func(js.Value, []js.Value) any, args ...any) js.Value {
+	vals := make([]js.Value, len(args))
+	for i, arg := range args {
+		vals[i] = js.ValueOf(arg)
+		if s, ok := arg.(string); ok && strings.HasPrefix(s, "\ufeff") {
+			str := js.Global().Get("String")
+			vals[i] = str.Get("prototype").Get("concat").Call("call", str.Call("fromCharCode", 0xfeff), s[len("\ufeff"):])
+		}
+	}
+	return js.ValueOf(fn(js.Undefined(), vals))
+}
+
+// TestWindowsSources checks that the exports parsing on their own accept a
+// BOM and Windows line breaks, as ValidatePromQL does.
+func TestWindowsSources(t *testing.T) {
+	exports := []struct {
+		name string
+		fn   func(js.Value, []js.Value) any
+		args []any
+	}{
+		{"ValidatePromQL", jsValidatePromQL, nil},
+		{"ValidatePromQLStrict", jsValidatePromQLStrict, nil},
+		{"ValidatePromQLTyped", jsValidatePromQLTyped, []any{"range"}},
+		{"ResultTypePromQL", jsResultTypePromQL, nil},
+		{"ValidatePromQLWithFeatures", jsValidatePromQLWithFeatures, nil},
+		{"ValidatePromQLNoTrailing", jsValidatePromQLNoTrailing, nil},
+		{"ValidateSeriesSelectorPromQL", jsValidateSeriesSelectorPromQL, nil},
+		{"CanonicalizePromQL", jsCanonicalizePromQL, nil},
+		{"HasSubqueryPromQL", jsHasSubqueryPromQL, nil},
+		{"CardinalityWarningsPromQL", jsCardinalityWarningsPromQL, nil},
+		{"ParsePromQLToJSON", jsParsePromQLToJSON, nil},
+	}
+	for _, src := range []string{"\ufeffx{job=\"a\"}", "x{job=\"a\"}\r\n", "x{\r\n  job=\"a\"\r\n}", "x{\rjob=\"a\"\r}"} {
+		for _, e := range exports {
+			result := call(e.fn, append([]any{src}, e.args...)...)
+			if !result.Get("valid").Bool() {
+				t.Errorf("%s(%q) is invalid: %s", e.name, src, result.Get("error").String())
+			}
+		}
+	}
+}
+
+func TestWindowsSourcePositions(t *testing.T) {
+	src := "\ufeffsum(\r\n  x +\r\n)"
+	result := call(jsValidatePromQLStrict, src)
+	if result.Get("valid").Bool() {
+		t.Fatalf("ValidatePromQLStrict(%q) is valid", src)
+	}
+	// Offsets count runes of the original source, BOM and \r included.
+	if start, want := result.Get("start").Int(), utf8.RuneCountInString(src)-1; start != want {
+		t.Errorf("ValidatePromQLStrict(%q) error at %d, want %d", src, start, want)
+	}
+}
+
+func TestGuardedPanic(t *testing.T) {
+	result := call(guarded(func(js.Value, []js.Value) any { panic("boom") }))
+	if result.Get("valid").Bool() || result.Get("code").String() != validate.CodeInternal {
+		t.Errorf("guarded panic = valid %v, code %s", result.Get("valid").Bool(), result.Get("code").String())
+	}
+	if msg := result.Get("error").String(); !strings.Contains(msg, "boom") {
+		t.Errorf("guarded panic error %q doesn't carry the panic value", msg)
+	}
+}
+
+func TestConvertPromQL(t *testing.T) {
+	series := []string{"instance", "job"}
+	tests := []struct {
+		src    string
+		series []string
+		want   string // the APL, or the error
+	}{
+		{`x{job="api", code=~"5.."}`, nil, "['x']\n| where job == \"api\" and code matches regex \"^(?:5..)$\""},
+		{`x{path="a\"b\\c\n"}`, nil, `['x']` + "\n" + `| where path == "a\"b\\c\n"`},
+		{`x{path="\x01é"}`, nil, "['x']\n| where path == \"\x01é\""},
+		{`rate(x[5m])`, nil, "unsupported: rate without the series labels"},
+		{`rate(x[5m])`, series, "['x']\n| summarize value = rate(value) by bin(_time, 5m), instance, job"},
+		{`sum by (job) (increase(x[1h]))`, series, "['x']\n| summarize value = max(value) - min(value) by bin(_time, 1h), job, instance\n| summarize value = sum(value) by _time, job"},
+		{`rate(x[5m])`, []string{"k8s.pod"}, "['x']\n| summarize value = rate(value) by bin(_time, 5m), [\"k8s.pod\"]"},
+	}
+	for _, tt := range tests {
+		expr, err := validate.ParsePromQL(tt.src)
+		if err != nil {
+			t.Fatalf("ParsePromQL(%q): %v", tt.src, err)
+		}
+		got, err := convertPromQL(expr, tt.series)
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("convertPromQL(%q, %q) =\n%s\nwant\n%s", tt.src, tt.series, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePromQLTyped(t *testing.T) {
+	src := " x[5m]"
+	result := call(jsValidatePromQLTyped, src, "range")
+	if result.Get("valid").Bool() {
+		t.Fatalf("ValidatePromQLTyped(%q, range) is valid", src)
+	}
+	if code := result.Get("code").String(); code != validate.CodeTypeMismatch {
+		t.Errorf("ValidatePromQLTyped(%q, range) code %s, want %s", src, code, validate.CodeTypeMismatch)
+	}
+	if start, end := result.Get("start").Int(), result.Get("end").Int(); start != 1 || end != len(src) {
+		t.Errorf("ValidatePromQLTyped(%q, range) spans %d-%d, want the expression", src, start, end)
+	}
+	if n := result.Get("positions").Length(); n != 1 {
+		t.Errorf("ValidatePromQLTyped(%q, range) has %d positions, want 1", src, n)
+	}
+	if got := result.Get("exprType").String(); got != "range_vector" {
+		t.Errorf("ValidatePromQLTyped(%q, range) exprType %s", src, got)
+	}
+	if !call(jsValidatePromQLTyped, src, "instant").Get("valid").Bool() {
+		t.Errorf("ValidatePromQLTyped(%q, instant) is invalid", src)
+	}
+	if code := call(jsValidatePromQLTyped, src, "sometimes").Get("code").String(); code != validate.CodeInvalidArguments {
+		t.Errorf("ValidatePromQLTyped(%q, sometimes) code %s", src, code)
+	}
+}
+
+func TestCanonicalPromQL(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{`b + a`, `a + b`, true},
+		{`c * (b * a)`, `a * b * c`, true},
+		{`(b + a) * c`, `c * (a + b)`, true},
+		{`x{b="1", a="2"} + 2`, `2 + x{a="2", b="1"}`, true},
+		{`sum by (job) (y) + sum by (job) (x)`, `sum by (job) (x) + sum by (job) (y)`, true},
+		{`b - a + c`, `c + (b - a)`, true},
+		{`b - a`, `a - b`, false},
+		{`b + on(job) a`, `a + on(job) b`, false},
+		{`b + ignoring(job) a`, `a + ignoring(job) b`, false},
+		{`b * on(job) group_left a`, `a * on(job) group_left b`, false},
+		{`b and a`, `a and b`, false},
+		{`b + a * c`, `(a + b) * c`, false},
+		{`x > 1e3`, `x > 1000`, true},
+		{`x > 0x3e8`, `x > 1000`, true},
+		{`rate(x[60s] offset 1h)`, `rate(x[1m] offset 60m)`, true},
+		{`x[5m:30s]`, `x[300s:30000ms]`, true},
+		{`x > 5m`, `x > 300`, true},
+		{`x > 1e3`, `x > 100`, false},
+	}
+	canonical := func(src string) string {
+		expr, err := validate.ParsePromQL(src)
+		if err != nil {
+			t.Fatalf("ParsePromQL(%q): %v", src, err)
+		}
+		return canonicalPromQL(expr)
+	}
+	for _, tt := range tests {
+		a, b := canonical(tt.a), canonical(tt.b)
+		if (a == b) != tt.same {
+			t.Errorf("canonicalPromQL(%q) = %s, canonicalPromQL(%q) = %s, want same %v", tt.a, a, tt.b, b, tt.same)
+		}
+		if again := canonical(a); again != a {
+			t.Errorf("canonicalPromQL(%q) = %s, but %s canonicalizes to %s", tt.a, a, a, again)
+		}
+	}
+}
+
+func TestValidatePromQLStrictMatching(t *testing.T) {
+	tests := []struct {
+		src      string
+		messages []string
+		spans    []string // the text of each position, nil when the parser places it
+	}{
+		{`a + on(x, y) b`, nil, nil},
+		{`a > bool on(x) group_right(y) b`, nil, nil},
+		{`a * group_left b`, []string{"group_left needs on(...) or ignoring(...) before it"}, []string{"group_left"}},
+		{`a and on(x) group_left b`, []string{`no grouping allowed for "and" operation`, "set operations must always be many-to-many"}, nil},
+		{`a + bool b`, []string{"bool modifier can only be used on comparison operators"}, nil},
+		{`a * on(x) group_left(x) b`, []string{`label "x" must not occur in ON and GROUP clause at once`}, nil},
+		{`a + on(x, x) b`, []string{`label "x" is repeated in on()`}, []string{"on(x, x)"}},
+		{`a + IGNORING(x, "x") b`, []string{`label "x" is repeated in ignoring()`}, []string{`IGNORING(x, "x")`}},
+		{`a * on(x) group_left(y, y) b`, []string{`label "y" is repeated in group_left()`}, []string{"group_left(y, y)"}},
+		{`a + on(x, x) b + ignoring(y, y) c`, []string{`label "x" is repeated in on()`, `label "y" is repeated in ignoring()`}, []string{"on(x, x)", "ignoring(y, y)"}},
+	}
+	for _, tt := range tests {
+		result := call(jsValidatePromQLStrict, tt.src)
+		if valid := result.Get("valid").Bool(); valid != (tt.messages == nil) {
+			t.Errorf("ValidatePromQLStrict(%q) valid %v", tt.src, valid)
+			continue
+		}
+		if tt.messages == nil {
+			continue
+		}
+		positions := result.Get("positions")
+		if positions.Length() != len(tt.messages) {
+			t.Errorf("ValidatePromQLStrict(%q) has %d positions, want %d", tt.src, positions.Length(), len(tt.messages))
+			continue
+		}
+		for i, want := range tt.messages {
+			p := positions.Index(i)
+			if msg := p.Get("message").String(); msg != want {
+				t.Errorf("ValidatePromQLStrict(%q) position %d says %q, want %q", tt.src, i, msg, want)
+			}
+			if tt.spans != nil {
+				if span := tt.src[p.Get("start").Int():p.Get("end").Int()]; span != tt.spans[i] {
+					t.Errorf("ValidatePromQLStrict(%q) position %d spans %q, want %q", tt.src, i, span, tt.spans[i])
+				}
+			}
+		}
+	}
+}
+
+func TestValidatePromQLNoTrailing(t *testing.T) {
+	tests := []struct {
+		src      string
+		trailing bool
+	}{
+		{`up up`, true},
+		{`sum(x) rate(y[5m])`, true},
+		{`x{a="b"} }`, true},
+		{"up # c\n up", true},
+		{`x{a}`, false},
+		{`x + `, false},
+	}
+	stringify := js.Global().Get("JSON").Get("stringify")
+	for _, tt := range tests {
+		got, base := call(jsValidatePromQLNoTrailing, tt.src), call(jsValidatePromQL, tt.src)
+		if got.Get("valid").Bool() {
+			t.Errorf("ValidatePromQLNoTrailing(%q) is valid", tt.src)
+			continue
+		}
+		if msg := got.Get("error").String(); strings.Contains(msg, "trailing input") != tt.trailing {
+			t.Errorf("ValidatePromQLNoTrailing(%q) error %q", tt.src, msg)
+		}
+		for _, field := range []string{"unexpected", "expected"} {
+			if g, w := stringify.Invoke(got.Get(field)).String(), stringify.Invoke(base.Get(field)).String(); g != w {
+				t.Errorf("ValidatePromQLNoTrailing(%q) %s = %s, ValidatePromQL's %s", tt.src, field, g, w)
+			}
+		}
+	}
+	if !call(jsValidatePromQLNoTrailing, `up`).Get("valid").Bool() {
+		t.Error("ValidatePromQLNoTrailing(up) is invalid")
+	}
+}
+
+func TestValidatePromQLTemplate(t *testing.T) {
+	vars := map[string]any{"interval": "5m", "ns": "prod"}
+	tests := []struct {
+		src        string
+		vars       map[string]any
+		expanded   string // empty when the query is invalid
+		unresolved string // the text of the first unresolved placeholder
+	}{
+		{`label_replace(up, "dst", "$1", "src", "(.*)")`, map[string]any{}, `label_replace(up, "dst", "$1", "src", "(.*)")`, ""},
+		{`label_replace(up, "dst", "${1}-$2", "src", "(.*)-(.*)")`, map[string]any{}, `label_replace(up, "dst", "${1}-$2", "src", "(.*)-(.*)")`, ""},
+		{"rate(x[$interval]) # per $interval, not $nope", vars, "rate(x[5m]) # per $interval, not $nope", ""},
+		{`rate(x{ns="#$ns"}[${interval:text}])`, vars, `rate(x{ns="#prod"}[5m])`, ""},
+		{`rate(x[$nope])`, vars, "", "$nope"},
+		{`label_replace(x{ns="$ns"}, "d", "$1", "s", "(.*)")`, map[string]any{}, "", "$ns"},
+	}
+	for _, tt := range tests {
+		result := call(jsValidatePromQLTemplate, tt.src, tt.vars)
+		if valid := result.Get("valid").Bool(); valid != (tt.expanded != "") {
+			t.Errorf("ValidatePromQLTemplate(%q) valid %v: %v", tt.src, valid, result.Get("error"))
+			continue
+		}
+		if tt.expanded != "" {
+			if got := result.Get("expanded").String(); got != tt.expanded {
+				t.Errorf("ValidatePromQLTemplate(%q) expanded to %q, want %q", tt.src, got, tt.expanded)
+			}
+			continue
+		}
+		if got := tt.src[result.Get("start").Int():result.Get("end").Int()]; got != tt.unresolved {
+			t.Errorf("ValidatePromQLTemplate(%q) points at %q, want %q", tt.src, got, tt.unresolved)
+		}
+	}
+}
+
+var exportOnce sync.Once
+
+// TestAdversarialInputs calls every export, as JS does, with inputs that
+// have made parsers panic or blow up elsewhere. A panic that escapes the
+// guard fails the whole test binary.
+func TestAdversarialInputs(t *testing.T) {
+	exportOnce.Do(exportAll)
+	const depth = 500
+	inputs := []string{
+		strings.Repeat("(", depth) + "x" + strings.Repeat(")", depth),
+		strings.Repeat("sum(", depth) + "x" + strings.Repeat(")", depth),
+		strings.Repeat("-", depth) + "x",
+		strings.Repeat("x + ", depth) + "x",
+		strings.Repeat("(", depth),
+		"rate(x[5m:1m])" + strings.Repeat("[5m:1m]", depth),
+		strings.Repeat("a", 1<<16),
+		"x{" + strings.Repeat(`a="b",`, depth) + "}",
+		"x{a=~\"" + strings.Repeat("(", depth) + "\"}",
+		"\"" + strings.Repeat(`\`, 1<<12),
+		"\x00\xff\ufeff",
+	}
+	for _, name := range exported {
+		fn := js.Global().Get(name)
+		for _, src := range inputs {
+			fn.Invoke(src)
+			fn.Invoke(src, src)
+		}
+	}
+}
+
+func TestSelectorsOverlapPairLimit(t *testing.T) {
+	src := strings.Repeat("x + ", maxSelectorPairs/64) + "x"
+	result := call(jsSelectorsOverlapPromQL, src, src)
+	if code := result.Get("code").String(); code != validate.CodeQueryTooLong {
+		t.Errorf("SelectorsOverlapPromQL over %d pairs: code %s", maxSelectorPairs, code)
+	}
+	if !call(jsSelectorsOverlapPromQL, src, "x").Get("valid").Bool() {
+		t.Errorf("SelectorsOverlapPromQL under %d pairs is invalid", maxSelectorPairs)
+	}
+}
+
+const benchPromQL = `sum by (job, instance) (rate(http_requests_total{job=~"api|web", code=~"5.."}[5m])) / on (job, instance) sum by (job, instance) (rate(http_requests_total[5m]))`
+
+// BenchmarkValidatePromQL compares a cache hit with a cold parse of the
+// same query. A hit only pays for building the result object, which here
+// is around a tenth of the cold cost.
+func BenchmarkValidatePromQL(b *testing.B) {
+	args := []js.Value{js.ValueOf(benchPromQL)}
+	b.Run("cold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			jsClearValidationCache(js.Undefined(), nil)
+			jsValidatePromQL(js.Undefined(), args)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		jsValidatePromQL(js.Undefined(), args)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			jsValidatePromQL(js.Undefined(), args)
+		}
+	})
+}
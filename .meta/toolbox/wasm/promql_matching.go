@@ -0,0 +1,96 @@
+//go:build ignore
+
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
+)
+
+// matchingClause finds an on, ignoring, group_left or group_right label
+// list. Keywords are case-insensitive in PromQL.
+var matchingClause = regexp.MustCompile(`(?i)\b(on|ignoring|group_left|group_right)\s*\([^)]*\)`)
+
+// checkVectorMatching reports every label named twice in the same on,
+// ignoring, group_left or group_right list. The parser already rejects a
+// grouping without on or ignoring, a grouping of a set operation, bool on
+// a non-comparison and a label in both on and the grouping; repeats are
+// what it lets through. Each one is a ParseErr spanning its clause, so
+// they all show up in positions, in source order.
+func checkVectorMatching(src string, expr parser.Expr) error {
+	var errs parser.ParseErrors
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		be, ok := node.(*parser.BinaryExpr)
+		if !ok || be.VectorMatching == nil {
+			return nil
+		}
+		start, end := int(be.LHS.PositionRange().End), int(be.RHS.PositionRange().Start)
+		if start < 0 || end > len(src) || start > end {
+			return nil
+		}
+		for _, loc := range matchingClause.FindAllStringSubmatchIndex(src[start:end], -1) {
+			keyword := strings.ToLower(src[start+loc[2] : start+loc[3]])
+			if dup := repeatedLabel(src[start+loc[0] : start+loc[1]]); dup != "" {
+				errs = append(errs, parser.ParseErr{
+					PositionRange: posrange.PositionRange{Start: posrange.Pos(start + loc[0]), End: posrange.Pos(start + loc[1])},
+					Err:           fmt.Errorf("label %q is repeated in %s()", dup, keyword),
+					Query:         src,
+				})
+			}
+		}
+		return nil
+	})
+	if len(errs) == 0 {
+		return nil
+	}
+	slices.SortFunc(errs, func(a, b parser.ParseErr) int { return cmp.Compare(a.PositionRange.Start, b.PositionRange.Start) })
+	return errs
+}
+
+// repeatedLabel returns the first label named twice in a clause such as
+// on(a, b), or "".
+func repeatedLabel(clause string) string {
+	list := clause[strings.IndexByte(clause, '(')+1 : len(clause)-1]
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.Trim(strings.TrimSpace(name), `"`)
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return name
+		}
+		seen[name] = true
+	}
+	return ""
+}
+
+// explainGrouping rewords the parser's bare "unexpected <group_left>" for
+// a grouping with no on or ignoring in front of it, the one vector
+// matching mistake it doesn't name.
+func explainGrouping(err error) error {
+	var errs parser.ParseErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	out := make(parser.ParseErrors, len(errs))
+	for i, e := range errs {
+		out[i] = e
+		if e.Err == nil {
+			continue
+		}
+		for _, kw := range []string{"group_left", "group_right"} {
+			if e.Err.Error() == "unexpected <"+kw+">" {
+				out[i].Err = fmt.Errorf("%s needs on(...) or ignoring(...) before it", kw)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+//go:build ignore
+
+package main
+
+import (
+	"slices"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// Output label modes.
+const (
+	// Exactly the listed labels, as after by (...).
+	outputKeep = "keep"
+	// Every input label except the listed ones, as after without (...).
+	outputDropExcept = "drop_except"
+	// Whatever labels the selected series have, plus the listed ones. Nothing
+	// aggregates them away.
+	outputPassthrough = "passthrough"
+	// Depends on the data, as for a or b, absent(...) and the like.
+	outputUnknown = "unknown"
+)
+
+type labelSet struct {
+	Mode   string
+	Labels []string
+}
+
+// outputLabels infers from the text alone which labels the series expr
+// returns carry. __name__ isn't tracked: functions and operators drop it,
+// but it never makes a column.
+func outputLabels(expr parser.Expr) labelSet {
+	expr = unparen(expr)
+	if t := expr.Type(); t == parser.ValueTypeScalar || t == parser.ValueTypeString {
+		return labelSet{Mode: outputKeep}
+	}
+	switch e := expr.(type) {
+	case *parser.VectorSelector, *parser.MatrixSelector:
+		return labelSet{Mode: outputPassthrough}
+
+	case *parser.SubqueryExpr:
+		return outputLabels(e.Expr)
+
+	case *parser.AggregateExpr:
+		switch e.Op {
+		case parser.TOPK, parser.BOTTOMK, parser.LIMITK, parser.LIMIT_RATIO:
+			// These pick series rather than merging them.
+			return outputLabels(e.Expr)
+		}
+		s := labelSet{Mode: outputKeep, Labels: slices.Clone(e.Grouping)}
+		if e.Without {
+			s = outputLabels(e.Expr).drop(e.Grouping)
+		}
+		if e.Op == parser.COUNT_VALUES {
+			if name, ok := unparen(e.Param).(*parser.StringLiteral); ok {
+				s = s.add(name.Val)
+			}
+		}
+		return s
+
+	case *parser.Call:
+		switch e.Func.Name {
+		case "absent", "absent_over_time":
+			return labelSet{Mode: outputUnknown}
+		case "vector":
+			return labelSet{Mode: outputKeep}
+		case "label_replace", "label_join":
+			if dst, ok := unparen(e.Args[1]).(*parser.StringLiteral); ok {
+				return outputLabels(e.Args[0]).add(dst.Val)
+			}
+			return labelSet{Mode: outputUnknown}
+		}
+		for _, arg := range e.Args {
+			if t := arg.Type(); t == parser.ValueTypeVector || t == parser.ValueTypeMatrix {
+				return outputLabels(arg)
+			}
+		}
+
+	case *parser.BinaryExpr:
+		if e.LHS.Type() == parser.ValueTypeScalar {
+			return outputLabels(e.RHS)
+		}
+		if e.RHS.Type() == parser.ValueTypeScalar {
+			return outputLabels(e.LHS)
+		}
+		vm := e.VectorMatching
+		switch {
+		case e.Op == parser.LOR:
+			return labelSet{Mode: outputUnknown}
+		case e.Op == parser.LAND || e.Op == parser.LUNLESS || vm == nil:
+			return outputLabels(e.LHS)
+		case vm.Card == parser.CardManyToOne:
+			return outputLabels(e.LHS).add(vm.Include...)
+		case vm.Card == parser.CardOneToMany:
+			return outputLabels(e.RHS).add(vm.Include...)
+		case vm.On:
+			return labelSet{Mode: outputKeep, Labels: slices.Clone(vm.MatchingLabels)}
+		default:
+			return outputLabels(e.LHS).drop(vm.MatchingLabels)
+		}
+	}
+	return labelSet{Mode: outputUnknown}
+}
+
+// add records labels that are set on every output series.
+func (s labelSet) add(names ...string) labelSet {
+	switch s.Mode {
+	case outputKeep, outputPassthrough:
+		for _, name := range names {
+			if !slices.Contains(s.Labels, name) {
+				s.Labels = append(slices.Clone(s.Labels), name)
+			}
+		}
+	case outputDropExcept:
+		s.Labels = slices.DeleteFunc(slices.Clone(s.Labels), func(l string) bool { return slices.Contains(names, l) })
+	}
+	return s
+}
+
+// drop records labels that are removed from every output series.
+func (s labelSet) drop(names []string) labelSet {
+	if len(names) == 0 {
+		return s
+	}
+	switch s.Mode {
+	case outputKeep:
+		s.Labels = slices.DeleteFunc(slices.Clone(s.Labels), func(l string) bool { return slices.Contains(names, l) })
+	case outputPassthrough, outputDropExcept:
+		if s.Mode == outputPassthrough {
+			s.Labels = nil
+		}
+		s.Mode = outputDropExcept
+		for _, name := range names {
+			if !slices.Contains(s.Labels, name) {
+				s.Labels = append(slices.Clone(s.Labels), name)
+			}
+		}
+	}
+	return s
+}
+
+// jsOutputLabelsPromQL is ValidatePromQL plus mode and a sorted labels
+// array, read as described for the output label modes above.
+func jsOutputLabelsPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	s := outputLabels(expr)
+	labels := slices.Clone(s.Labels)
+	slices.Sort(labels)
+	result := validResult()
+	result.Set("mode", s.Mode)
+	result.Set("labels", jsStrings(labels))
+	return result
+}
@@ -0,0 +1,136 @@
+//go:build ignore
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/model/labels"
+
+	"toolbox/validate"
+)
+
+// maxSelectorPairs bounds how many pairs overlapSelectors compares, since
+// the count grows with the product of the two queries' selectors.
+const maxSelectorPairs = 1 << 12
+
+// selectorOverlap compares selector A of one query with selector B of the
+// other. Label is the label that keeps them apart, "" when they overlap.
+type selectorOverlap struct {
+	A, B    int
+	Overlap bool
+	Label   string
+}
+
+// overlapSelectors compares every selector of a with every selector of b.
+// side is "a" or "b" when that one didn't parse, "" when there are more
+// than maxSelectorPairs pairs.
+func overlapSelectors(a, b string) (pairs []selectorOverlap, side string, err error) {
+	exprA, err := validate.ParsePromQL(a)
+	if err != nil {
+		return nil, "a", err
+	}
+	exprB, err := validate.ParsePromQL(b)
+	if err != nil {
+		return nil, "b", err
+	}
+	selsA, selsB := extractSelectors(exprA), extractSelectors(exprB)
+	if len(selsA)*len(selsB) > maxSelectorPairs {
+		return nil, "", fmt.Errorf("comparing %d by %d selectors exceeds %d pairs", len(selsA), len(selsB), maxSelectorPairs)
+	}
+	for i, sa := range selsA {
+		for j, sb := range selsB {
+			label, disjoint := disjointOn(sa.allMatchers(), sb.allMatchers())
+			pairs = append(pairs, selectorOverlap{A: i, B: j, Overlap: !disjoint, Label: label})
+		}
+	}
+	return pairs, "", nil
+}
+
+// allMatchers puts back the __name__ matcher extractSelectors folds into
+// Metric.
+func (sel selector) allMatchers() []*labels.Matcher {
+	if sel.Metric == "" {
+		return sel.Matchers
+	}
+	return append([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, sel.Metric)}, sel.Matchers...)
+}
+
+// disjointOn looks for a label no series can satisfy both sets of matchers
+// on. That needs a finite set of values the label could take, from an =
+// matcher or a =~ of literal alternatives; any value from it that every
+// matcher on the label accepts could be shared. Without such a set nothing
+// is proven, so the selectors may overlap.
+func disjointOn(a, b []*labels.Matcher) (string, bool) {
+	all := append(slices.Clone(a), b...)
+	for _, m := range all {
+		var values []string
+		switch m.Type {
+		case labels.MatchEqual:
+			values = []string{m.Value}
+		case labels.MatchRegexp:
+			values = m.SetMatches()
+		}
+		if len(values) == 0 {
+			continue
+		}
+		possible := slices.ContainsFunc(values, func(v string) bool {
+			return !slices.ContainsFunc(all, func(other *labels.Matcher) bool {
+				return other.Name == m.Name && !other.Matches(v)
+			})
+		})
+		if !possible {
+			return m.Name, true
+		}
+	}
+	return "", false
+}
+
+// jsSelectorsOverlapPromQL returns {valid, overlap, details}, overlap
+// being whether any selector of a could select a series a selector of b
+// does. details has one {a, b, overlap, reason} per pair, a and b indexing
+// the selectors in the order ExtractSelectorsPromQL gives them, and reason
+// saying which label keeps a disjoint pair apart, null for the rest. If
+// either query is invalid the result is its usual invalid result with side
+// "a" or "b"; more than maxSelectorPairs pairs is a query_too_long error.
+func jsSelectorsOverlapPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeString {
+		return invalidArgs("expected 2 string arguments")
+	}
+
+	pairs, side, err := overlapSelectors(args[0].String(), args[1].String())
+	if err != nil && side == "" {
+		result := invalidArgs(err.Error())
+		result.Set("code", validate.CodeQueryTooLong)
+		return result
+	}
+	if err != nil {
+		src := args[0].String()
+		if side == "b" {
+			src = args[1].String()
+		}
+		result := invalidQuery(src, err)
+		result.Set("side", side)
+		return result
+	}
+	overlap := false
+	details := js.Global().Get("Array").New()
+	for i, p := range pairs {
+		overlap = overlap || p.Overlap
+		obj := js.Global().Get("Object").New()
+		obj.Set("a", p.A)
+		obj.Set("b", p.B)
+		obj.Set("overlap", p.Overlap)
+		obj.Set("reason", js.Null())
+		if !p.Overlap {
+			obj.Set("reason", fmt.Sprintf("no series can match both on label %q", p.Label))
+		}
+		details.SetIndex(i, obj)
+	}
+	result := validResult()
+	result.Set("overlap", overlap)
+	result.Set("details", details)
+	return result
+}
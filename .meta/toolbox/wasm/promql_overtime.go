@@ -0,0 +1,55 @@
+//go:build ignore
+
+package main
+
+import (
+	"slices"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// overTimeFunctions returns, in order of first use, every function in expr
+// that reads a range of samples: the *_over_time family, rate, increase,
+// delta and the like. They're told apart by taking a range vector, so
+// functions added upstream are picked up without a list to maintain. The
+// bool reports whether expr smooths over time at all, which a subquery
+// does too even when nothing consumes its range.
+func overTimeFunctions(expr parser.Expr) ([]string, bool) {
+	names := []string{}
+	overTime := false
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.SubqueryExpr:
+			overTime = true
+		case *parser.Call:
+			if slices.Contains(n.Func.ArgTypes, parser.ValueTypeMatrix) {
+				overTime = true
+				if !slices.Contains(names, n.Func.Name) {
+					names = append(names, n.Func.Name)
+				}
+			}
+		}
+		return nil
+	})
+	return names, overTime
+}
+
+func jsAggregatesOverTimePromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	names, overTime := overTimeFunctions(expr)
+	result := validResult()
+	result.Set("overTime", overTime)
+	result.Set("functions", jsStrings(names))
+	return result
+}
@@ -0,0 +1,35 @@
+//go:build ignore
+
+package main
+
+import "syscall/js"
+
+// jsValidateRulesPromQL validates the expr of each {name, expr} rule and
+// keeps the name on its result, in input order.
+func jsValidateRulesPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || !js.Global().Get("Array").Call("isArray", args[0]).Bool() {
+		return invalidArgs("expected 1 array argument")
+	}
+
+	rules := args[0]
+	results := js.Global().Get("Array").New()
+	for i := 0; i < rules.Length(); i++ {
+		rule := rules.Index(i)
+		var result js.Value
+		name := js.Null()
+		switch {
+		case rule.Type() != js.TypeObject:
+			result = invalidArgs("expected rule object")
+		case rule.Get("expr").Type() != js.TypeString:
+			result = invalidArgs("rule has no expr string")
+		default:
+			result = validatePromQL(rule.Get("expr").String())
+		}
+		if rule.Type() == js.TypeObject && rule.Get("name").Type() == js.TypeString {
+			name = rule.Get("name")
+		}
+		result.Set("name", name)
+		results.SetIndex(i, result)
+	}
+	return results
+}
@@ -0,0 +1,152 @@
+//go:build ignore
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+type selector struct {
+	Metric     string
+	Matchers   []*labels.Matcher
+	Offset     time.Duration // as written, 0 for none
+	Timestamp  *int64        // @ modifier in milliseconds
+	StartOrEnd parser.ItemType
+}
+
+// extractSelectors returns every vector selector in expr, including those
+// under matrix selectors, subqueries and binary operations. The __name__
+// matcher implied by the metric name is folded into Metric.
+func extractSelectors(expr parser.Expr) []selector {
+	var selectors []selector
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		sel := selector{Metric: vs.Name, Offset: vs.OriginalOffset, Timestamp: vs.Timestamp, StartOrEnd: vs.StartOrEnd}
+		for _, m := range vs.LabelMatchers {
+			if m.Name == labels.MetricName && m.Type == labels.MatchEqual && m.Value == vs.Name {
+				continue
+			}
+			sel.Matchers = append(sel.Matchers, m)
+		}
+		selectors = append(selectors, sel)
+		return nil
+	})
+	return selectors
+}
+
+// timeDescription says in words which time sel reads, e.g. "data from 5
+// minutes before the end of the query range". It only looks at the
+// selector's own modifiers, and is "" when there are none.
+func (sel selector) timeDescription() string {
+	var at string
+	switch {
+	case sel.Timestamp != nil:
+		at = time.UnixMilli(*sel.Timestamp).UTC().Format(time.RFC3339Nano)
+	case sel.StartOrEnd == parser.START:
+		at = "the start of the query range"
+	case sel.StartOrEnd == parser.END:
+		at = "the end of the query range"
+	}
+	switch {
+	case sel.Offset == 0 && at == "":
+		return ""
+	case sel.Offset == 0:
+		return "data at " + at
+	case at == "" && sel.Offset > 0:
+		return "data from " + spelledDuration(sel.Offset) + " ago"
+	case at == "":
+		return "data from " + spelledDuration(-sel.Offset) + " ahead of the evaluation time"
+	case sel.Offset > 0:
+		return "data from " + spelledDuration(sel.Offset) + " before " + at
+	}
+	return "data from " + spelledDuration(-sel.Offset) + " after " + at
+}
+
+// spelledDuration writes a positive d out in PromQL's units, largest first:
+// 90m is "1 hour 30 minutes".
+func spelledDuration(d time.Duration) string {
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"week", 7 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+		{"millisecond", time.Millisecond},
+	}
+	var parts []string
+	for _, u := range units {
+		n := d / u.size
+		if n == 0 {
+			continue
+		}
+		d -= n * u.size
+		part := strconv.FormatInt(int64(n), 10) + " " + u.name
+		if n != 1 {
+			part += "s"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+func jsExtractSelectorsPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	selectors := js.Global().Get("Array").New()
+	for i, sel := range extractSelectors(expr) {
+		obj := js.Global().Get("Object").New()
+		obj.Set("metric", sel.Metric)
+		obj.Set("matchers", jsMatchers(sel.Matchers))
+		obj.Set("offset", js.Null())
+		if sel.Offset != 0 {
+			obj.Set("offset", promDuration(sel.Offset))
+		}
+		obj.Set("at", js.Null())
+		if at := atModifier(sel.Timestamp, sel.StartOrEnd); at != "" {
+			obj.Set("at", at)
+		}
+		if desc := sel.timeDescription(); desc != "" {
+			obj.Set("timeDescription", desc)
+		}
+		selectors.SetIndex(i, obj)
+	}
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("selectors", selectors)
+	return result
+}
+
+// jsMatchers returns matchers as an array of {name, op, value}.
+func jsMatchers(matchers []*labels.Matcher) js.Value {
+	arr := js.Global().Get("Array").New()
+	for i, m := range matchers {
+		obj := js.Global().Get("Object").New()
+		obj.Set("name", m.Name)
+		obj.Set("op", m.Type.String())
+		obj.Set("value", m.Value)
+		arr.SetIndex(i, obj)
+	}
+	return arr
+}
@@ -0,0 +1,47 @@
+//go:build ignore
+
+package main
+
+import (
+	"errors"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+var errNotSeriesSelector = errors.New("not a series selector")
+
+// jsValidateSeriesSelectorPromQL checks src against the grammar of the
+// match[] parameter of /series and the label endpoints: one selector, with
+// or without a metric name, and no range, offset or @. It returns
+// ValidatePromQL's result plus matchers, an array of {name, op, value}
+// with the metric name as a __name__ matcher. Valid expressions that
+// aren't selectors fail with "not a series selector" over their whole
+// span.
+func jsValidateSeriesSelectorPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	n := validate.Normalize(src)
+	matchers, err := parser.ParseMetricSelector(n.Text)
+	if err != nil {
+		err = n.PromQLError(err)
+		if expr, exprErr := validate.ParsePromQL(src); exprErr == nil {
+			err = parser.ParseErrors{{
+				PositionRange: expr.PositionRange(),
+				Err:           errNotSeriesSelector,
+				Query:         src,
+			}}
+		}
+		result := invalidQuery(src, err)
+		result.Set("matchers", jsMatchers(nil))
+		return result
+	}
+	result := validResult()
+	result.Set("matchers", jsMatchers(matchers))
+	return result
+}
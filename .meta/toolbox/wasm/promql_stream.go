@@ -0,0 +1,73 @@
+//go:build ignore
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+// jsValidateRulesStream validates expressions one at a time, pulling them
+// from handle.next() until it returns null or undefined and passing each
+// result to handle.report(result), so a large rule file never has to be in
+// memory as a whole. Anything but a string from next() is reported as an
+// invalid_arguments result.
+//
+// It returns {complete, count, invalid, error}: how many results were
+// reported and how many of those were invalid. When next or report throws,
+// the stream stops there, complete is false and error holds the message;
+// otherwise error is null.
+func jsValidateRulesStream(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeObject ||
+		args[0].Get("next").Type() != js.TypeFunction || args[0].Get("report").Type() != js.TypeFunction {
+		return invalidArgs("expected an object with next and report functions")
+	}
+
+	handle := args[0]
+	count, invalid := 0, 0
+	var err error
+	for {
+		var expr js.Value
+		if expr, err = callJS(handle, "next"); err != nil || expr.IsNull() || expr.IsUndefined() {
+			break
+		}
+		var result js.Value
+		if expr.Type() != js.TypeString {
+			result = invalidArgs("expected string expression")
+		} else {
+			result = validatePromQL(expr.String())
+		}
+		if _, err = callJS(handle, "report", result); err != nil {
+			break
+		}
+		count++
+		if !result.Get("valid").Bool() {
+			invalid++
+		}
+	}
+
+	summary := js.Global().Get("Object").New()
+	summary.Set("complete", err == nil)
+	summary.Set("count", count)
+	summary.Set("invalid", invalid)
+	summary.Set("error", js.Null())
+	if err != nil {
+		summary.Set("error", err.Error())
+	}
+	return summary
+}
+
+// callJS calls the method on v, turning an exception it throws into an
+// error instead of a panic.
+func callJS(v js.Value, method string, args ...any) (result js.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if jsErr, ok := r.(js.Error); ok {
+				err = fmt.Errorf("%s threw: %s", method, jsErr.Error())
+				return
+			}
+			panic(r)
+		}
+	}()
+	return v.Call(method, args...), nil
+}
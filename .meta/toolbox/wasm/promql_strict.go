@@ -0,0 +1,107 @@
+//go:build ignore
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
+
+	"toolbox/validate"
+)
+
+// checkMatcherRegexps compiles the value of every =~ and !~ matcher the way
+// Prometheus anchors it, returning the first failure as a ParseErr so it
+// reports like any other parse error. The parser in the version we pin
+// already fails on most of these while building the matcher; this keeps the
+// guarantee explicit rather than tied to that implementation detail.
+func checkMatcherRegexps(src string, expr parser.Expr) error {
+	var failure error
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok || failure != nil {
+			return nil
+		}
+		for _, m := range vs.LabelMatchers {
+			if m.Type != labels.MatchRegexp && m.Type != labels.MatchNotRegexp {
+				continue
+			}
+			if _, err := regexp.Compile("^(?:" + m.Value + ")$"); err != nil {
+				failure = parser.ParseErrors{{
+					PositionRange: matcherSpan(src, vs, m),
+					Err:           fmt.Errorf("invalid regular expression in matcher %s: %w", m, err),
+					Query:         src,
+				}}
+				return nil
+			}
+		}
+		return nil
+	})
+	return failure
+}
+
+// matcherSpan locates m inside the selector's source text. The parser only
+// keeps positions for the selector as a whole, which is also the fallback.
+func matcherSpan(src string, vs *parser.VectorSelector, m *labels.Matcher) posrange.PositionRange {
+	pr := vs.PositionRange()
+	start, end := int(pr.Start), int(pr.End)
+	if start < 0 || end > len(src) || start > end {
+		return pr
+	}
+	text := src[start:end]
+	re := regexp.MustCompile(regexp.QuoteMeta(m.Name) + `\s*` + regexp.QuoteMeta(m.Type.String()) + `\s*`)
+	loc := re.FindStringIndex(text)
+	if loc == nil {
+		return pr
+	}
+	litEnd := stringLiteralEnd(text, loc[1])
+	if litEnd < 0 {
+		return pr
+	}
+	return posrange.PositionRange{
+		Start: posrange.Pos(start + loc[0]),
+		End:   posrange.Pos(start + litEnd),
+	}
+}
+
+// stringLiteralEnd returns the offset just past the quoted string starting
+// at text[i], or -1 if there is none.
+func stringLiteralEnd(text string, i int) int {
+	if i >= len(text) || !strings.ContainsRune("\"'`", rune(text[i])) {
+		return -1
+	}
+	quote := text[i]
+	for j := i + 1; j < len(text); j++ {
+		switch {
+		case text[j] == '\\' && quote != '`':
+			j++
+		case text[j] == quote:
+			return j + 1
+		}
+	}
+	return -1
+}
+
+func jsValidatePromQLStrict(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, explainGrouping(err))
+	}
+	if err := checkMatcherRegexps(src, expr); err != nil {
+		return invalidQuery(src, err)
+	}
+	if err := checkVectorMatching(src, expr); err != nil {
+		return invalidQuery(src, err)
+	}
+	return validResult()
+}
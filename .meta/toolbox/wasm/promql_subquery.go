@@ -0,0 +1,55 @@
+//go:build ignore
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// subquerySpans returns the rune range of every subquery in expr, outermost
+// first, including the [range:step] and any modifiers after it.
+func subquerySpans(src string, expr parser.Expr) []errorSpan {
+	var spans []errorSpan
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if sq, ok := node.(*parser.SubqueryExpr); ok {
+			pr := sq.PositionRange()
+			spans = append(spans, errorSpan{
+				Start: runeOffset(src, int(pr.Start)),
+				End:   runeOffset(src, int(pr.End)),
+			})
+		}
+		return nil
+	})
+	return spans
+}
+
+// jsHasSubqueryPromQL reports the subqueries in a query. An invalid query
+// gets the same result as from ValidatePromQL, so callers can make one call
+// and check valid before hasSubquery.
+func jsHasSubqueryPromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	spans := subquerySpans(src, expr)
+	positions := js.Global().Get("Array").New()
+	for i, span := range spans {
+		pos := js.Global().Get("Object").New()
+		pos.Set("start", span.Start)
+		pos.Set("end", span.End)
+		positions.SetIndex(i, pos)
+	}
+	result := validResult()
+	result.Set("hasSubquery", len(spans) > 0)
+	result.Set("positions", positions)
+	return result
+}
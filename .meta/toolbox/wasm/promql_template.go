@@ -0,0 +1,181 @@
+//go:build ignore
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
+
+	"toolbox/validate"
+)
+
+// templateVarRe matches dashboard placeholders: $name, ${name} and
+// ${name:format}, the format being ignored. Placeholders inside label
+// values are substituted too. A name can't start with a digit, since $1
+// and ${1} are regex backreferences, as in the replacement of
+// label_replace, and not placeholders.
+var templateVarRe = regexp.MustCompile(`\$(?:\{([A-Za-z_]\w*)(?::\w+)?\}|([A-Za-z_]\w*))`)
+
+// inComment reports, for each byte of src, whether it's in a # comment.
+// A # inside a string starts none.
+func inComment(src string) []bool {
+	comment := make([]bool, len(src))
+	var quote byte
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '#':
+			for ; i < len(src) && src[i] != '\n'; i++ {
+				comment[i] = true
+			}
+		}
+	}
+	return comment
+}
+
+// substitution is one placeholder in the source, by byte offsets.
+type substitution struct {
+	Start, End int
+	Name       string
+	Value      string
+}
+
+// expandTemplate replaces every placeholder that has a value in vars. The
+// ones that don't are returned as unresolved and left in the text. A $ in
+// a comment is left alone.
+func expandTemplate(src string, vars map[string]string) (expanded string, subs, unresolved []substitution) {
+	var sb strings.Builder
+	last := 0
+	comment := inComment(src)
+	for _, m := range templateVarRe.FindAllStringSubmatchIndex(src, -1) {
+		if comment[m[0]] {
+			continue
+		}
+		var name string
+		if m[2] >= 0 {
+			name = src[m[2]:m[3]]
+		} else {
+			name = src[m[4]:m[5]]
+		}
+		sub := substitution{Start: m[0], End: m[1], Name: name}
+		value, ok := vars[name]
+		if !ok {
+			unresolved = append(unresolved, sub)
+			continue
+		}
+		sub.Value = value
+		subs = append(subs, sub)
+		sb.WriteString(src[last:sub.Start])
+		sb.WriteString(value)
+		last = sub.End
+	}
+	sb.WriteString(src[last:])
+	return sb.String(), subs, unresolved
+}
+
+// originalOffset maps a byte offset in the expanded text back to the source.
+// Offsets inside a substituted value map to the placeholder's start, or to
+// its end when end is set.
+func originalOffset(subs []substitution, off int, end bool) int {
+	shift := 0
+	for _, s := range subs {
+		start := s.Start + shift
+		stop := start + len(s.Value)
+		switch {
+		case off < start || (end && off == start):
+			return off - shift
+		case !end && off < stop:
+			return s.Start
+		case end && off <= stop:
+			return s.End
+		}
+		shift += len(s.Value) - (s.End - s.Start)
+	}
+	return off - shift
+}
+
+// mapTemplateError moves the positions of a parse error in the expanded text
+// back onto src. Messages keep quoting the expanded text.
+func mapTemplateError(src string, subs []substitution, err error) error {
+	var perrs parser.ParseErrors
+	if !errors.As(err, &perrs) {
+		var perr *parser.ParseErr
+		if !errors.As(err, &perr) {
+			return err
+		}
+		perrs = parser.ParseErrors{*perr}
+	}
+	mapped := make(parser.ParseErrors, len(perrs))
+	for i, perr := range perrs {
+		perr.PositionRange = posrange.PositionRange{
+			Start: posrange.Pos(originalOffset(subs, int(perr.PositionRange.Start), false)),
+			End:   posrange.Pos(originalOffset(subs, int(perr.PositionRange.End), true)),
+		}
+		perr.Query = src
+		mapped[i] = perr
+	}
+	return mapped
+}
+
+// templateVarsFromJS reads an object of placeholder names to sample values.
+func templateVarsFromJS(v js.Value) (map[string]string, error) {
+	vars := make(map[string]string)
+	keys := js.Global().Get("Object").Call("keys", v)
+	for i := 0; i < keys.Length(); i++ {
+		name := keys.Index(i).String()
+		value := v.Get(name)
+		if value.Type() != js.TypeString {
+			return nil, fmt.Errorf("value of variable $%s must be a string", name)
+		}
+		vars[name] = value.String()
+	}
+	return vars, nil
+}
+
+func jsValidatePromQLTemplate(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeObject {
+		return invalidArgs("expected source and a variables object")
+	}
+	vars, err := templateVarsFromJS(args[1])
+	if err != nil {
+		return invalidArgs(err.Error())
+	}
+
+	src := args[0].String()
+	expanded, subs, unresolved := expandTemplate(src, vars)
+	if len(unresolved) > 0 {
+		perrs := make(parser.ParseErrors, 0, len(unresolved))
+		for _, u := range unresolved {
+			perrs = append(perrs, parser.ParseErr{
+				PositionRange: posrange.PositionRange{Start: posrange.Pos(u.Start), End: posrange.Pos(u.End)},
+				Err:           fmt.Errorf("unresolved variable $%s", u.Name),
+				Query:         src,
+			})
+		}
+		result := invalidQuery(src, perrs)
+		result.Set("expanded", expanded)
+		return result
+	}
+
+	if _, err := validate.ParsePromQL(expanded); err != nil {
+		result := invalidQuery(src, mapTemplateError(src, subs, err))
+		result.Set("expanded", expanded)
+		return result
+	}
+	result := validResult()
+	result.Set("expanded", expanded)
+	return result
+}
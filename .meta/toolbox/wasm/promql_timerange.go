@@ -0,0 +1,93 @@
+//go:build ignore
+
+package main
+
+import (
+	"strconv"
+	"syscall/js"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// timeRange is every explicit time constraint in an expression.
+type timeRange struct {
+	Ranges  []string // [5m] range selectors and subquery ranges
+	Offsets []string // offset modifiers, negative ones with a leading -
+	At      []string // @ modifiers: unix seconds, start() or end()
+}
+
+func (tr timeRange) HasRange() bool {
+	return len(tr.Ranges)+len(tr.Offsets)+len(tr.At) > 0
+}
+
+func extractTimeRange(expr parser.Expr) timeRange {
+	var tr timeRange
+	addModifiers := func(offset time.Duration, ts *int64, startOrEnd parser.ItemType) {
+		if offset != 0 {
+			tr.Offsets = append(tr.Offsets, promDuration(offset))
+		}
+		if at := atModifier(ts, startOrEnd); at != "" {
+			tr.At = append(tr.At, at)
+		}
+	}
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.MatrixSelector:
+			tr.Ranges = append(tr.Ranges, promDuration(n.Range))
+		case *parser.SubqueryExpr:
+			tr.Ranges = append(tr.Ranges, promDuration(n.Range))
+			addModifiers(n.OriginalOffset, n.Timestamp, n.StartOrEnd)
+		case *parser.VectorSelector:
+			addModifiers(n.OriginalOffset, n.Timestamp, n.StartOrEnd)
+		}
+		return nil
+	})
+	return tr
+}
+
+// atModifier formats an @ modifier as written, "" when there is none.
+func atModifier(ts *int64, startOrEnd parser.ItemType) string {
+	switch {
+	case ts != nil:
+		return strconv.FormatFloat(float64(*ts)/1000, 'f', -1, 64)
+	case startOrEnd == parser.START:
+		return "start()"
+	case startOrEnd == parser.END:
+		return "end()"
+	}
+	return ""
+}
+
+// promDuration formats d the way PromQL writes it, e.g. 1h30m.
+func promDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + model.Duration(-d).String()
+	}
+	return model.Duration(d).String()
+}
+
+func jsExtractTimeRangePromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	tr := extractTimeRange(expr)
+	result := js.Global().Get("Object").New()
+	result.Set("valid", true)
+	result.Set("hasRange", tr.HasRange())
+	if tr.HasRange() {
+		result.Set("ranges", jsStrings(tr.Ranges))
+		result.Set("offsets", jsStrings(tr.Offsets))
+		result.Set("at", jsStrings(tr.At))
+	}
+	return result
+}
@@ -0,0 +1,144 @@
+//go:build ignore
+
+package main
+
+import (
+	"errors"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
+
+	"toolbox/validate"
+)
+
+// Token classes reported to editors: the ones TokenizeAPL uses, plus metric
+// names and durations, which only PromQL has.
+const (
+	tokenKeyword    = "keyword"
+	tokenIdentifier = "identifier"
+	tokenString     = "string"
+	tokenNumber     = "number"
+	tokenOperator   = "operator"
+	tokenComment    = "comment"
+	tokenFunction   = "function"
+	tokenMetric     = "metric"
+	tokenDuration   = "duration"
+)
+
+type highlightToken struct {
+	Start int // byte offset, inclusive
+	End   int // byte offset, exclusive
+	Type  string
+}
+
+// tokenizePromQL classifies the Prometheus lexer's items for highlighting.
+// Offsets are bytes, as in TokenizeAPL, so one editor component can take
+// either. The lexer gives up at the first character it can't read; that is
+// reported as a parse error.
+func tokenizePromQL(src string) ([]highlightToken, error) {
+	var items []parser.Item
+	n := validate.Normalize(src)
+	lx := parser.Lex(n.Text)
+	for {
+		var item parser.Item
+		lx.NextItem(&item)
+		if item.Typ == parser.EOF {
+			break
+		}
+		if item.Typ == parser.ERROR {
+			return nil, n.PromQLError(parser.ParseErrors{{
+				PositionRange: posrange.PositionRange{Start: item.Pos, End: posrange.Pos(len(n.Text))},
+				Err:           errors.New(item.Val),
+				Query:         n.Text,
+			}})
+		}
+		if item.Typ != parser.SPACE {
+			items = append(items, item)
+		}
+	}
+
+	out := make([]highlightToken, 0, len(items))
+	var (
+		braces    int  // depth of {...}, where names are labels
+		labelList bool // inside by (...), on (...) and the like
+	)
+	for i, item := range items {
+		typ := tokenOperator
+		switch item.Typ {
+		case parser.LEFT_BRACE:
+			braces++
+		case parser.RIGHT_BRACE:
+			braces = max(0, braces-1)
+		case parser.LEFT_PAREN:
+			if i > 0 {
+				switch items[i-1].Typ {
+				case parser.BY, parser.WITHOUT, parser.ON, parser.IGNORING, parser.GROUP_LEFT, parser.GROUP_RIGHT:
+					labelList = true
+				}
+			}
+		case parser.RIGHT_PAREN:
+			labelList = false
+		case parser.COMMENT:
+			typ = tokenComment
+		case parser.STRING:
+			typ = tokenString
+		case parser.NUMBER:
+			typ = tokenNumber
+		case parser.DURATION:
+			typ = tokenDuration
+		default:
+			switch {
+			case !isWord(item.Typ):
+			case braces > 0 || labelList:
+				// Label names, even ones spelled like keywords.
+				typ = tokenIdentifier
+			case item.Typ.IsOperator():
+			case item.Typ.IsAggregator():
+				typ = tokenFunction
+			case item.Typ.IsKeyword() || item.Typ == parser.START || item.Typ == parser.END:
+				typ = tokenKeyword
+			case item.Typ == parser.IDENTIFIER || item.Typ == parser.METRIC_IDENTIFIER:
+				typ = tokenMetric
+				if _, ok := parser.Functions[item.Val]; ok && i+1 < len(items) && items[i+1].Typ == parser.LEFT_PAREN {
+					typ = tokenFunction
+				}
+			}
+		}
+		start, end := n.OriginalSpan(int(item.Pos), int(item.Pos)+len(item.Val))
+		out = append(out, highlightToken{Start: start, End: end, Type: typ})
+	}
+	return out, nil
+}
+
+// isWord reports whether items of type t are spelled with letters, which
+// is what a label name can be lexed as.
+func isWord(t parser.ItemType) bool {
+	switch t {
+	case parser.IDENTIFIER, parser.METRIC_IDENTIFIER, parser.START, parser.END,
+		parser.LAND, parser.LOR, parser.LUNLESS, parser.ATAN2:
+		return true
+	}
+	return t.IsKeyword() || t.IsAggregator()
+}
+
+func jsTokenizePromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	toks, err := tokenizePromQL(src)
+	if err != nil {
+		return invalidQuery(src, err)
+	}
+	result := js.Global().Get("Array").New()
+	for i, tok := range toks {
+		obj := js.Global().Get("Object").New()
+		obj.Set("start", tok.Start)
+		obj.Set("end", tok.End)
+		obj.Set("type", tok.Type)
+		result.SetIndex(i, obj)
+	}
+	return result
+}
@@ -0,0 +1,98 @@
+//go:build ignore
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
+
+	"toolbox/validate"
+)
+
+// trailingInput rewords err when src is a complete expression followed by
+// more input, such as two queries pasted together. The parser already
+// stops at the first token it can't continue with; when everything before
+// that token parses on its own, the token starts trailing input rather than
+// breaking the expression, and the error says so at the token's position.
+// Any other err comes back unchanged.
+func trailingInput(src string, err error) error {
+	var errs parser.ParseErrors
+	if !errors.As(err, &errs) || len(errs) == 0 {
+		return err
+	}
+	first := errs[0]
+	end, next := expressionEnd(src, int(first.PositionRange.Start))
+	if strings.TrimSpace(src[:end]) == "" {
+		return err
+	}
+	if _, perr := validate.PromQL(src[:end]); perr != nil {
+		return err
+	}
+	what := "input"
+	if e := validate.PromQLErrors(src, err); len(e) > 0 && e[0].Unexpected != "" {
+		what = e[0].Unexpected
+	}
+	first.Err = fmt.Errorf("unexpected %s in trailing input after the expression", what)
+	first.PositionRange = posrange.PositionRange{Start: next.Pos, End: next.Pos + posrange.Pos(len(next.Val))}
+	if next.Typ == parser.ERROR {
+		// A lexer error holds its message rather than the text, and for a
+		// stray closer sits just past it, so go by end instead.
+		start := len(src) - len(strings.TrimLeft(src[end:], " \t\r\n"))
+		first.PositionRange = posrange.PositionRange{Start: posrange.Pos(start), End: posrange.Pos(min(start+1, len(src)))}
+	}
+	return parser.ParseErrors{first}
+}
+
+// expressionEnd returns where the last token ending by off ends, which is
+// where the expression stops if the error at off is trailing input, and
+// the first token after it. Comments are skipped. Offsets, and the
+// token's position, are in src.
+func expressionEnd(src string, off int) (int, parser.Item) {
+	end := 0
+	n := validate.Normalize(src)
+	lx := parser.Lex(n.Text)
+	for {
+		var item parser.Item
+		lx.NextItem(&item)
+		start, itemEnd := n.OriginalSpan(int(item.Pos), int(item.Pos)+len(item.Val))
+		switch {
+		case item.Typ == parser.COMMENT:
+			continue
+		case item.Typ == parser.EOF || item.Typ == parser.ERROR || itemEnd > off:
+			item.Pos = posrange.Pos(start)
+			return end, item
+		}
+		end = itemEnd
+	}
+}
+
+// jsValidatePromQLNoTrailing is ValidatePromQL, except that input after a
+// complete expression fails with an error saying so, positioned at the
+// first trailing token. unexpected and expected still come from the
+// parser's own error, which the new message no longer spells out. Anything
+// else validates as ValidatePromQL does.
+func jsValidatePromQLNoTrailing(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	_, err := validate.PromQL(src)
+	if err == nil {
+		return validResult()
+	}
+	result := invalidQuery(src, trailingInput(src, err))
+	if errs := validate.PromQLErrors(src, err); len(errs) > 0 {
+		result.Set("unexpected", js.Null())
+		if errs[0].Unexpected != "" {
+			result.Set("unexpected", errs[0].Unexpected)
+		}
+		result.Set("expected", jsStrings(errs[0].Expected))
+	}
+	return result
+}
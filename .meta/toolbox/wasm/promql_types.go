@@ -0,0 +1,82 @@
+//go:build ignore
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"toolbox/validate"
+)
+
+// exprTypeNames maps parser value types to the names reported to JS.
+var exprTypeNames = map[parser.ValueType]string{
+	parser.ValueTypeScalar: "scalar",
+	parser.ValueTypeVector: "instant_vector",
+	parser.ValueTypeMatrix: "range_vector",
+	parser.ValueTypeString: "string",
+}
+
+// checkQueryMode applies the Prometheus HTTP API's rules: instant queries
+// return any type, range queries only scalars and instant vectors.
+func checkQueryMode(expr parser.Expr, mode string) error {
+	if mode == "instant" {
+		return nil
+	}
+	switch expr.Type() {
+	case parser.ValueTypeScalar, parser.ValueTypeVector:
+		return nil
+	}
+	return fmt.Errorf("invalid expression type %q for range query, must be scalar or instant vector", parser.DocumentedType(expr.Type()))
+}
+
+func jsValidatePromQLTyped(this js.Value, args []js.Value) any {
+	if len(args) != 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeString {
+		return invalidArgs("expected 2 string arguments")
+	}
+	mode := args[1].String()
+	if mode != "instant" && mode != "range" {
+		return invalidArgs(fmt.Sprintf("unknown query mode %q, expected \"instant\" or \"range\"", mode))
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		result := invalidQuery(src, err)
+		result.Set("exprType", js.Null())
+		return result
+	}
+	if err := checkQueryMode(expr, mode); err != nil {
+		// The whole expression has the wrong type, so that's the span.
+		result := invalidQuery(src, parser.ParseErrors{{PositionRange: expr.PositionRange(), Err: err, Query: src}})
+		result.Set("exprType", exprTypeNames[expr.Type()])
+		return result
+	}
+	result := validResult()
+	result.Set("exprType", exprTypeNames[expr.Type()])
+	return result
+}
+
+// jsResultTypePromQL is ValidatePromQL plus resultType, the type of the
+// whole expression as the HTTP API names it in an instant query's
+// resultType: "vector", "matrix", "scalar" or "string". Unlike
+// ValidatePromQLTyped it takes no mode. resultType is null when the query
+// doesn't parse.
+func jsResultTypePromQL(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return invalidArgs("expected 1 string argument")
+	}
+
+	src := args[0].String()
+	expr, err := validate.ParsePromQL(src)
+	if err != nil {
+		result := invalidQuery(src, err)
+		result.Set("resultType", js.Null())
+		return result
+	}
+	result := validResult()
+	result.Set("resultType", string(expr.Type()))
+	return result
+}
@@ -0,0 +1,77 @@
+#!/bin/bash
+set -euo pipefail
+
+# Runs the Go tests of both WASM modules, staged the way build.sh stages
+# them for building.
+#
+# validate/ runs natively. The main packages only build for js/wasm, so
+# their tests run under Node through Go's go_js_wasm_exec. Without the
+# axiom1 repo only the PromQL half runs, since the APL half needs kirby.
+#
+# Usage: ./test.sh [/path/to/axiom1] [go test flags...]
+
+AXIOM_DIR=""
+if [ $# -gt 0 ] && [ -f "$1/go.mod" ]; then
+  AXIOM_DIR="$1"
+  shift
+fi
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+WASM_EXEC="$(go env GOROOT)/lib/wasm/go_js_wasm_exec"
+
+command -v node >/dev/null 2>&1 || {
+  echo "error: node not found; the js/wasm tests run under it" >&2
+  exit 1
+}
+
+# ── PromQL half ──────────────────────────────────────────────────────
+echo "Testing promql-parser..."
+PROMQL_TMP="$(mktemp -d)"
+cp "$SCRIPT_DIR"/promql_*.go "$PROMQL_TMP/"
+sed -i.bak '/^\/\/go:build ignore/d' "$PROMQL_TMP"/promql_*.go
+rm "$PROMQL_TMP"/*.bak
+mkdir "$PROMQL_TMP/validate"
+for f in "$SCRIPT_DIR"/validate/*.go; do
+  case "$(basename "$f")" in
+    apl*) ;;
+    *) cp "$f" "$PROMQL_TMP/validate/" ;;
+  esac
+done
+if [ -d "$SCRIPT_DIR/validate/testdata" ]; then
+  cp -R "$SCRIPT_DIR/validate/testdata" "$PROMQL_TMP/validate/"
+fi
+
+cd "$PROMQL_TMP"
+go mod init toolbox >/dev/null
+go mod tidy
+go test "$@" ./validate
+GOOS=js GOARCH=wasm go test -exec="$WASM_EXEC" "$@" .
+cd "$SCRIPT_DIR"
+rm -rf "$PROMQL_TMP"
+
+# ── APL half ─────────────────────────────────────────────────────────
+if [ -z "$AXIOM_DIR" ]; then
+  echo "Skipping apl-parser: pass the axiom1 repo to test it."
+  exit 0
+fi
+echo "Testing apl-parser against axiom1@$(cd "$AXIOM_DIR" && git rev-parse --short=12 HEAD)..."
+APL_TMP="$(mktemp -d)"
+cp "$SCRIPT_DIR/main.go" "$SCRIPT_DIR/main_test.go" "$SCRIPT_DIR"/apl_*.go "$APL_TMP/"
+mkdir "$APL_TMP/validate"
+for f in "$SCRIPT_DIR"/validate/*.go; do
+  case "$(basename "$f")" in
+    promql*) ;;
+    *) cp "$f" "$APL_TMP/validate/" ;;
+  esac
+done
+if [ -d "$SCRIPT_DIR/validate/testdata" ]; then
+  cp -R "$SCRIPT_DIR/validate/testdata" "$APL_TMP/validate/"
+fi
+cd "$APL_TMP"
+go mod init toolbox >/dev/null
+go work init . "$AXIOM_DIR"
+go test "$@" ./validate
+GOOS=js GOARCH=wasm go test -exec="$WASM_EXEC" "$@" .
+cd "$SCRIPT_DIR"
+rm -rf "$APL_TMP"
+
+echo "Done."
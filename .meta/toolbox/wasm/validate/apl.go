@@ -0,0 +1,181 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+)
+
+// MaxAPLBytes caps what Validate hands to the parser. A multi-megabyte
+// generated query can keep it busy long enough to freeze the tab the WASM
+// module runs in.
+const MaxAPLBytes = 1 << 20
+
+// APLParser validates APL queries, reusing one parse tree between them. The
+// zero value is ready to use. It is not safe for concurrent use.
+type APLParser struct {
+	doc ast.Doc
+}
+
+// APL validates a single query. The error is the parser's, for callers that
+// want to inspect it; the Result describes it either way.
+func APL(src string) (Result, error) {
+	var p APLParser
+	return p.Validate(src)
+}
+
+// Validate is APL, reusing the parse tree from the previous query.
+func (p *APLParser) Validate(src string) (Result, error) {
+	return p.ValidateWithLimit(src, MaxAPLBytes)
+}
+
+// ValidateWithLimit is Validate for sources of at most limit bytes; longer
+// ones are rejected without being parsed.
+func (p *APLParser) ValidateWithLimit(src string, limit int) (Result, error) {
+	if err := parseAPL(src, limit, &p.doc); err != nil {
+		return invalid(APLError(err)), err
+	}
+	return Result{Valid: true}, nil
+}
+
+// ParseAPL parses src into doc the way Validate checks it: a source over
+// MaxAPLBytes is rejected unparsed, the rest is normalized first, and a
+// blank one fails with "empty query". Positions in doc and in the error are
+// in src. The WASM exports that need the tree parse through here, so they
+// accept exactly what ValidateAPL does.
+func ParseAPL(src string, doc *ast.Doc) error {
+	return parseAPL(src, MaxAPLBytes, doc)
+}
+
+func parseAPL(src string, limit int, doc *ast.Doc) error {
+	if len(src) > limit {
+		return fmt.Errorf("query exceeds %d bytes", limit)
+	}
+	text, m := normalizeSource(src)
+	*doc = ast.Doc{}
+	if err := ast.Parse("query.apl", text, doc); err != nil {
+		if blankAPL(text) {
+			err = errEmptyQuery
+		}
+		return m.aplError(err)
+	}
+	if m != nil {
+		s := positionShifter{m: m, nodes: make(map[uintptr]bool), moved: make(map[uintptr]bool)}
+		s.shift(reflect.ValueOf(doc).Elem())
+	}
+	return nil
+}
+
+var errEmptyQuery = errors.New("empty query")
+
+// blankAPL reports whether src holds nothing but whitespace and comments.
+func blankAPL(src string) bool {
+	lx, err := ast.Lexer.Lex("query.apl", strings.NewReader(src))
+	if err != nil {
+		return false
+	}
+	toks, err := lexer.ConsumeAll(lx)
+	if err != nil {
+		return false
+	}
+	symbols := ast.Lexer.Symbols()
+	for _, tok := range toks {
+		if !tok.EOF() && tok.Type != symbols["Whitespace"] && tok.Type != symbols["Comment"] {
+			return false
+		}
+	}
+	return true
+}
+
+// aplError moves the position of a kirby error back into the original
+// source.
+func (m sourceMap) aplError(err error) error {
+	var perr participle.Error
+	if m == nil || !errors.As(err, &perr) {
+		return err
+	}
+	pos := perr.Position()
+	if pos.Line == 0 {
+		return err
+	}
+	pos.Offset = m.original(pos.Offset)
+	return &shiftedError{err: perr, pos: pos}
+}
+
+var positionType = reflect.TypeOf(lexer.Position{})
+
+// positionShifter moves the offset of every lexer.Position in a parse tree
+// back into the original source. Participle nodes share their tokens with
+// their parents, so nodes and moved keep anything from being visited, or
+// moved, twice.
+type positionShifter struct {
+	m     sourceMap
+	nodes map[uintptr]bool
+	moved map[uintptr]bool
+}
+
+func (s positionShifter) shift(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || s.nodes[v.Pointer()] {
+			return
+		}
+		s.nodes[v.Pointer()] = true
+		s.shift(v.Elem())
+	case reflect.Interface:
+		if !v.IsNil() {
+			s.shift(v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			s.shift(v.Index(i))
+		}
+	case reflect.Struct:
+		if v.Type() != positionType {
+			for i := 0; i < v.NumField(); i++ {
+				if v.Type().Field(i).IsExported() {
+					s.shift(v.Field(i))
+				}
+			}
+			return
+		}
+		if !v.CanSet() || s.moved[v.Addr().Pointer()] {
+			return
+		}
+		s.moved[v.Addr().Pointer()] = true
+		off := v.FieldByName("Offset")
+		off.SetInt(int64(s.m.original(int(off.Int()))))
+	}
+}
+
+// shiftedError is a kirby error reported at a different position.
+type shiftedError struct {
+	err participle.Error
+	pos lexer.Position
+}
+
+func (e *shiftedError) Error() string            { return participle.FormatError(e) }
+func (e *shiftedError) Message() string          { return e.err.Message() }
+func (e *shiftedError) Position() lexer.Position { return e.pos }
+func (e *shiftedError) Unwrap() error            { return e.err }
+
+// APLError describes an error from the kirby lexer or parser, without the
+// file:line:col prefix its Error method adds.
+func APLError(err error) Error {
+	var perr participle.Error
+	if !errors.As(err, &perr) {
+		return Error{Message: err.Error(), Code: ErrorCode(err.Error())}
+	}
+	e := Error{Message: perr.Message(), Code: ErrorCode(perr.Message())}
+	if pos := perr.Position(); pos.Line != 0 {
+		e.Line, e.Column = pos.Line, pos.Column
+		e.Start, e.End = pos.Offset, pos.Offset
+		e.HasPos = true
+	}
+	return e
+}
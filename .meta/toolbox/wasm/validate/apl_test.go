@@ -0,0 +1,240 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	ast "github.com/axiomhq/axiom/pkg/kirby/apl/parser/ast/v2"
+)
+
+// positions collects every lexer.Position in a parse tree, in field order.
+func positions(v reflect.Value) []lexer.Position {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			return positions(v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		var out []lexer.Position
+		for i := 0; i < v.Len(); i++ {
+			out = append(out, positions(v.Index(i))...)
+		}
+		return out
+	case reflect.Struct:
+		if pos, ok := v.Interface().(lexer.Position); ok {
+			return []lexer.Position{pos}
+		}
+		var out []lexer.Position
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				out = append(out, positions(v.Field(i))...)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func TestParseAPLPositions(t *testing.T) {
+	tests := []struct {
+		src, plain string
+	}{
+		{"\ufeff['logs'] | take 10", "['logs'] | take 10"},
+		{"['logs']\r\n| where status == 500\r\n| take 10\r\n", "['logs']\n| where status == 500\n| take 10\n"},
+		{"\ufeff['logs']\r| take 10", "['logs']\n| take 10"},
+	}
+	for _, tt := range tests {
+		var doc, plain ast.Doc
+		if err := ParseAPL(tt.src, &doc); err != nil {
+			t.Errorf("ParseAPL(%q): %v", tt.src, err)
+			continue
+		}
+		if err := ParseAPL(tt.plain, &plain); err != nil {
+			t.Fatalf("ParseAPL(%q): %v", tt.plain, err)
+		}
+		got, want := positions(reflect.ValueOf(doc)), positions(reflect.ValueOf(plain))
+		if len(got) != len(want) {
+			t.Fatalf("ParseAPL(%q) has %d positions, want %d", tt.src, len(got), len(want))
+		}
+		for i := range got {
+			if got[i].Line != want[i].Line || got[i].Column != want[i].Column {
+				t.Errorf("ParseAPL(%q) position %d at %d:%d, want %d:%d", tt.src, i, got[i].Line, got[i].Column, want[i].Line, want[i].Column)
+			}
+			if text := unixBreaks.Replace(tt.src[got[i].Offset:]); text != tt.plain[want[i].Offset:] {
+				t.Errorf("ParseAPL(%q) position %d at %q, want %q", tt.src, i, text, tt.plain[want[i].Offset:])
+			}
+		}
+	}
+}
+
+func TestParseAPLErrorPositions(t *testing.T) {
+	tests := []struct {
+		src, plain string
+	}{
+		{"\ufeff['logs'] | | take 10", "['logs'] | | take 10"},
+		{"['logs']\r\n| where status ==\r\n| |", "['logs']\n| where status ==\n| |"},
+	}
+	for _, tt := range tests {
+		var doc ast.Doc
+		err := ParseAPL(tt.src, &doc)
+		if err == nil {
+			t.Errorf("ParseAPL(%q) succeeded", tt.src)
+			continue
+		}
+		got, want := APLError(err), APLError(ParseAPL(tt.plain, &doc))
+		if got.Message != want.Message || got.Line != want.Line || got.Column != want.Column {
+			t.Errorf("ParseAPL(%q) error %v, want %v", tt.src, got, want)
+		}
+		if text := unixBreaks.Replace(tt.src[got.Start:]); text != tt.plain[want.Start:] {
+			t.Errorf("ParseAPL(%q) error at %q, want %q", tt.src, text, tt.plain[want.Start:])
+		}
+	}
+}
+
+func TestParseAPLRejects(t *testing.T) {
+	tests := []struct {
+		src  string
+		code string
+	}{
+		{"", CodeEmptyQuery},
+		{"\ufeff  \r\n// nothing\r\n", CodeEmptyQuery},
+		{"['logs'] | take 1 " + strings.Repeat(" ", MaxAPLBytes), CodeQueryTooLong},
+	}
+	for _, tt := range tests {
+		var doc ast.Doc
+		err := ParseAPL(tt.src, &doc)
+		if err == nil {
+			t.Errorf("ParseAPL(%.20q) succeeded", tt.src)
+			continue
+		}
+		if code := APLError(err).Code; code != tt.code {
+			t.Errorf("ParseAPL(%.20q) code %s, want %s", tt.src, code, tt.code)
+		}
+		r, _ := APL(tt.src)
+		if r.Valid || r.Errors[0].Code != tt.code {
+			t.Errorf("APL(%.20q) = %+v, want code %s", tt.src, r, tt.code)
+		}
+	}
+}
+
+// FuzzValidateAPL checks that every Result is well formed and that the
+// error, when there is one, agrees with it. The seed corpus is under
+// testdata/fuzz.
+func FuzzValidateAPL(f *testing.F) {
+	f.Add("['logs'] | where status == 500 | take 10")
+	f.Add("\ufeff['logs']\r\n| summarize count() by bin(_time, 1m)")
+	f.Fuzz(func(t *testing.T, src string) {
+		var p APLParser
+		r, err := p.ValidateWithLimit(src, 1<<12)
+		if err := r.Check(src); err != nil {
+			t.Fatalf("APL(%q) = %+v: %v", src, r, err)
+		}
+		if r.Valid != (err == nil) {
+			t.Fatalf("APL(%q) is valid %v with error %v", src, r.Valid, err)
+		}
+	})
+}
+
+func TestAPL(t *testing.T) {
+	tests := []struct {
+		src  string
+		code string // empty for a valid query
+	}{
+		{"['logs'] | where status == 500 | take 10", ""},
+		{"['logs']\n| summarize count() by bin(_time, 1m)\n| sort by count_ desc", ""},
+		{"\ufeff['logs']\r\n| take 10\r\n", ""},
+		{"['logs'] | project ['service.name'], msg = strcat(\"a\", \"b\")", ""},
+		{"['logs'] | | take 10", CodeUnexpectedToken},
+		{"['logs']\n| take 10\n| where ==", CodeUnexpectedToken},
+		{"['logs'] |", CodeUnexpectedEOF},
+		{"['logs'] | where status ==", CodeUnexpectedEOF},
+		{"['logs'] | where (status == 500", CodeUnexpectedEOF},
+		{"['logs'] | where msg == \"unterminated", CodeUnterminatedString},
+		{"['logs'] | where msg == 'unterminated", CodeUnterminatedString},
+		{"['logs'] | where x == 1 ¤ 2", CodeInvalidCharacter},
+	}
+	for _, tt := range tests {
+		r, err := APL(tt.src)
+		if err := r.Check(tt.src); err != nil {
+			t.Errorf("APL(%q): %v", tt.src, err)
+		}
+		if tt.code == "" {
+			if !r.Valid || err != nil {
+				t.Errorf("APL(%q) = %+v, %v, want valid", tt.src, r, err)
+			}
+			continue
+		}
+		if r.Valid || err == nil {
+			t.Errorf("APL(%q) is valid, want %s", tt.src, tt.code)
+			continue
+		}
+		if !r.Errors[0].HasPos || r.Errors[0].Code != tt.code {
+			t.Errorf("APL(%q) error %+v, want code %s with a position", tt.src, r.Errors[0], tt.code)
+		}
+	}
+}
+
+// TestAPLParserReuse checks that the tree an APLParser keeps between
+// queries doesn't leak from one into the next.
+func TestAPLParserReuse(t *testing.T) {
+	var p APLParser
+	for _, src := range []string{
+		"['logs'] | where status == 500 | take 10",
+		"['logs'] | | take 10",
+		"['other'] | count",
+		"",
+		"['logs'] | take 1",
+	} {
+		got, _ := p.Validate(src)
+		want, _ := APL(src)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("reused Validate(%q) = %+v, fresh %+v", src, got, want)
+		}
+	}
+}
+
+func TestValidateWithLimit(t *testing.T) {
+	src := "['logs'] | take 10"
+	var p APLParser
+	if r, _ := p.ValidateWithLimit(src, len(src)); !r.Valid {
+		t.Errorf("ValidateWithLimit(%q, %d) = %+v, want valid", src, len(src), r)
+	}
+	r, _ := p.ValidateWithLimit(src, len(src)-1)
+	if r.Valid || r.Errors[0].Code != CodeQueryTooLong || r.Errors[0].HasPos {
+		t.Errorf("ValidateWithLimit(%q, %d) = %+v, want an unpositioned %s", src, len(src)-1, r, CodeQueryTooLong)
+	}
+}
+
+func TestAPLError(t *testing.T) {
+	if e := APLError(errors.New("query exceeds 10 bytes")); e.HasPos || e.Code != CodeQueryTooLong {
+		t.Errorf("APLError of a plain error = %+v", e)
+	}
+	var doc ast.Doc
+	err := ParseAPL("['logs'] | | take 10", &doc)
+	e := APLError(fmt.Errorf("parsing: %w", err))
+	if !e.HasPos || e.Line != 1 || e.Start != e.End || strings.Contains(e.Message, "query.apl") {
+		t.Errorf("APLError of a wrapped parse error = %+v", e)
+	}
+}
+
+// expectedSuffix is the list of grammar productions participle appends to
+// an unexpected token. It names kirby's node types, which change with its
+// grammar, so the goldens leave it out.
+var expectedSuffix = regexp.MustCompile(` \(expected .*\)$`)
+
+// TestAPLGolden validates every testdata/apl/*.apl and compares the Result
+// with the .golden file next to it.
+func TestAPLGolden(t *testing.T) {
+	testGoldens(t, "testdata/apl/*.apl", func(src string) Result {
+		r, _ := APL(src)
+		for i := range r.Errors {
+			r.Errors[i].Message = expectedSuffix.ReplaceAllString(r.Errors[i].Message, "")
+		}
+		return r
+	})
+}
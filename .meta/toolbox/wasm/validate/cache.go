@@ -0,0 +1,65 @@
+package validate
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is a fixed-size least-recently-used map from query source to V, for
+// callers that see the same queries again, such as an editor on undo. It's
+// safe for concurrent use.
+type Cache[V any] struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recent
+	entries map[string]*list.Element
+}
+
+type cacheEntry[V any] struct {
+	src   string
+	value V
+}
+
+// NewCache returns a cache holding at most size entries.
+func NewCache[V any](size int) *Cache[V] {
+	return &Cache[V]{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get returns the value cached for src and marks it as recently used.
+func (c *Cache[V]) Get(src string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[src]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry[V]).value, true
+}
+
+// Add caches value for src, evicting the least recently used entry when
+// the cache is full.
+func (c *Cache[V]) Add(src string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[src]; ok {
+		el.Value.(*cacheEntry[V]).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[src] = c.order.PushFront(&cacheEntry[V]{src: src, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry[V]).src)
+	}
+}
+
+// Clear drops every entry.
+func (c *Cache[V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.entries)
+}
@@ -0,0 +1,183 @@
+package validate
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
+)
+
+// PromQL validates a single expression. The error is the parser's, for
+// callers that want to inspect it; the Result describes it either way.
+func PromQL(src string) (Result, error) {
+	if _, err := ParsePromQL(src); err != nil {
+		return invalid(PromQLErrors(src, err)...), err
+	}
+	return Result{Valid: true}, nil
+}
+
+// ParsePromQL parses src the way PromQL checks it, normalizing it first.
+// Positions in the expression and in the error are in src. The WASM
+// exports that need the expression parse through here, so they accept
+// exactly what ValidatePromQL does.
+func ParsePromQL(src string) (parser.Expr, error) {
+	text, m := normalizeSource(src)
+	expr, err := parser.ParseExpr(text)
+	if err != nil {
+		return nil, m.promError(src, err)
+	}
+	if m != nil {
+		m.promPositions(expr)
+	}
+	return expr, nil
+}
+
+// PromQLError moves the positions of an error the Prometheus parser or
+// lexer reported in Text back into the original source.
+func (n Normalized) PromQLError(err error) error {
+	return n.m.promError(n.src, err)
+}
+
+// promError moves the positions of a Prometheus parser error back into
+// the original source.
+func (m sourceMap) promError(src string, err error) error {
+	var perrs parser.ParseErrors
+	if m == nil || !errors.As(err, &perrs) {
+		return err
+	}
+	shifted := make(parser.ParseErrors, len(perrs))
+	for i, perr := range perrs {
+		m.shiftRange(&perr.PositionRange)
+		perr.Query = src
+		shifted[i] = perr
+	}
+	return shifted
+}
+
+// promPositions moves the positions of node and everything under it back
+// into the original source. Binary expressions and the step-invariant
+// wrapper take theirs from their operands.
+func (m sourceMap) promPositions(node parser.Node) {
+	switch n := node.(type) {
+	case *parser.AggregateExpr:
+		m.shiftRange(&n.PosRange)
+	case *parser.Call:
+		m.shiftRange(&n.PosRange)
+	case *parser.MatrixSelector:
+		_, end := m.span(0, int(n.EndPos))
+		n.EndPos = posrange.Pos(end)
+	case *parser.SubqueryExpr:
+		_, end := m.span(0, int(n.EndPos))
+		n.EndPos = posrange.Pos(end)
+	case *parser.NumberLiteral:
+		m.shiftRange(&n.PosRange)
+	case *parser.ParenExpr:
+		m.shiftRange(&n.PosRange)
+	case *parser.StringLiteral:
+		m.shiftRange(&n.PosRange)
+	case *parser.UnaryExpr:
+		n.StartPos = posrange.Pos(m.original(int(n.StartPos)))
+	case *parser.VectorSelector:
+		m.shiftRange(&n.PosRange)
+	}
+	for _, child := range parser.Children(node) {
+		m.promPositions(child)
+	}
+}
+
+func (m sourceMap) shiftRange(r *posrange.PositionRange) {
+	start, end := m.span(int(r.Start), int(r.End))
+	r.Start, r.End = posrange.Pos(start), posrange.Pos(end)
+}
+
+// PromQLErrors describes every error the Prometheus parser reported in err.
+// An error that isn't the parser's comes back as one Error without a
+// position.
+func PromQLErrors(src string, err error) []Error {
+	var perrs parser.ParseErrors
+	if !errors.As(err, &perrs) {
+		var perr *parser.ParseErr
+		if !errors.As(err, &perr) {
+			return []Error{{Message: err.Error(), Code: ErrorCode(err.Error())}}
+		}
+		perrs = parser.ParseErrors{*perr}
+	}
+	errs := make([]Error, 0, len(perrs))
+	for _, perr := range perrs {
+		e := Error{
+			Start:  clampOffset(src, int(perr.PositionRange.Start)),
+			End:    clampOffset(src, int(perr.PositionRange.End)),
+			HasPos: true,
+			Code:   CodeSyntaxError,
+		}
+		// Some parser errors end before they start, such as the one for
+		// an aggregation over nothing at the end of input.
+		e.End = max(e.End, e.Start)
+		if perr.Err != nil {
+			e.Message = perr.Err.Error()
+			e.Code = ErrorCode(e.Message)
+			e.Unexpected, e.Expected = promUnexpected(e.Message)
+		}
+		lineStart := strings.LastIndexByte(src[:e.Start], '\n') + 1
+		if lineStart == 0 && strings.HasPrefix(src[:e.Start], utf8BOM) {
+			lineStart = len(utf8BOM)
+		}
+		e.Line = strings.Count(src[:e.Start], "\n") + 1
+		e.Column = utf8.RuneCountInString(src[lineStart:e.Start]) + 1
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// The Prometheus parser words syntax errors as
+//
+//	unexpected <item>[ in <context>][, expected <what>]
+//
+// where <what> is a list such as `"," or "}"`. Items are described as
+// "end of input", <op:*>, <by>, identifier "foo", "}" or right parenthesis ')'.
+var (
+	promUnexpectedRe = regexp.MustCompile(`^unexpected (.+?)(?: in [^,"]+)?(?:, expected (.+))?$`)
+	promItemRe       = regexp.MustCompile(`(?:^<(?:op:|aggr:)?(.+)>|("(?:[^"\\]|\\.)*")|'(.)')$`)
+	promListSepRe    = regexp.MustCompile(`, | or `)
+)
+
+// promUnexpected pulls the offending token and the expected alternatives out
+// of a parser message, returning zero values for anything it doesn't
+// recognise.
+func promUnexpected(msg string) (string, []string) {
+	m := promUnexpectedRe.FindStringSubmatch(msg)
+	if m == nil {
+		return "", nil
+	}
+	var unexpected string
+	if strings.HasPrefix(m[1], "end of input") {
+		unexpected = "<EOF>"
+	} else if item := promItemRe.FindStringSubmatch(m[1]); item != nil {
+		switch {
+		case item[1] != "":
+			unexpected = item[1]
+		case item[2] != "":
+			unexpected, _ = strconv.Unquote(item[2])
+		default:
+			unexpected = item[3]
+		}
+	}
+	var expected []string
+	if m[2] != "" {
+		for _, alt := range promListSepRe.Split(m[2], -1) {
+			if s, err := strconv.Unquote(alt); err == nil {
+				alt = s
+			}
+			expected = append(expected, alt)
+		}
+	}
+	return unexpected, expected
+}
+
+func clampOffset(src string, off int) int {
+	return max(0, min(off, len(src)))
+}
@@ -0,0 +1,241 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
+)
+
+// windowsSources are PromQL sources as Windows tools save them, each with
+// the text the parser should see.
+var windowsSources = []struct {
+	src, text string
+}{
+	{"\ufeffsum(x)", "sum(x)"},
+	{"sum(x)\r\n", "sum(x)\n"},
+	{"sum by (job) (\r\n  x\r\n)", "sum by (job) (\n  x\n)"},
+	{"sum(\rx\r)", "sum(\nx\n)"},
+	{"\ufeffsum(\r\n  rate(x[5m])\r\n)", "sum(\n  rate(x[5m])\n)"},
+}
+
+func TestParsePromQLNormalizes(t *testing.T) {
+	for _, tt := range windowsSources {
+		expr, err := ParsePromQL(tt.src)
+		if err != nil {
+			t.Errorf("ParsePromQL(%q): %v", tt.src, err)
+			continue
+		}
+		want, err := parser.ParseExpr(tt.text)
+		if err != nil {
+			t.Fatalf("ParseExpr(%q): %v", tt.text, err)
+		}
+		if expr.String() != want.String() {
+			t.Errorf("ParsePromQL(%q) = %s, want %s", tt.src, expr, want)
+		}
+	}
+}
+
+// TestParsePromQLPositions checks that every node's range covers the same
+// text in the original source as in the normalized one, line breaks aside.
+func TestParsePromQLPositions(t *testing.T) {
+	for _, tt := range windowsSources {
+		expr, err := ParsePromQL(tt.src)
+		if err != nil {
+			t.Fatalf("ParsePromQL(%q): %v", tt.src, err)
+		}
+		want, _ := parser.ParseExpr(tt.text)
+		var got, wantSpans []string
+		parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+			if node == nil {
+				return nil
+			}
+			r := node.PositionRange()
+			got = append(got, unixBreaks.Replace(tt.src[r.Start:r.End]))
+			return nil
+		})
+		parser.Inspect(want, func(node parser.Node, _ []parser.Node) error {
+			if node == nil {
+				return nil
+			}
+			r := node.PositionRange()
+			wantSpans = append(wantSpans, tt.text[r.Start:r.End])
+			return nil
+		})
+		if strings.Join(got, "|") != strings.Join(wantSpans, "|") {
+			t.Errorf("ParsePromQL(%q) spans %q, want %q", tt.src, got, wantSpans)
+		}
+	}
+}
+
+func TestParsePromQLErrorPositions(t *testing.T) {
+	tests := []struct {
+		src, plain string
+	}{
+		{"\ufeffsum(x))", "sum(x))"},
+		{"sum(x)\r\n+", "sum(x)\n+"},
+		{"sum(\r\n  x y\r\n)", "sum(\n  x y\n)"},
+		{"\ufeff{", "{"},
+	}
+	for _, tt := range tests {
+		_, err := ParsePromQL(tt.src)
+		if err == nil {
+			t.Errorf("ParsePromQL(%q) succeeded", tt.src)
+			continue
+		}
+		_, plainErr := parser.ParseExpr(tt.plain)
+		got, want := PromQLErrors(tt.src, err)[0], PromQLErrors(tt.plain, plainErr)[0]
+		if got.Message != want.Message || got.Line != want.Line || got.Column != want.Column {
+			t.Errorf("ParsePromQL(%q) error %v, want %v", tt.src, got, want)
+		}
+		if text := unixBreaks.Replace(tt.src[got.Start:]); text != tt.plain[want.Start:] {
+			t.Errorf("ParsePromQL(%q) error at %q, want %q", tt.src, text, tt.plain[want.Start:])
+		}
+	}
+}
+
+func TestPromQL(t *testing.T) {
+	tests := []struct {
+		src  string
+		code string // empty for a valid query
+	}{
+		{`up`, ""},
+		{`sum by (job) (rate(http_requests_total{code=~"5.."}[5m]))`, ""},
+		{"\ufeffup", ""},
+		{``, CodeEmptyQuery},
+		{`   `, CodeEmptyQuery},
+		{`sum(rate(x[5m])`, CodeUnclosedBracket},
+		{`x{a="b"`, CodeUnexpectedEOF},
+		{`x{a="b`, CodeUnterminatedString},
+		{"x{a=`b", CodeUnterminatedString},
+		{`x{a=~"("}`, CodeInvalidRegex},
+		{`rate(x)`, CodeTypeMismatch},
+		{`1 and 2`, CodeTypeMismatch},
+		{`x[5m] + 1`, CodeTypeMismatch},
+		{`abs(x, y)`, CodeWrongArgumentCount},
+		{`topk(x)`, CodeWrongArgumentCount},
+		{`nosuchfn(x)`, CodeUnknownFunction},
+		{`x[5x]`, CodeInvalidNumber},
+		{`x $ y`, CodeInvalidCharacter},
+		{`x y`, CodeUnexpectedToken},
+		{`{}`, CodeSyntaxError},
+	}
+	for _, tt := range tests {
+		r, err := PromQL(tt.src)
+		if err := r.Check(tt.src); err != nil {
+			t.Errorf("PromQL(%q): %v", tt.src, err)
+		}
+		if tt.code == "" {
+			if !r.Valid || err != nil {
+				t.Errorf("PromQL(%q) = %+v, %v, want valid", tt.src, r, err)
+			}
+			continue
+		}
+		if r.Valid || err == nil {
+			t.Errorf("PromQL(%q) is valid, want %s", tt.src, tt.code)
+			continue
+		}
+		if r.Errors[0].Code != tt.code {
+			t.Errorf("PromQL(%q) code %s (%s), want %s", tt.src, r.Errors[0].Code, r.Errors[0].Message, tt.code)
+		}
+	}
+}
+
+func TestPromQLErrors(t *testing.T) {
+	t.Run("not the parser's", func(t *testing.T) {
+		errs := PromQLErrors("x", errors.New("validation timed out"))
+		want := []Error{{Message: "validation timed out", Code: CodeTimedOut}}
+		if !reflect.DeepEqual(errs, want) {
+			t.Errorf("PromQLErrors = %+v, want %+v", errs, want)
+		}
+	})
+	t.Run("single ParseErr", func(t *testing.T) {
+		err := &parser.ParseErr{PositionRange: posrange.PositionRange{Start: 2, End: 3}, Err: errors.New(`unexpected "}"`)}
+		errs := PromQLErrors("a\nb}", err)
+		want := []Error{{Message: `unexpected "}"`, Code: CodeUnexpectedToken, Line: 2, Column: 1, Start: 2, End: 3, HasPos: true, Unexpected: "}"}}
+		if !reflect.DeepEqual(errs, want) {
+			t.Errorf("PromQLErrors = %+v, want %+v", errs, want)
+		}
+	})
+	t.Run("every error", func(t *testing.T) {
+		src := `rate(x) + rate(y)`
+		_, err := PromQL(src)
+		var perrs parser.ParseErrors
+		if !errors.As(err, &perrs) {
+			t.Fatalf("PromQL(%q) error is %T", src, err)
+		}
+		if errs := PromQLErrors(src, err); len(errs) != len(perrs) {
+			t.Errorf("PromQLErrors returned %d errors, the parser %d", len(errs), len(perrs))
+		}
+	})
+	t.Run("columns count runes", func(t *testing.T) {
+		src := "x{a=\"é\"} y"
+		_, err := PromQL(src)
+		e := PromQLErrors(src, err)[0]
+		if e.Column != 10 || src[e.Start:] != "y" {
+			t.Errorf("PromQLErrors(%q) at column %d, offset %d", src, e.Column, e.Start)
+		}
+	})
+	t.Run("clamped", func(t *testing.T) {
+		err := &parser.ParseErr{PositionRange: posrange.PositionRange{Start: 10, End: 20}, Err: errors.New("unexpected end of input")}
+		e := PromQLErrors("sum(", err)[0]
+		if e.Start != 4 || e.End != 4 {
+			t.Errorf("PromQLErrors spans %d-%d, want 4-4", e.Start, e.End)
+		}
+	})
+}
+
+func TestPromUnexpected(t *testing.T) {
+	tests := []struct {
+		msg        string
+		unexpected string
+		expected   []string
+	}{
+		{`unexpected end of input`, "<EOF>", nil},
+		{`unexpected end of input inside braces`, "<EOF>", nil},
+		{`unexpected identifier "y"`, "y", nil},
+		{`unexpected "}" in label matching, expected string`, "}", []string{"string"}},
+		{`unexpected <by> in aggregation`, "by", nil},
+		{`unexpected <op:+>`, "+", nil},
+		{`unexpected right parenthesis ')'`, ")", nil},
+		{`unexpected "," in label matching, expected "=" or "!="`, ",", []string{"=", "!="}},
+		{`unclosed left parenthesis`, "", nil},
+	}
+	for _, tt := range tests {
+		unexpected, expected := promUnexpected(tt.msg)
+		if unexpected != tt.unexpected || !slices.Equal(expected, tt.expected) {
+			t.Errorf("promUnexpected(%q) = %q, %q, want %q, %q", tt.msg, unexpected, expected, tt.unexpected, tt.expected)
+		}
+	}
+}
+
+// TestPromQLGolden validates every testdata/promql/*.promql and compares
+// the Result with the .golden file next to it.
+func TestPromQLGolden(t *testing.T) {
+	testGoldens(t, "testdata/promql/*.promql", func(src string) Result {
+		r, _ := PromQL(src)
+		return r
+	})
+}
+
+// FuzzValidatePromQL checks that every Result is well formed and that the
+// error, when there is one, agrees with it. The seed corpus is under
+// testdata/fuzz.
+func FuzzValidatePromQL(f *testing.F) {
+	for _, tt := range windowsSources {
+		f.Add(tt.src)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		r, err := PromQL(src)
+		if err := r.Check(src); err != nil {
+			t.Fatalf("PromQL(%q) = %+v: %v", src, r, err)
+		}
+		if r.Valid != (err == nil) {
+			t.Fatalf("PromQL(%q) is valid %v with error %v", src, r.Valid, err)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+// Package validate checks APL and PromQL queries. It's the part of the WASM
+// modules in the parent directory that doesn't touch syscall/js, so Go
+// services validate exactly the way the editor does, and the JS exports
+// only marshal what it returns. Nothing here needs a JS runtime, so it's
+// where tests of the parsers belong.
+//
+// apl.go needs the kirby parser from axiom1 and promql.go the Prometheus
+// parser. build.sh stages each WASM module with only its half, under the
+// import path toolbox/validate; code that has both dependencies can take
+// the whole directory. test.sh stages the tests the same way, so each half's
+// tests live in its own _test file.
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Result is the outcome of validating one query.
+type Result struct {
+	Valid bool
+	// Errors holds every problem the parser reported, empty when Valid.
+	Errors []Error
+}
+
+// Error is a single parse error. Start and End are byte offsets into the
+// source, end exclusive, and Line and Column are 1-based. All four are zero
+// when HasPos is false. Unexpected is the offending token, "<EOF>" at the
+// end of input, and Expected what the parser would have accepted instead;
+// both are empty when the message doesn't say. Code classifies the error
+// for callers that can't show Message as is; see ErrorCode.
+type Error struct {
+	Message      string
+	Code         string
+	Line, Column int
+	Start, End   int
+	HasPos       bool
+	Unexpected   string
+	Expected     []string
+}
+
+func (e Error) Error() string {
+	if !e.HasPos {
+		return e.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Error codes. They're stable: new ones may be added, but none is renamed
+// or changes meaning. ErrorCode never returns CodeInvalidArguments,
+// CodeFunctionNotAllowed, CodeExperimentalDisabled or CodeTooManyStages,
+// which the JS exports use for calls with the wrong arguments, for
+// functions a policy rejects, for operators a feature flag turns off and
+// for queries over a stage limit, nor CodeInternal, which they use when a
+// parser panics. Only PromQL errors get CodeUnknownFunction: kirby takes
+// any name in call position and leaves resolving it to the planner.
+const (
+	CodeEmptyQuery           = "empty_query"
+	CodeUnexpectedEOF        = "unexpected_eof"
+	CodeUnexpectedToken      = "unexpected_token"
+	CodeInvalidCharacter     = "invalid_character"
+	CodeUnterminatedString   = "unterminated_string"
+	CodeUnclosedBracket      = "unclosed_bracket"
+	CodeInvalidNumber        = "invalid_number"
+	CodeInvalidRegex         = "invalid_regex"
+	CodeUnknownFunction      = "unknown_function"
+	CodeWrongArgumentCount   = "wrong_argument_count"
+	CodeTypeMismatch         = "type_mismatch"
+	CodeQueryTooLong         = "query_too_long"
+	CodeTimedOut             = "timed_out"
+	CodeInvalidArguments     = "invalid_arguments"
+	CodeFunctionNotAllowed   = "function_not_allowed"
+	CodeExperimentalDisabled = "experimental_disabled"
+	CodeTooManyStages        = "too_many_stages"
+	CodeSyntaxError          = "syntax_error"
+	CodeInternal             = "internal_error"
+)
+
+// errorCodes map the wording of kirby and Prometheus parser errors, and of
+// the errors this package and the WASM modules make up, to codes. The first
+// match wins, so specific patterns go before general ones.
+var errorCodes = []struct {
+	re   *regexp.Regexp
+	code string
+}{
+	{regexp.MustCompile(`^(empty query|no expression found in input)`), CodeEmptyQuery},
+	{regexp.MustCompile(`^query exceeds \d+ bytes`), CodeQueryTooLong},
+	{regexp.MustCompile(`^validation timed out`), CodeTimedOut},
+	{regexp.MustCompile(`^(unterminated (quoted|raw) string|invalid input text "(\\"|'|\x60))`), CodeUnterminatedString},
+	{regexp.MustCompile(`^unclosed left (parenthesis|bracket|brace)`), CodeUnclosedBracket},
+	{regexp.MustCompile(`^unexpected (end of input|token "<EOF>")`), CodeUnexpectedEOF},
+	{regexp.MustCompile(`^(unexpected character|invalid input text)`), CodeInvalidCharacter},
+	{regexp.MustCompile(`^unknown function`), CodeUnknownFunction},
+	{regexp.MustCompile(`^(expected \d+ argument|wrong number of arguments)`), CodeWrongArgumentCount},
+	{regexp.MustCompile(`^(expected type |binary expression must contain|set operator .* not allowed|invalid expression type )`), CodeTypeMismatch},
+	{regexp.MustCompile(`^(bad number|error parsing number|not a valid duration)`), CodeInvalidNumber},
+	{regexp.MustCompile(`^error parsing regexp`), CodeInvalidRegex},
+	{regexp.MustCompile(`^unexpected `), CodeUnexpectedToken},
+}
+
+// ErrorCode classifies an error message from either parser, falling back
+// to CodeSyntaxError.
+func ErrorCode(msg string) string {
+	msg = strings.TrimPrefix(msg, "lexer: ")
+	for _, c := range errorCodes {
+		if c.re.MatchString(msg) {
+			return c.code
+		}
+	}
+	return CodeSyntaxError
+}
+
+// Check reports the first way r isn't a well-formed result of validating
+// src: Valid must be true exactly when there are no errors, every error
+// needs a message and a code, and positions must lie within src, or be
+// zero when HasPos is false. Fuzzing either validator should never make it
+// fail.
+func (r Result) Check(src string) error {
+	if r.Valid != (len(r.Errors) == 0) {
+		return fmt.Errorf("valid is %v with %d errors", r.Valid, len(r.Errors))
+	}
+	for i, e := range r.Errors {
+		switch {
+		case e.Message == "":
+			return fmt.Errorf("error %d has no message", i)
+		case e.Code == "":
+			return fmt.Errorf("error %d has no code", i)
+		case !e.HasPos && (e.Line != 0 || e.Column != 0 || e.Start != 0 || e.End != 0):
+			return fmt.Errorf("error %d has a position but HasPos is false", i)
+		case e.HasPos && (e.Line < 1 || e.Column < 1):
+			return fmt.Errorf("error %d is at %d:%d", i, e.Line, e.Column)
+		case e.HasPos && (e.Start < 0 || e.Start > e.End || e.End > len(src)):
+			return fmt.Errorf("error %d spans %d-%d of %d bytes", i, e.Start, e.End, len(src))
+		}
+	}
+	return nil
+}
+
+func invalid(errs ...Error) Result {
+	return Result{Errors: errs}
+}
+
+const utf8BOM = "\uFEFF"
+
+// sourceMap takes offsets in a normalized source back to the original. It
+// holds the normalized offset of every byte normalizing dropped, in order;
+// nil means nothing was dropped.
+type sourceMap []int
+
+// normalizeSource strips a leading UTF-8 BOM and turns \r\n and lone \r
+// into \n, which is what sources pasted from Windows tools need before the
+// parsers accept them. Line breaks stay line breaks, so lines and columns
+// are the same in both; only byte offsets move.
+func normalizeSource(src string) (string, sourceMap) {
+	if !strings.HasPrefix(src, utf8BOM) && !strings.Contains(src, "\r") {
+		return src, nil
+	}
+	var (
+		sb      strings.Builder
+		dropped sourceMap
+	)
+	sb.Grow(len(src))
+	if strings.HasPrefix(src, utf8BOM) {
+		src = src[len(utf8BOM):]
+		dropped = append(dropped, 0, 0, 0)
+	}
+	for i := 0; i < len(src); i++ {
+		if src[i] != '\r' {
+			sb.WriteByte(src[i])
+			continue
+		}
+		if i+1 < len(src) && src[i+1] == '\n' {
+			dropped = append(dropped, sb.Len())
+			continue
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String(), dropped
+}
+
+// original is the offset in the original source of the byte at off in the
+// normalized one. A dropped \r maps to the \n after it.
+func (m sourceMap) original(off int) int {
+	return off + sort.SearchInts(m, off+1)
+}
+
+// span is original for the byte range start to end, end exclusive. The end
+// stays just past the last byte of the range rather than moving past a \r
+// dropped after it.
+func (m sourceMap) span(start, end int) (int, int) {
+	start = m.original(start)
+	if end == 0 {
+		return start, start
+	}
+	return start, max(start, m.original(end-1)+1)
+}
+
+// Normalized is a source as both validators parse it, for callers that run
+// a lexer over it themselves.
+type Normalized struct {
+	// Text is the source with normalizeSource applied.
+	Text string
+	src  string
+	m    sourceMap
+}
+
+// Normalize normalizes src the way APL and PromQL do before parsing it.
+func Normalize(src string) Normalized {
+	text, m := normalizeSource(src)
+	return Normalized{Text: text, src: src, m: m}
+}
+
+// Original is the offset in the original source of the byte at off in
+// Text.
+func (n Normalized) Original(off int) int {
+	return n.m.original(off)
+}
+
+// OriginalSpan is Original for the byte range start to end of Text, end
+// exclusive.
+func (n Normalized) OriginalSpan(start, end int) (int, int) {
+	return n.m.span(start, end)
+}
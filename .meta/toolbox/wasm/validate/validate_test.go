@@ -0,0 +1,210 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// unixBreaks turns Windows and classic Mac line breaks into \n.
+var unixBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		src, text string
+	}{
+		{"", ""},
+		{"abc", "abc"},
+		{"\ufeffabc", "abc"},
+		{"a\r\nb", "a\nb"},
+		{"a\rb\r", "a\nb\n"},
+		{"\ufeffa\r\n\r\nb\r", "a\n\nb\n"},
+		{"a\ufeffb", "a\ufeffb"},
+	}
+	for _, tt := range tests {
+		n := Normalize(tt.src)
+		if n.Text != tt.text {
+			t.Errorf("Normalize(%q).Text = %q, want %q", tt.src, n.Text, tt.text)
+		}
+		// Every byte maps to one that reads the same, line breaks aside.
+		for off := 0; off < len(n.Text); off++ {
+			orig := n.Original(off)
+			if got := unixBreaks.Replace(tt.src[orig:]); got != n.Text[off:] {
+				t.Errorf("Normalize(%q).Original(%d) = %d, at %q", tt.src, off, orig, tt.src[orig:])
+			}
+		}
+		if end := n.Original(len(n.Text)); end != len(tt.src) {
+			t.Errorf("Normalize(%q).Original(%d) = %d, want %d", tt.src, len(n.Text), end, len(tt.src))
+		}
+	}
+}
+
+func TestOriginalSpan(t *testing.T) {
+	tests := []struct {
+		src        string
+		start, end int // in the normalized text
+		want       string
+	}{
+		{"\ufeffab", 0, 2, "ab"},
+		{"ab\r\ncd", 0, 2, "ab"},
+		{"ab\r\ncd", 0, 3, "ab\r\n"},
+		{"ab\r\ncd", 3, 5, "cd"},
+		{"ab\r\ncd", 2, 2, ""},
+		{"ab\rcd", 1, 4, "b\rc"},
+	}
+	for _, tt := range tests {
+		start, end := Normalize(tt.src).OriginalSpan(tt.start, tt.end)
+		if got := tt.src[start:end]; got != tt.want {
+			t.Errorf("Normalize(%q).OriginalSpan(%d, %d) covers %q, want %q", tt.src, tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeSource(t *testing.T) {
+	tests := []struct {
+		src  string
+		text string
+		m    sourceMap
+	}{
+		{"sum(x)", "sum(x)", nil},
+		{"\ufeffsum(x)", "sum(x)", sourceMap{0, 0, 0}},
+		{"a\r\nb\r\nc", "a\nb\nc", sourceMap{1, 3}},
+		{"a\rb", "a\nb", sourceMap(nil)},
+		{"\ufeff\r\n", "\n", sourceMap{0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		text, m := normalizeSource(tt.src)
+		if text != tt.text || !slices.Equal(m, tt.m) {
+			t.Errorf("normalizeSource(%q) = %q, %v, want %q, %v", tt.src, text, m, tt.text, tt.m)
+		}
+	}
+}
+
+// TestErrorCode covers the messages that reach ErrorCode from outside this
+// package. TestAPL, TestParseAPLRejects and TestPromQL check the code of
+// every error the parsers themselves produce.
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		msg, code string
+	}{
+		{"validation timed out", CodeTimedOut},
+		{`invalid expression type "range vector" for range query, must be scalar or instant vector`, CodeTypeMismatch},
+		{"something else", CodeSyntaxError},
+	}
+	for _, tt := range tests {
+		if code := ErrorCode(tt.msg); code != tt.code {
+			t.Errorf("ErrorCode(%q) = %s, want %s", tt.msg, code, tt.code)
+		}
+	}
+}
+
+func TestResultCheck(t *testing.T) {
+	src := "sum(x"
+	tests := []struct {
+		name string
+		r    Result
+		ok   bool
+	}{
+		{"valid", Result{Valid: true}, true},
+		{"invalid", Result{Errors: []Error{{Message: "m", Code: CodeSyntaxError, Line: 1, Column: 6, Start: 5, End: 5, HasPos: true}}}, true},
+		{"no position", Result{Errors: []Error{{Message: "m", Code: CodeSyntaxError}}}, true},
+		{"valid with errors", Result{Valid: true, Errors: []Error{{Message: "m", Code: CodeSyntaxError}}}, false},
+		{"invalid without errors", Result{}, false},
+		{"no message", Result{Errors: []Error{{Code: CodeSyntaxError}}}, false},
+		{"no code", Result{Errors: []Error{{Message: "m"}}}, false},
+		{"stray position", Result{Errors: []Error{{Message: "m", Code: CodeSyntaxError, Start: 1}}}, false},
+		{"column 0", Result{Errors: []Error{{Message: "m", Code: CodeSyntaxError, Line: 1, HasPos: true}}}, false},
+		{"past the end", Result{Errors: []Error{{Message: "m", Code: CodeSyntaxError, Line: 1, Column: 1, End: 6, HasPos: true}}}, false},
+		{"backwards", Result{Errors: []Error{{Message: "m", Code: CodeSyntaxError, Line: 1, Column: 1, Start: 3, End: 2, HasPos: true}}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.r.Check(src); (err == nil) != tt.ok {
+			t.Errorf("%s: Check = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache[int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf(`Get("a") = %d, %v, want 1, true`, v, ok)
+	}
+	// "a" was used last, so adding a third entry evicts "b".
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error(`"b" wasn't evicted`)
+	}
+	for src, want := range map[string]int{"a": 1, "c": 3} {
+		if v, ok := c.Get(src); !ok || v != want {
+			t.Errorf("Get(%q) = %d, %v, want %d, true", src, v, ok, want)
+		}
+	}
+
+	c.Add("a", 10)
+	if v, _ := c.Get("a"); v != 10 {
+		t.Errorf(`Get("a") after Add = %d, want 10`, v)
+	}
+	c.Clear()
+	for _, src := range []string{"a", "b", "c"} {
+		if _, ok := c.Get(src); ok {
+			t.Errorf("Get(%q) after Clear found an entry", src)
+		}
+	}
+	c.Add("d", 4)
+	if v, ok := c.Get("d"); !ok || v != 4 {
+		t.Errorf(`Get("d") after Clear = %d, %v, want 4, true`, v, ok)
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files under testdata")
+
+// testGoldens validates every file matching glob and compares the Result
+// with the .golden file next to it. Run with -update to rewrite them after
+// a deliberate change.
+func testGoldens(t *testing.T, glob string, validate func(src string) Result) {
+	inputs, err := filepath.Glob(glob)
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no inputs: %v", err)
+	}
+	for _, in := range inputs {
+		t.Run(filepath.Base(in), func(t *testing.T) {
+			src, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := validate(string(src))
+			if err := r.Check(string(src)); err != nil {
+				t.Error(err)
+			}
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "\t")
+			if err := enc.Encode(r); err != nil {
+				t.Fatal(err)
+			}
+			got := buf.Bytes()
+			golden := strings.TrimSuffix(in, filepath.Ext(in)) + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s =\n%s\nwant\n%s", in, got, want)
+			}
+		})
+	}
+}